@@ -0,0 +1,255 @@
+package chatbot
+
+import (
+	"context"
+	"fmt"
+	"github.com/ku/chatbot-slack-llm/messagestore"
+	"github.com/slack-go/slack"
+	"log"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+)
+
+const adminUsage = "Usage: `/chatbot status|reload|usage [model|user|channel]|mute [#channel]|unmute [#channel]|model [<model>|default]|forget <thread>`"
+
+// usagePeriod is the period summarized by "/chatbot usage".
+const usagePeriod = 7 * 24 * time.Hour
+
+// Reloader reloads the configuration and returns the changed keys.
+type Reloader func() ([]string, error)
+
+// WithReloader enables "/chatbot reload".
+func WithReloader(r Reloader) Option {
+	return func(c *ChatBot) {
+		c.reloader = r
+	}
+}
+
+var (
+	// channelRef is a channel escaped by Slack, e.g. <#C0123456789|general>.
+	channelRef = regexp.MustCompile(`^<#([A-Z0-9]+)(\|[^>]*)?>$`)
+	// permalinkRef is the permalink of a message, e.g. https://example.slack.com/archives/C0123456789/p1690000000123456.
+	permalinkRef = regexp.MustCompile(`/archives/[A-Z0-9]+/p(\d{10})(\d{6})`)
+	threadTS     = regexp.MustCompile(`^\d+\.\d+$`)
+)
+
+// parseChannel returns the channel ID of "#channel", or the default one when it's empty.
+func parseChannel(arg, def string) (string, bool) {
+	switch {
+	case arg == "":
+		return def, true
+	case channelRef.MatchString(arg):
+		return channelRef.FindStringSubmatch(arg)[1], true
+	case strings.HasPrefix(arg, "C"):
+		return arg, true
+	}
+	return "", false
+}
+
+// parseThread returns the thread ID of a timestamp or a permalink.
+func parseThread(arg string) (string, bool) {
+	if threadTS.MatchString(arg) {
+		return arg, true
+	}
+	if m := permalinkRef.FindStringSubmatch(strings.Trim(arg, "<>")); m != nil {
+		return m[1] + "." + m[2], true
+	}
+	return "", false
+}
+
+// OnSlashCommand runs the admin command and returns the ephemeral reply to the admin.
+func (c *ChatBot) OnSlashCommand(ctx context.Context, cmd *slack.SlashCommand) (string, error) {
+	if !c.isAdmin(cmd.UserID) {
+		return notAdminMessage, nil
+	}
+
+	fields := strings.Fields(cmd.Text)
+	if len(fields) == 0 {
+		return adminUsage, nil
+	}
+	name, args := strings.ToLower(fields[0]), fields[1:]
+	arg := strings.Join(args, " ")
+	log.Printf("admin command by %s: %s", cmd.UserID, cmd.Text)
+
+	switch name {
+	case "status":
+		return c.status(), nil
+	case "reload":
+		return c.reload()
+	case "usage":
+		return c.recentUsage(ctx, arg)
+	case "mute", "unmute":
+		ch, ok := parseChannel(arg, cmd.ChannelID)
+		if !ok {
+			return fmt.Sprintf("Unknown channel %s.", arg), nil
+		}
+		c.setMuted(ch, name == "mute")
+		if name == "mute" {
+			return fmt.Sprintf("OK, I won't answer in <#%s> until it's unmuted.", ch), nil
+		}
+		return fmt.Sprintf("OK, I'll answer in <#%s> again.", ch), nil
+	case "model":
+		return c.setChannelModel(cmd.ChannelID, arg), nil
+	case "forget":
+		thid, ok := parseThread(arg)
+		if !ok {
+			return "Usage: `/chatbot forget <thread timestamp or permalink>`", nil
+		}
+		return c.forget(ctx, thid)
+	}
+	return adminUsage, nil
+}
+
+func (c *ChatBot) status() string {
+	p := c.personas.Load()
+	lines := []string{
+		"mode: " + c.chat.Name(),
+		"messagestore: " + c.store.Name(),
+		"persona: " + p.Default.Name,
+		"llm: " + p.Default.LLM.Name(),
+		fmt.Sprintf("personas: %d", len(p.Named)),
+		fmt.Sprintf("pending: %d", c.dispatcher.Pending()),
+	}
+
+	c.adminMu.Lock()
+	var muted []string
+	for ch := range c.muted {
+		muted = append(muted, "<#"+ch+">")
+	}
+	var models []string
+	for ch, model := range c.channelModels {
+		models = append(models, fmt.Sprintf("<#%s> %s", ch, model))
+	}
+	c.adminMu.Unlock()
+	sort.Strings(muted)
+	sort.Strings(models)
+	if len(muted) > 0 {
+		lines = append(lines, "muted: "+strings.Join(muted, ", "))
+	}
+	if len(models) > 0 {
+		lines = append(lines, "models: "+strings.Join(models, ", "))
+	}
+
+	if vr, ok := p.Default.LLM.(VarsReporter); ok {
+		lines = append(lines, vr.DebugVars()...)
+	}
+	return strings.Join(lines, "\n")
+}
+
+func (c *ChatBot) reload() (string, error) {
+	if c.reloader == nil {
+		return "Reload needs the bot to be started with --config.", nil
+	}
+	changes, err := c.reloader()
+	if err != nil {
+		return "", fmt.Errorf("failed to reload: %w", err)
+	}
+	if len(changes) == 0 {
+		return "Reloaded. Nothing changed.", nil
+	}
+	return "Reloaded.\n" + strings.Join(changes, "\n"), nil
+}
+
+// recentUsage summarizes the usage in usagePeriod by model, user or channel.
+func (c *ChatBot) recentUsage(ctx context.Context, by string) (string, error) {
+	keys := map[string]func(r *messagestore.UsageRecord) string{
+		"model":   func(r *messagestore.UsageRecord) string { return r.Model },
+		"user":    func(r *messagestore.UsageRecord) string { return "<@" + r.User + ">" },
+		"channel": func(r *messagestore.UsageRecord) string { return "<#" + r.Channel + ">" },
+	}
+	if by == "" {
+		by = "model"
+	}
+	key, ok := keys[by]
+	if !ok {
+		return adminUsage, nil
+	}
+
+	us, ok := c.store.(messagestore.UsageStore)
+	if !ok {
+		return fmt.Sprintf("Messagestore %s doesn't record usage.", c.store.Name()), nil
+	}
+	rs, err := us.ListUsage(ctx, &messagestore.UsageFilter{From: time.Now().Add(-usagePeriod)})
+	if err != nil {
+		return "", err
+	}
+	if len(rs) == 0 {
+		return "No usage recorded in the last 7 days.", nil
+	}
+
+	lines := []string{"Usage in the last 7 days by " + by + ":"}
+	total := &UsageSummary{Key: "total"}
+	for _, s := range SummarizeUsage(rs, c.pricing, key) {
+		lines = append(lines, s.String())
+		total.Requests += s.Requests
+		total.PromptTokens += s.PromptTokens
+		total.CompletionTokens += s.CompletionTokens
+		total.Cost += s.Cost
+	}
+	return strings.Join(append(lines, total.String()), "\n"), nil
+}
+
+func (c *ChatBot) setMuted(channel string, muted bool) {
+	c.adminMu.Lock()
+	defer c.adminMu.Unlock()
+	if muted {
+		c.muted[channel] = true
+	} else {
+		delete(c.muted, channel)
+	}
+}
+
+// isMuted tells whether the bot ignores the messages in the channel.
+func (c *ChatBot) isMuted(channel string) bool {
+	c.adminMu.Lock()
+	defer c.adminMu.Unlock()
+	return c.muted[channel]
+}
+
+// setChannelModel shows the model of the channel without a model, and overrides it otherwise.
+// The model set in a thread takes precedence.
+func (c *ChatBot) setChannelModel(channel, model string) string {
+	c.adminMu.Lock()
+	defer c.adminMu.Unlock()
+
+	switch {
+	case model == "":
+		current, ok := c.channelModels[channel]
+		if !ok {
+			current = "the default model"
+		}
+		return fmt.Sprintf("<#%s> uses %s. Available: %s", channel, current, strings.Join(c.models, ", "))
+	case model == resetArg:
+		delete(c.channelModels, channel)
+		return fmt.Sprintf("OK, <#%s> uses the default model.", channel)
+	}
+	if !hasModel(c.models, model) {
+		return fmt.Sprintf("Unknown model %s. Available: %s", model, strings.Join(c.models, ", "))
+	}
+	c.channelModels[channel] = model
+	return fmt.Sprintf("OK, <#%s> uses %s.", channel, model)
+}
+
+func (c *ChatBot) channelModel(channel string) string {
+	c.adminMu.Lock()
+	defer c.adminMu.Unlock()
+	return c.channelModels[channel]
+}
+
+// forget deletes the conversation of the thread so that the bot doesn't answer in it anymore.
+func (c *ChatBot) forget(ctx context.Context, thid string) (string, error) {
+	d, ok := c.store.(messagestore.ConversationDeleter)
+	if !ok {
+		return fmt.Sprintf("Messagestore %s can't forget conversations.", c.store.Name()), nil
+	}
+	if err := d.DeleteConversation(ctx, thid); err != nil {
+		return "", err
+	}
+
+	c.tracesMu.Lock()
+	delete(c.traces, thid)
+	c.tracesMu.Unlock()
+	return fmt.Sprintf("OK, I forgot the thread %s.", thid), nil
+}
@@ -0,0 +1,86 @@
+package chatbot
+
+import (
+	"context"
+	"github.com/ku/chatbot-slack-llm/internal/completion"
+	"github.com/ku/chatbot-slack-llm/internal/conversation/memory"
+	"github.com/ku/chatbot-slack-llm/messagestore"
+	"github.com/slack-go/slack"
+	"github.com/slack-go/slack/slackevents"
+	"testing"
+)
+
+func TestParseThread(t *testing.T) {
+	tests := map[string]struct {
+		arg  string
+		want string
+	}{
+		"timestamp": {arg: "1690000000.123456", want: "1690000000.123456"},
+		"permalink": {arg: "<https://example.slack.com/archives/C0123456789/p1690000000123456>", want: "1690000000.123456"},
+		"invalid":   {arg: "yesterday", want: ""},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			if got, _ := parseThread(tt.arg); got != tt.want {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestChatBot_OnSlashCommand(t *testing.T) {
+	ctx := context.Background()
+	store := memory.NewConversations("B1")
+	c := New(store, &chatRecorder{}, &tracingLLM{}, nil, "B1", WithAdmins("U1"))
+
+	run := func(user, text string) string {
+		t.Helper()
+		got, err := c.OnSlashCommand(ctx, &slack.SlashCommand{Command: "/chatbot", UserID: user, ChannelID: "C1", Text: text})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return got
+	}
+	message := func(thid string) *slackevents.MessageEvent {
+		return &slackevents.MessageEvent{User: "U2", Channel: "C2", Text: "<@B1> question", TimeStamp: thid, ThreadTimeStamp: thid}
+	}
+
+	if got := run("U2", "mute <#C2|random>"); got != notAdminMessage {
+		t.Errorf("non-admins got %q", got)
+	}
+	if got, want := run("U1", "mute <#C2|random>"), "OK, I won't answer in <#C2> until it's unmuted."; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+	if err := c.OnMessage(ctx, message("1.0")); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := store.GetConversation(ctx, "1.0"); err == nil {
+		t.Error("messages in muted channels shouldn't be stored")
+	}
+
+	run("U1", "unmute <#C2>")
+	if _, err := store.OnMessage(ctx, messagestore.NewMessageFromMessage(message("2.0"))); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := run("U1", "forget 2.0"), "OK, I forgot the thread 2.0."; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+	if _, err := store.GetConversation(ctx, "2.0"); err == nil {
+		t.Error("the conversation should be deleted")
+	}
+
+	if got, want := run("U1", "model gpt-4"), "OK, <#C1> uses gpt-4."; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+	m := messagestore.NewMessageFromMessage(&slackevents.MessageEvent{User: "U2", Channel: "C1", TimeStamp: "3.0", ThreadTimeStamp: "3.0"})
+	if got := c.requestOptions(ctx, m, &completion.Options{}).Model; got != "gpt-4" {
+		t.Errorf("got model %q in the channel", got)
+	}
+
+	if got, want := run("U1", "reload"), "Reload needs the bot to be started with --config."; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+	if got := run("U1", "dance"); got != adminUsage {
+		t.Errorf("got %q for an unknown command", got)
+	}
+}
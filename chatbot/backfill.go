@@ -0,0 +1,82 @@
+package chatbot
+
+import (
+	"context"
+	"github.com/ku/chatbot-slack-llm/internal/completion"
+	"github.com/ku/chatbot-slack-llm/messagestore"
+	"log"
+)
+
+// needsBackfill tells if the earlier messages of the thread should be fetched from the ChatService:
+// the bot is mentioned in a thread unknown to the store, e.g. in the middle of a thread.
+// Other messages never call the API, so that the chatter in the threads without the bot stays cheap.
+func (c *ChatBot) needsBackfill(ctx context.Context, m messagestore.Message) bool {
+	if _, ok := c.chat.(ThreadFetcher); !ok {
+		return false
+	}
+	// the root of a thread has no history.
+	if m.GetThreadTimestamp() == "" || m.GetThreadTimestamp() == m.GetTimestamp() || !m.IsMentionAt(c.botID) {
+		return false
+	}
+	_, err := c.store.GetConversation(ctx, m.GetThreadID())
+	return err != nil
+}
+
+// dispatchBackfill fetches the thread and replies to the message in the dispatcher,
+// so that the event is acknowledged without waiting for the API.
+func (c *ChatBot) dispatchBackfill(ctx context.Context, m messagestore.Message) error {
+	return c.enqueue(ctx, m, func(ctx context.Context) {
+		added, err := c.backfill(ctx, m)
+		if err != nil {
+			log.Println(err.Error())
+		}
+		if !added {
+			return
+		}
+		cv, err := c.store.GetConversation(ctx, m.GetThreadID())
+		if err != nil {
+			log.Println(err.Error())
+			return
+		}
+		if c.shouldIgnore(cv, m) {
+			return
+		}
+		c.reply(ctx, m, &completion.Options{})
+	})
+}
+
+// backfill adds the earlier messages of the thread and the message to the store.
+func (c *ChatBot) backfill(ctx context.Context, m messagestore.Message) (bool, error) {
+	history, err := c.chat.(ThreadFetcher).FetchThread(ctx, m.GetChannel(), m.GetThreadID())
+	if err != nil {
+		log.Printf("failed to backfill %s: %s", m.GetThreadID(), err.Error())
+		return c.store.OnMessage(ctx, m)
+	}
+
+	// the first mention starts the conversation. the store puts the others in the order of the timestamps.
+	var msgs []messagestore.Message
+	start := -1
+	for _, hm := range append(history, m) {
+		if hm.GetFrom() == c.botID || (hm != m && hm.GetTimestamp() == m.GetTimestamp()) {
+			continue
+		}
+		if start < 0 && hm.IsMentionAt(c.botID) {
+			start = len(msgs)
+		}
+		msgs = append(msgs, hm)
+	}
+	msgs[0], msgs[start] = msgs[start], msgs[0]
+
+	var added bool
+	for _, hm := range msgs {
+		ok, err := c.store.OnMessage(ctx, hm)
+		if err != nil {
+			return false, err
+		}
+		if hm == m {
+			added = ok
+		}
+	}
+	log.Printf("backfilled %d messages of %s", len(msgs)-1, m.GetThreadID())
+	return added, nil
+}
@@ -0,0 +1,112 @@
+package chatbot
+
+import (
+	"context"
+	"github.com/ku/chatbot-slack-llm/internal/conversation/memory"
+	"github.com/ku/chatbot-slack-llm/messagestore"
+	"github.com/slack-go/slack/slackevents"
+	"testing"
+)
+
+// threadChat has the threads posted before the bot started.
+type threadChat struct {
+	chatRecorder
+	threads map[string][]*slackevents.MessageEvent
+	fetched int
+}
+
+func (c *threadChat) FetchThread(_ context.Context, channel, thid string) ([]messagestore.Message, error) {
+	c.fetched++
+	var msgs []messagestore.Message
+	for _, ev := range c.threads[thid] {
+		msgs = append(msgs, messagestore.NewMessageFromMessage(ev))
+	}
+	return msgs, nil
+}
+
+func TestChatBot_backfill(t *testing.T) {
+	ctx := context.Background()
+	message := func(user, thid, ts, text string) *slackevents.MessageEvent {
+		return &slackevents.MessageEvent{User: user, Channel: "C1", Text: text, TimeStamp: ts, ThreadTimeStamp: thid}
+	}
+	chat := &threadChat{threads: map[string][]*slackevents.MessageEvent{
+		"1.0": {
+			message("U1", "1.0", "1.0", "<@B1> what is go?"),
+			message("B1", "1.0", "1.1", "a language"),
+			message("U1", "1.0", "1.2", "who made it?"),
+		},
+		"2.0": {
+			message("U2", "2.0", "2.0", "the build is broken"),
+			message("U3", "2.0", "2.1", "since this morning"),
+		},
+		"3.0": {
+			message("U2", "", "3.0", "lunch?"),
+		},
+	}}
+	store := memory.NewConversations("B1")
+	c := New(store, chat, &lastQuestionLLM{}, nil, "B1")
+
+	tests := map[string]struct {
+		ev *slackevents.MessageEvent
+		// want is the conversation after the message, empty when it's not stored.
+		want   []string
+		answer string
+	}{
+		"not mentioned after a restart": {
+			ev: message("U1", "1.0", "1.3", "when?"),
+		},
+		"mentioned in the middle": {
+			ev:     message("U1", "2.0", "2.2", "<@B1> why?"),
+			want:   []string{"2.0", "2.1", "2.2"},
+			answer: "answer to why?",
+		},
+		"no mention": {
+			ev: message("U3", "3.0", "3.1", "sure"),
+		},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			chat.texts = nil
+			if err := c.OnMessage(ctx, tt.ev); err != nil {
+				t.Fatal(err)
+			}
+			c.dispatcher.Wait()
+
+			var got []string
+			if cv, err := store.GetConversation(ctx, tt.ev.ThreadTimeStamp); err == nil {
+				for _, m := range cv.GetMessages() {
+					got = append(got, m.GetTimestamp())
+				}
+			}
+			if len(got) != len(tt.want) {
+				t.Fatalf("got %v, want %v", got, tt.want)
+			}
+			for i := range got {
+				if got[i] != tt.want[i] {
+					t.Errorf("got %v, want %v", got, tt.want)
+				}
+			}
+
+			var answer string
+			if len(chat.texts) > 0 {
+				answer = chat.texts[0]
+			}
+			if answer != tt.answer {
+				t.Errorf("got answer %q, want %q", answer, tt.answer)
+			}
+		})
+	}
+
+	// the thread is known after the mention.
+	chat.texts = nil
+	if err := c.OnMessage(ctx, message("U1", "2.0", "2.3", "and how?")); err != nil {
+		t.Fatal(err)
+	}
+	c.dispatcher.Wait()
+	if len(chat.texts) != 1 || chat.texts[0] != "answer to and how?" {
+		t.Errorf("unexpected answers %q", chat.texts)
+	}
+	if chat.fetched != 1 {
+		t.Errorf("only the mention in the unknown thread should be fetched, fetched %d times", chat.fetched)
+	}
+}
@@ -2,24 +2,56 @@ package chatbot
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"github.com/ku/chatbot-slack-llm/internal/completion"
 	"github.com/ku/chatbot-slack-llm/messagestore"
 	"github.com/slack-go/slack"
 	"github.com/slack-go/slack/slackevents"
 	"log"
 	"os/exec"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 )
 
-type ChatBot struct {
-	llm       LLMClient
-	store     messagestore.MessageStore
-	chat      ChatService
-	responder BlockActionResponder
+const (
+	busyMessage             = "I'm busy with other questions right now. Please retry in a moment."
+	completionFailedMessage = "Sorry, I couldn't get an answer from the model. Please try again later."
+	unavailableMessage      = "The model is currently unavailable. Please try again in a few minutes."
+)
 
-	botID   string
-	verbose bool
+// ActionIDRegenerate is the action of the button to answer again without the response cache.
+const ActionIDRegenerate = "regenerate"
+
+type ChatBot struct {
+	llm        LLMClient
+	store      messagestore.MessageStore
+	chat       ChatService
+	responders map[string]BlockActionResponder
+	personas   atomic.Pointer[Personas]
+	dispatcher *Dispatcher
+	limiter    atomic.Pointer[RateLimiter]
+	semantic   SemanticCache
+	pricing    Pricing
+
+	botID  string
+	admins map[string]bool
+
+	tracesMu sync.Mutex
+	traces   map[string]*threadTrace
+	traceSeq uint64
+
+	reloader Reloader
+	// muted and channelModels are set by /chatbot. They are not stored in the messagestore,
+	// so they're lost on restart and not shared between replicas.
+	adminMu       sync.Mutex
+	muted         map[string]bool
+	channelModels map[string]string
+	models        []string
+
+	regenerateOnEdit bool
 
 	llmTimeout      time.Duration
 	responderimeout time.Duration
@@ -29,6 +61,7 @@ type ChatService interface {
 	Name() string
 	PostMessage(ctx context.Context, message messagestore.Message) error
 	PostActionableMessage(ctx context.Context, message messagestore.Message) error
+	PostEphemeralMessage(ctx context.Context, user string, message messagestore.Message) error
 	SetEventListener(listener EventListener)
 	Run(ctx context.Context) error
 }
@@ -38,26 +71,109 @@ type LLMClient interface {
 	Completion(ctx context.Context, cv messagestore.Conversation) (messagestore.CompletionMessage, error)
 }
 
+// ErrLLMUnavailable is returned by LLMClients which know the backend is down, e.g. by a circuit breaker.
+var ErrLLMUnavailable = errors.New("llm is currently unavailable")
+
+// VarsReporter is implemented by the components which have state to show in "debug vars".
+type VarsReporter interface {
+	DebugVars() []string
+}
+
+// Directory is implemented by the ChatServices which can look up the display names for the prompt template.
+type Directory interface {
+	UserName(ctx context.Context, user string) (string, error)
+	ChannelName(ctx context.Context, channel string) (string, error)
+}
+
+// ThreadFetcher is implemented by the ChatServices which can fetch the history of a thread
+// unknown to the MessageStore.
+type ThreadFetcher interface {
+	// FetchThread returns the messages of the thread including the root, oldest first.
+	FetchThread(ctx context.Context, channel, thid string) ([]messagestore.Message, error)
+}
+
 type EventListener interface {
 	OnMessage(ctx context.Context, ev *slackevents.MessageEvent) error
+	// OnMessageChanged and OnMessageDeleted receive the message events of the subtypes.
+	OnMessageChanged(ctx context.Context, ev *slackevents.MessageEvent) error
+	OnMessageDeleted(ctx context.Context, ev *slackevents.MessageEvent) error
 	OnInteractionCallback(ctx context.Context, acbs *slack.InteractionCallback) error
+	// OnSlashCommand returns the text answered only to the user who ran the command.
+	OnSlashCommand(ctx context.Context, cmd *slack.SlashCommand) (string, error)
 }
 
 type BlockActionResponder interface {
 	Handle(ctx context.Context, block string) (string, error)
 }
 
-func New(store messagestore.MessageStore, chat ChatService, llm LLMClient, responder BlockActionResponder, botID string) *ChatBot {
+type Option func(c *ChatBot)
+
+// WithDispatcher replaces the default dispatcher which runs the llm completions.
+func WithDispatcher(d *Dispatcher) Option {
+	return func(c *ChatBot) {
+		c.dispatcher = d
+	}
+}
+
+// WithRateLimit limits the llm usage per user and channel.
+// The counters are kept in the message store.
+func WithRateLimit(conf *RateLimitConfig) Option {
+	return func(c *ChatBot) {
+		c.SetRateLimit(conf)
+	}
+}
+
+// SetRateLimit replaces the limits while the bot is running.
+func (c *ChatBot) SetRateLimit(conf *RateLimitConfig) {
+	counters, ok := c.store.(messagestore.CounterStore)
+	if !ok {
+		log.Printf("rate limit is disabled: messagestore %s doesn't support counters", c.store.Name())
+		return
+	}
+	c.limiter.Store(NewRateLimiter(conf, counters))
+}
+
+// WithPricing replaces DefaultPricing used to report the cost.
+func WithPricing(p Pricing) Option {
+	return func(c *ChatBot) {
+		c.pricing = p
+	}
+}
+
+func New(store messagestore.MessageStore, chat ChatService, llm LLMClient, responder BlockActionResponder, botID string, opts ...Option) *ChatBot {
 	timeout := 60 * time.Second
-	return &ChatBot{
+	c := &ChatBot{
 		llm:             llm,
 		store:           store,
 		chat:            chat,
-		responder:       responder,
+		responders:      map[string]BlockActionResponder{DefaultResponder: responder},
 		botID:           botID,
 		llmTimeout:      timeout,
 		responderimeout: timeout,
+		pricing:         DefaultPricing,
+		models:          DefaultModels,
+		admins:          make(map[string]bool),
+		traces:          make(map[string]*threadTrace),
+		muted:           make(map[string]bool),
+		channelModels:   make(map[string]string),
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	if c.dispatcher == nil {
+		c.dispatcher = NewDispatcher(DefaultDispatcherConfig())
+	}
+	if c.personas.Load() == nil {
+		c.personas.Store(&Personas{
+			Default: &Persona{
+				Name:       "default",
+				LLM:        llm,
+				Responders: []string{DefaultResponder},
+				RunButtons: true,
+			},
+		})
 	}
+	return c
 }
 
 func (c *ChatBot) GetConversation(thid string) messagestore.Conversation {
@@ -71,13 +187,27 @@ func (c *ChatBot) GetConversation(thid string) messagestore.Conversation {
 func (c *ChatBot) OnMessage(ctx context.Context, ev *slackevents.MessageEvent) error {
 	m := messagestore.NewMessageFromMessage(ev)
 
-	_ = c.processDebugMessage(ctx, m)
-
 	// ignore messages from myself
 	if c.botID == m.GetFrom() {
 		return nil
 	}
 
+	if c.isMuted(m.GetChannel()) {
+		return nil
+	}
+
+	if handled, err := c.processDebugMessage(ctx, m); handled {
+		return err
+	}
+
+	if handled, err := c.processThreadCommand(ctx, m); handled {
+		return err
+	}
+
+	if c.needsBackfill(ctx, m) {
+		return c.dispatchBackfill(ctx, m)
+	}
+
 	added, err := c.store.OnMessage(ctx, m)
 	if !added {
 		return err
@@ -92,17 +222,85 @@ func (c *ChatBot) OnMessage(ctx context.Context, ev *slackevents.MessageEvent) e
 		return nil
 	}
 
-	go func() {
-		ctx, _ := context.WithTimeout(context.Background(), c.llmTimeout)
-		if err := c.respondToMessage(ctx, cv, m); err != nil {
+	return c.dispatch(ctx, m, &completion.Options{})
+}
+
+// dispatch queues the reply to the message behind the other replies in the thread.
+func (c *ChatBot) dispatch(ctx context.Context, m messagestore.Message, opts *completion.Options) error {
+	return c.enqueue(ctx, m, func(ctx context.Context) {
+		c.reply(ctx, m, opts)
+	})
+}
+
+// enqueue runs the job with the llm timeout behind the other jobs in the thread of the message.
+func (c *ChatBot) enqueue(ctx context.Context, m messagestore.Message, job func(ctx context.Context)) error {
+	err := c.dispatcher.Dispatch(m.GetThreadID(), func() {
+		ctx, cancel := context.WithTimeout(context.Background(), c.llmTimeout)
+		defer cancel()
+		job(ctx)
+	})
+	if errors.Is(err, ErrQueueFull) {
+		return c.chat.PostMessage(ctx, messagestore.NewMessage(m.GetChannel(), m.GetThreadID(), busyMessage))
+	}
+	return err
+}
+
+// reply answers the message in the dispatcher.
+// The conversation is fetched here so that the replies queued before are included.
+func (c *ChatBot) reply(ctx context.Context, m messagestore.Message, opts *completion.Options) {
+	ctx = completion.WithOptions(ctx, c.requestOptions(ctx, m, opts))
+
+	cv, err := c.store.GetConversation(ctx, m.GetThreadID())
+	if err != nil {
+		log.Println(err.Error())
+		return
+	}
+	if !opts.NoCache {
+		offered, err := c.offerSemanticMatch(ctx, cv, m)
+		if err != nil {
 			log.Println(err.Error())
 		}
-	}()
+		if offered {
+			return
+		}
+	}
+	if err := c.respondToMessage(ctx, cv, m); err != nil {
+		log.Println(err.Error())
+	}
+}
 
-	return nil
+// requestOptions returns a copy of the options with the model set in the thread or the channel, the trace when debug is on,
+// and the names of the user and the channel of the message.
+func (c *ChatBot) requestOptions(ctx context.Context, m messagestore.Message, opts *completion.Options) *completion.Options {
+	o := *opts
+	s := c.threadSettings(ctx, m.GetThreadID())
+	o.Model = s.Model
+	if o.Model == "" {
+		o.Model = c.channelModel(m.GetChannel())
+	}
+	if s.Debug {
+		o.Trace = c.trace(m.GetThreadID())
+	}
+
+	d, ok := c.chat.(Directory)
+	if !ok {
+		return &o
+	}
+	var err error
+	if o.UserName, err = d.UserName(ctx, m.GetFrom()); err != nil {
+		log.Println(err.Error())
+	}
+	if o.ChannelName, err = d.ChannelName(ctx, m.GetChannel()); err != nil {
+		log.Println(err.Error())
+	}
+	return &o
 }
 
-func (c *ChatBot) postReply(ctx context.Context, nm messagestore.Message) error {
+// postReply posts the answer with the Run buttons of the persona.
+func (c *ChatBot) postReply(ctx context.Context, nm *messagestore.SlackMessage) error {
+	if p := c.persona(ctx, nm.GetChannel(), nm.GetThreadID()); p.RunButtons {
+		nm.Responders = p.Responders
+	}
 	return c.chat.PostActionableMessage(ctx, nm)
 }
 
@@ -112,13 +310,31 @@ func (c *ChatBot) OnInteractionCallback(ctx context.Context, cb *slack.Interacti
 	}
 
 	ba := cb.ActionCallback.BlockActions[0]
+	switch ba.ActionID {
+	case ActionIDRegenerate, ActionIDAskModel:
+		return c.regenerate(ctx, ba.Value)
+	case ActionIDUseCachedAnswer:
+		return c.useSemanticMatch(ctx, cb.Channel.ID, cb.Message.Msg.ThreadTimestamp, ba.Value)
+	}
+
+	// the buttons posted before responders were named run the default one.
+	name := DefaultResponder
+	if strings.HasPrefix(ba.ActionID, messagestore.ActionIDRunPrefix) {
+		name = strings.TrimPrefix(ba.ActionID, messagestore.ActionIDRunPrefix)
+	}
+	responder, ok := c.responders[name]
+	if !ok || !c.persona(ctx, cb.Channel.ID, cb.Message.Msg.ThreadTimestamp).allows(name) {
+		return fmt.Errorf("responder %s is not allowed in %s", name, cb.Channel.ID)
+	}
+
 	var exitStatus string
 	script := ba.Value
 
 	go func() {
-		ctx, _ := context.WithTimeout(context.Background(), c.responderimeout)
+		ctx, cancel := context.WithTimeout(context.Background(), c.responderimeout)
+		defer cancel()
 
-		output, err := c.responder.Handle(ctx, script)
+		output, err := responder.Handle(ctx, script)
 		// report the result
 		if err != nil {
 			ee, ok := err.(*exec.ExitError)
@@ -142,18 +358,47 @@ func (c *ChatBot) OnInteractionCallback(ctx context.Context, cb *slack.Interacti
 	return nil
 }
 
-func (c *ChatBot) processDebugMessage(ctx context.Context, m messagestore.Message) error {
-	if !strings.HasPrefix(m.GetText(), "debug ") {
-		return nil
+// regenerate answers the last question in the thread again without the response cache.
+func (c *ChatBot) regenerate(ctx context.Context, thid string) error {
+	cv, err := c.store.GetConversation(ctx, thid)
+	if err != nil {
+		return err
+	}
+
+	msgs := cv.GetMessages()
+	for i := len(msgs) - 1; i >= 0; i-- {
+		if cv.IsFromInitiater(msgs[i]) {
+			return c.dispatch(ctx, msgs[i], &completion.Options{NoCache: true})
+		}
+	}
+	return nil
+}
+
+// processDebugMessage runs the debug command mentioning the bot. The command isn't added to the conversation.
+func (c *ChatBot) processDebugMessage(ctx context.Context, m messagestore.Message) (bool, error) {
+	if !m.IsMentionAt(c.botID) || !strings.HasPrefix(m.GetText(), "debug ") {
+		return false, nil
+	}
+	return true, c.runDebugCommand(ctx, m)
+}
+
+func (c *ChatBot) runDebugCommand(ctx context.Context, m messagestore.Message) error {
+	if !c.isAdmin(m.GetFrom()) {
+		return c.chat.PostEphemeralMessage(ctx, m.GetFrom(), messagestore.NewMessage(m.GetChannel(), m.GetThreadID(), notAdminMessage))
 	}
 
 	if m.GetText() == "debug vars" {
+		p := c.persona(ctx, m.GetChannel(), m.GetThreadID())
 		vars := []string{
 			"mode: " + c.chat.Name(),
 			"messagestorage: " + c.store.Name(),
-			"llm: " + c.llm.Name(),
+			"persona: " + p.Name,
+			"llm: " + p.LLM.Name(),
 			"botID: " + c.botID,
 		}
+		if vr, ok := p.LLM.(VarsReporter); ok {
+			vars = append(vars, vr.DebugVars()...)
+		}
 
 		if err := c.chat.PostActionableMessage(ctx, messagestore.NewMessage(
 			m.GetChannel(),
@@ -166,19 +411,37 @@ func (c *ChatBot) processDebugMessage(ctx context.Context, m messagestore.Messag
 		return nil
 	}
 
+	if m.GetText() == "debug usage" {
+		s, err := c.threadUsage(ctx, m.GetThreadID())
+		if err != nil {
+			return err
+		}
+		return c.chat.PostMessage(ctx, messagestore.NewMessage(
+			m.GetChannel(),
+			m.GetThreadID(),
+			"^DEBUG\n"+s,
+		))
+	}
+
+	if m.GetText() == "debug prompt" || m.GetText() == "debug raw" {
+		return c.postTrace(ctx, m)
+	}
+
 	if m.GetText() == "debug off" {
-		c.verbose = false
-		return nil
+		return c.setDebug(ctx, m.GetThreadID(), false)
 	}
 
 	if m.GetText() == "debug on" {
-		c.verbose = true
+		if err := c.setDebug(ctx, m.GetThreadID(), true); err != nil {
+			return err
+		}
 	}
 
-	if c.verbose {
+	if c.threadSettings(ctx, m.GetThreadID()).Debug {
 		cv, err := c.store.GetConversation(ctx, m.GetThreadID())
 		if err != nil {
-			return err
+			// the conversation starts with the next question.
+			return nil
 		}
 
 		s := cv.String()
@@ -194,19 +457,52 @@ func (c *ChatBot) processDebugMessage(ctx context.Context, m messagestore.Messag
 }
 
 func (c *ChatBot) respondToMessage(ctx context.Context, cv messagestore.Conversation, m messagestore.Message) error {
-	resp, err := c.llm.Completion(ctx, cv)
+	if limiter := c.limiter.Load(); limiter != nil {
+		err := limiter.Allow(ctx, m)
+		var te *ThrottledError
+		if errors.As(err, &te) {
+			return c.chat.PostEphemeralMessage(ctx, m.GetFrom(), messagestore.NewMessage(m.GetChannel(), m.GetThreadID(), throttledMessage(te)))
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	p := c.persona(ctx, m.GetChannel(), m.GetThreadID())
+	resp, err := p.LLM.Completion(ctx, cv)
 	if err != nil {
+		text := completionFailedMessage
+		if errors.Is(err, ErrLLMUnavailable) {
+			text = unavailableMessage
+		}
+		if perr := c.chat.PostMessage(ctx, messagestore.NewMessage(m.GetChannel(), m.GetThreadID(), text)); perr != nil {
+			log.Println(perr.Error())
+		}
 		return fmt.Errorf("llm completion failed: %w", err)
 	}
+
+	if err := c.recordUsage(ctx, m, resp.GetUsage()); err != nil {
+		log.Println(err.Error())
+	}
 	nm := messagestore.NewMessageFromCompletionMessage(m.GetChannel(), m.GetThreadID(), resp)
+	if nm.Cached {
+		nm.Actions = append(nm.Actions, regenerateAction(m.GetThreadID()))
+	}
 
 	if err := c.postReply(ctx, nm); err != nil {
 		return err
 	}
 
+	if !nm.Cached {
+		c.storeSemanticAnswer(ctx, cv, m, nm.GetText())
+	}
 	return nil
 }
 
+func regenerateAction(thid string) messagestore.Action {
+	return messagestore.Action{ID: ActionIDRegenerate, Text: "Regenerate", Value: thid}
+}
+
 func (c *ChatBot) shouldIgnore(cv messagestore.Conversation, nm messagestore.Message) bool {
 	msgs := cv.GetMessages()
 	if len(msgs) == 0 {
@@ -217,15 +513,27 @@ func (c *ChatBot) shouldIgnore(cv messagestore.Conversation, nm messagestore.Mes
 		return true
 	}
 
-	firstMsg := msgs[0]
+	// the conversation is started by the first mention, which follows the backfilled messages
+	// when the bot is mentioned in the middle of a thread.
+	var firstMsg messagestore.Message
+	for _, m := range msgs {
+		if m.IsMentionAt(c.botID) {
+			firstMsg = m
+			break
+		}
+	}
+	if firstMsg == nil {
+		return true
+	}
+
 	// if it's a mention and the first message
 	if nm.IsMentionAt(c.botID) {
-		if len(msgs) == 1 && firstMsg.GetTimestamp() == nm.GetTimestamp() {
+		if msgs[len(msgs)-1].GetTimestamp() == nm.GetTimestamp() && firstMsg.GetTimestamp() == nm.GetTimestamp() {
 			return false
 		}
 	} else {
 		// not a mention but a message in a thread which started by a mention
-		if firstMsg.IsMentionAt(c.botID) && firstMsg.GetFrom() == nm.GetFrom() {
+		if firstMsg.GetFrom() == nm.GetFrom() {
 			return false
 		}
 	}
@@ -0,0 +1,156 @@
+package chatbot
+
+import (
+	"context"
+	"fmt"
+	"github.com/ku/chatbot-slack-llm/messagestore"
+	"log"
+	"sort"
+	"strings"
+)
+
+// threadCommand is a directive to the bot in a thread, e.g. "@bot use gpt-4".
+type threadCommand struct {
+	name string
+	arg  string
+}
+
+// resetArg clears the override of the command.
+const resetArg = "default"
+
+// DefaultModels are the models which can be chosen in a thread or a channel.
+var DefaultModels = []string{"gpt-3.5-turbo", "gpt-3.5-turbo-16k", "gpt-4", "gpt-4-32k"}
+
+// WithModels replaces DefaultModels. A model without a price in the Pricing can be chosen, and costs nothing in the reports.
+func WithModels(models ...string) Option {
+	return func(c *ChatBot) {
+		c.SetModels(models)
+	}
+}
+
+// SetModels replaces the models while the bot is running. Empty is DefaultModels.
+// The models already chosen are kept.
+func (c *ChatBot) SetModels(models []string) {
+	if len(models) == 0 {
+		models = DefaultModels
+	}
+	sorted := append([]string(nil), models...)
+	sort.Strings(sorted)
+
+	c.adminMu.Lock()
+	defer c.adminMu.Unlock()
+	c.models = sorted
+}
+
+// modelList returns the models, which are replaced but never modified.
+func (c *ChatBot) modelList() []string {
+	c.adminMu.Lock()
+	defer c.adminMu.Unlock()
+	return c.models
+}
+
+func hasModel(models []string, model string) bool {
+	for _, m := range models {
+		if m == model {
+			return true
+		}
+	}
+	return false
+}
+
+// parseThreadCommand recognizes "use <model>" and "persona <name>".
+func parseThreadCommand(text string) (*threadCommand, bool) {
+	fields := strings.Fields(text)
+	if len(fields) != 2 {
+		return nil, false
+	}
+	switch name := strings.ToLower(fields[0]); name {
+	case "use", "persona":
+		return &threadCommand{name: name, arg: fields[1]}, true
+	}
+	return nil, false
+}
+
+// processThreadCommand stores the override of the command mentioning the bot and confirms it in the thread.
+// Only the initiator of the thread and the admins can override. The command isn't added to the conversation.
+func (c *ChatBot) processThreadCommand(ctx context.Context, m messagestore.Message) (bool, error) {
+	if !m.IsMentionAt(c.botID) {
+		return false, nil
+	}
+	cmd, ok := parseThreadCommand(m.GetText())
+	if !ok {
+		return false, nil
+	}
+
+	reply := func(text string) error {
+		return c.chat.PostMessage(ctx, messagestore.NewMessage(m.GetChannel(), m.GetThreadID(), text))
+	}
+
+	if !c.canOverride(ctx, m) {
+		return true, c.chat.PostEphemeralMessage(ctx, m.GetFrom(), messagestore.NewMessage(m.GetChannel(), m.GetThreadID(),
+			"Only the user who started the thread and the admins can change the model or the persona."))
+	}
+
+	ss, ok := c.store.(messagestore.SettingStore)
+	if !ok {
+		return true, reply(fmt.Sprintf("Thread settings are not supported by messagestore %s.", c.store.Name()))
+	}
+	s, err := ss.GetThreadSettings(ctx, m.GetThreadID())
+	if err != nil {
+		return true, err
+	}
+
+	var confirmation string
+	switch {
+	case cmd.name == "use" && cmd.arg == resetArg:
+		s.Model = ""
+		confirmation = "OK, I'll answer with the default model in this thread."
+	case cmd.name == "use":
+		if models := c.modelList(); !hasModel(models, cmd.arg) {
+			return true, reply(fmt.Sprintf("Unknown model %s. Available: %s", cmd.arg, strings.Join(models, ", ")))
+		}
+		s.Model = cmd.arg
+		confirmation = fmt.Sprintf("OK, I'll answer with %s in this thread.", cmd.arg)
+	case cmd.name == "persona" && cmd.arg == resetArg:
+		s.Persona = ""
+		confirmation = fmt.Sprintf("OK, I'm %s again in this thread.", c.personas.Load().ForChannel(m.GetChannel()).Name)
+	case cmd.name == "persona":
+		if _, known := c.personas.Load().Named[cmd.arg]; !known {
+			return true, reply(fmt.Sprintf("Unknown persona %s. Available: %s", cmd.arg, strings.Join(c.personas.Load().names(), ", ")))
+		}
+		s.Persona = cmd.arg
+		confirmation = fmt.Sprintf("OK, I'm %s in this thread.", cmd.arg)
+	}
+
+	if err := ss.PutThreadSettings(ctx, m.GetThreadID(), s); err != nil {
+		return true, err
+	}
+	return true, reply(confirmation)
+}
+
+// canOverride tells if the sender of the command is an admin or the initiator of the thread.
+// The sender of the root of a new thread becomes the initiator.
+func (c *ChatBot) canOverride(ctx context.Context, m messagestore.Message) bool {
+	if c.isAdmin(m.GetFrom()) {
+		return true
+	}
+	cv, err := c.store.GetConversation(ctx, m.GetThreadID())
+	if err != nil {
+		return m.GetTimestamp() == m.GetThreadID()
+	}
+	return cv.IsFromInitiater(m)
+}
+
+// threadSettings returns the zero settings when the store doesn't support them.
+func (c *ChatBot) threadSettings(ctx context.Context, thid string) *messagestore.ThreadSettings {
+	ss, ok := c.store.(messagestore.SettingStore)
+	if !ok {
+		return &messagestore.ThreadSettings{}
+	}
+	s, err := ss.GetThreadSettings(ctx, thid)
+	if err != nil {
+		log.Printf("failed to get thread settings: %s", err.Error())
+		return &messagestore.ThreadSettings{}
+	}
+	return s
+}
@@ -0,0 +1,138 @@
+package chatbot
+
+import (
+	"context"
+	"github.com/ku/chatbot-slack-llm/internal/conversation/memory"
+	"github.com/ku/chatbot-slack-llm/messagestore"
+	"github.com/slack-go/slack/slackevents"
+	"reflect"
+	"testing"
+)
+
+func TestParseThreadCommand(t *testing.T) {
+	tests := map[string]struct {
+		text string
+		want *threadCommand
+	}{
+		"use":      {text: " use gpt-4", want: &threadCommand{name: "use", arg: "gpt-4"}},
+		"persona":  {text: "Persona sql-helper ", want: &threadCommand{name: "persona", arg: "sql-helper"}},
+		"question": {text: "how do I use awk?", want: nil},
+		"no arg":   {text: "use", want: nil},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			got, _ := parseThreadCommand(tt.text)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+type chatRecorder struct {
+	ChatService
+	texts []string
+}
+
+func (c *chatRecorder) PostMessage(_ context.Context, m messagestore.Message) error {
+	c.texts = append(c.texts, m.GetText())
+	return nil
+}
+
+func (c *chatRecorder) PostActionableMessage(ctx context.Context, m messagestore.Message) error {
+	return c.PostMessage(ctx, m)
+}
+
+func (c *chatRecorder) PostEphemeralMessage(ctx context.Context, _ string, m messagestore.Message) error {
+	return c.PostMessage(ctx, m)
+}
+
+func TestChatBot_processThreadCommand(t *testing.T) {
+	ctx := context.Background()
+	store := memory.NewConversations("B1")
+	chat := &chatRecorder{}
+	sql := &Persona{Name: "sql-helper"}
+	c := New(store, chat, nil, nil, "B1", WithPersonas(&Personas{
+		Default: &Persona{Name: "ops"},
+		Named:   map[string]*Persona{"sql-helper": sql},
+	}), WithModels("gpt-4", "llama-2-70b"))
+
+	message := func(user, text string) messagestore.Message {
+		return messagestore.NewMessageFromMessage(&slackevents.MessageEvent{
+			User:            user,
+			Channel:         "C1",
+			Text:            "<@B1> " + text,
+			TimeStamp:       "2.0",
+			ThreadTimeStamp: "1.0",
+		})
+	}
+	if _, err := store.OnMessage(ctx, messagestore.NewMessageFromMessage(&slackevents.MessageEvent{
+		User: "U1", Channel: "C1", Text: "<@B1> hi", TimeStamp: "1.0",
+	})); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, m := range []messagestore.Message{
+		message("U1", "use llama-2-70b"),
+		message("U1", "use gpt-4"),
+		message("U1", "persona sql-helper"),
+		message("U1", "use gpt-4-32k"),
+		message("U1", "how do I grep?"),
+		message("U2", "use llama-2-70b"),
+	} {
+		if _, err := c.processThreadCommand(ctx, m); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	want := []string{
+		// allowed without a price.
+		"OK, I'll answer with llama-2-70b in this thread.",
+		"OK, I'll answer with gpt-4 in this thread.",
+		"OK, I'm sql-helper in this thread.",
+		// priced but not allowed.
+		"Unknown model gpt-4-32k. Available: gpt-4, llama-2-70b",
+		// not the initiator.
+		"Only the user who started the thread and the admins can change the model or the persona.",
+	}
+	if !reflect.DeepEqual(chat.texts, want) {
+		t.Errorf("got %q, want %q", chat.texts, want)
+	}
+
+	s := c.threadSettings(ctx, "1.0")
+	if s.Model != "gpt-4" || s.Persona != "sql-helper" {
+		t.Errorf("unexpected settings: %+v", s)
+	}
+	if p := c.persona(ctx, "C1", "1.0"); p.Name != sql.Name {
+		t.Errorf("got persona %s", p.Name)
+	}
+	if p := c.persona(ctx, "C1", "3.0"); p.Name != "ops" {
+		t.Errorf("other threads should keep the default persona, got %s", p.Name)
+	}
+}
+
+func TestChatBot_personaOverrideWithinChannel(t *testing.T) {
+	ctx := context.Background()
+	store := memory.NewConversations("B1")
+	ops := &Persona{Name: "ops", Responders: []string{"bash"}, RunButtons: true}
+	sql := &Persona{Name: "sql-helper"}
+	c := New(store, &chatRecorder{}, nil, nil, "B1", WithPersonas(&Personas{
+		Default:  ops,
+		Channels: map[string]*Persona{"C1": sql},
+		Named:    map[string]*Persona{"ops": ops, "sql-helper": sql},
+	}))
+	if err := store.PutThreadSettings(ctx, "1.0", &messagestore.ThreadSettings{Persona: "ops"}); err != nil {
+		t.Fatal(err)
+	}
+
+	p := c.persona(ctx, "C1", "1.0")
+	if p.Name != "ops" || p.allows("bash") || p.RunButtons {
+		t.Errorf("the override must not run more than the channel's persona: %+v", p)
+	}
+	if p := c.persona(ctx, "C2", "1.0"); !p.allows("bash") || !p.RunButtons {
+		t.Errorf("the override should keep what the channel allows: %+v", p)
+	}
+	if !ops.RunButtons || len(ops.Responders) != 1 {
+		t.Errorf("the named persona must not be changed: %+v", ops)
+	}
+}
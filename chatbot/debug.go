@@ -0,0 +1,103 @@
+package chatbot
+
+import (
+	"context"
+	"github.com/ku/chatbot-slack-llm/internal/completion"
+	"github.com/ku/chatbot-slack-llm/messagestore"
+	"log"
+)
+
+const notAdminMessage = "Debug and admin commands are only for the admins of the bot."
+
+// maxTraces bounds the traces kept in memory. The least recently used one is dropped first.
+const maxTraces = 100
+
+// threadTrace is the trace of a thread with debug on.
+type threadTrace struct {
+	*completion.Trace
+	// used is the order of the last use.
+	used uint64
+}
+
+// WithAdmins allows the users to run the debug commands and the admin slash commands.
+func WithAdmins(users ...string) Option {
+	return func(c *ChatBot) {
+		for _, u := range users {
+			c.admins[u] = true
+		}
+	}
+}
+
+func (c *ChatBot) isAdmin(user string) bool {
+	return c.admins[user]
+}
+
+// setDebug turns debug on or off in the thread. The trace of the thread is dropped when it's off.
+func (c *ChatBot) setDebug(ctx context.Context, thid string, on bool) error {
+	ss, ok := c.store.(messagestore.SettingStore)
+	if !ok {
+		log.Printf("debug is unavailable: messagestore %s doesn't support thread settings", c.store.Name())
+		return nil
+	}
+	s, err := ss.GetThreadSettings(ctx, thid)
+	if err != nil {
+		return err
+	}
+	s.Debug = on
+	if err := ss.PutThreadSettings(ctx, thid, s); err != nil {
+		return err
+	}
+
+	if !on {
+		c.tracesMu.Lock()
+		delete(c.traces, thid)
+		c.tracesMu.Unlock()
+	}
+	return nil
+}
+
+// trace returns the trace which keeps the last request in the thread.
+func (c *ChatBot) trace(thid string) *completion.Trace {
+	c.tracesMu.Lock()
+	defer c.tracesMu.Unlock()
+
+	t, ok := c.traces[thid]
+	if !ok {
+		if len(c.traces) >= maxTraces {
+			var oldest string
+			for k, v := range c.traces {
+				if oldest == "" || v.used < c.traces[oldest].used {
+					oldest = k
+				}
+			}
+			delete(c.traces, oldest)
+		}
+		t = &threadTrace{Trace: &completion.Trace{}}
+		c.traces[thid] = t
+	}
+	c.traceSeq++
+	t.used = c.traceSeq
+	return t.Trace
+}
+
+// postTrace shows the last request sent to the llm for "debug prompt", or its raw response for "debug raw".
+func (c *ChatBot) postTrace(ctx context.Context, m messagestore.Message) error {
+	c.tracesMu.Lock()
+	t, ok := c.traces[m.GetThreadID()]
+	c.tracesMu.Unlock()
+
+	text := "No request is recorded in this thread. Send `debug on` before asking."
+	if ok {
+		request, response := t.Get()
+		if m.GetText() == "debug raw" {
+			text = response
+		} else {
+			text = request
+		}
+	}
+	return c.chat.PostMessage(ctx, messagestore.NewMessage(
+		m.GetChannel(),
+		m.GetThreadID(),
+		"^DEBUG\n```"+text+"```",
+	))
+}
@@ -0,0 +1,113 @@
+package chatbot
+
+import (
+	"context"
+	"github.com/ku/chatbot-slack-llm/internal/completion"
+	"github.com/ku/chatbot-slack-llm/internal/conversation/memory"
+	"github.com/ku/chatbot-slack-llm/messagestore"
+	"github.com/slack-go/slack/slackevents"
+	"reflect"
+	"strconv"
+	"testing"
+)
+
+type tracingLLM struct{}
+
+func (l *tracingLLM) Name() string { return "tracing" }
+
+func (l *tracingLLM) Completion(ctx context.Context, cv messagestore.Conversation) (messagestore.CompletionMessage, error) {
+	if trace := completion.OptionsFrom(ctx).Trace; trace != nil {
+		trace.Record("request of "+cv.GetMessages()[0].GetText(), "raw")
+	}
+	return nil, nil
+}
+
+func TestChatBot_processDebugMessage(t *testing.T) {
+	ctx := context.Background()
+	store := memory.NewConversations("B1")
+	chat := &chatRecorder{}
+	c := New(store, chat, &tracingLLM{}, nil, "B1", WithAdmins("U1"))
+
+	message := func(user, thid, text string) messagestore.Message {
+		return messagestore.NewMessageFromMessage(&slackevents.MessageEvent{
+			User:            user,
+			Channel:         "C1",
+			Text:            text,
+			TimeStamp:       thid,
+			ThreadTimeStamp: thid,
+		})
+	}
+	complete := func(thid string) {
+		m := message("U1", thid, "question")
+		ctx := completion.WithOptions(ctx, c.requestOptions(ctx, m, &completion.Options{}))
+		cv, _ := store.GetConversation(ctx, thid)
+		if _, err := c.persona(ctx, "C1", thid).LLM.Completion(ctx, cv); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, thid := range []string{"1.0", "2.0"} {
+		if _, err := store.OnMessage(ctx, message("U1", thid, "<@B1> question in "+thid)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if _, err := c.processDebugMessage(ctx, message("U2", "1.0", "<@B1> debug on")); err != nil {
+		t.Fatal(err)
+	}
+	if c.threadSettings(ctx, "1.0").Debug {
+		t.Error("non-admins shouldn't turn debug on")
+	}
+
+	if _, err := c.processDebugMessage(ctx, message("U1", "1.0", "<@B1> debug on")); err != nil {
+		t.Fatal(err)
+	}
+	// without a mention, it's a message to the others in the thread.
+	if handled, _ := c.processDebugMessage(ctx, message("U1", "2.0", "debug on")); handled {
+		t.Error("debug commands should mention the bot")
+	}
+	if !c.threadSettings(ctx, "1.0").Debug || c.threadSettings(ctx, "2.0").Debug {
+		t.Error("debug should be on only in the thread")
+	}
+
+	complete("1.0")
+	complete("2.0")
+	chat.texts = nil
+	for _, text := range []string{"debug prompt", "debug raw"} {
+		if _, err := c.processDebugMessage(ctx, message("U1", "1.0", "<@B1> "+text)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := c.processDebugMessage(ctx, message("U1", "2.0", "<@B1> debug prompt")); err != nil {
+		t.Fatal(err)
+	}
+
+	want := []string{
+		"^DEBUG\n```request of question in 1.0```",
+		"^DEBUG\n```raw```",
+		"^DEBUG\n```No request is recorded in this thread. Send `debug on` before asking.```",
+	}
+	if !reflect.DeepEqual(chat.texts, want) {
+		t.Errorf("got %q, want %q", chat.texts, want)
+	}
+}
+
+func TestChatBot_trace(t *testing.T) {
+	c := New(memory.NewConversations("B1"), &chatRecorder{}, nil, nil, "B1")
+	first := c.trace("0")
+	for i := 1; i <= maxTraces; i++ {
+		c.trace(strconv.Itoa(i))
+		// the first thread is used again and kept.
+		if i == maxTraces/2 {
+			c.trace("0")
+		}
+	}
+	if len(c.traces) != maxTraces {
+		t.Errorf("got %d traces, want %d", len(c.traces), maxTraces)
+	}
+	if c.trace("0") != first {
+		t.Error("the recently used trace shouldn't be dropped")
+	}
+	if _, ok := c.traces["1"]; ok {
+		t.Error("the least recently used trace should be dropped")
+	}
+}
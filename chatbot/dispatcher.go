@@ -0,0 +1,117 @@
+package chatbot
+
+import (
+	"errors"
+	"sync"
+	"time"
+)
+
+// ErrQueueFull is returned by Dispatch when the job can't be queued.
+var ErrQueueFull = errors.New("dispatcher queue is full")
+
+type DispatcherConfig struct {
+	// MaxConcurrency is the number of jobs running at the same time across all threads.
+	MaxConcurrency int
+	// MaxQueueDepth is the number of jobs waiting in a single thread.
+	MaxQueueDepth int
+	// MaxPending is the number of jobs waiting across all threads.
+	MaxPending int
+}
+
+func DefaultDispatcherConfig() *DispatcherConfig {
+	return &DispatcherConfig{
+		MaxConcurrency: 4,
+		MaxQueueDepth:  3,
+		MaxPending:     64,
+	}
+}
+
+// Dispatcher runs jobs in FIFO order per key (thread) while limiting the total concurrency.
+type Dispatcher struct {
+	conf *DispatcherConfig
+	sem  chan struct{}
+
+	mu      sync.Mutex
+	queues  map[string][]*job
+	pending int
+	wg      sync.WaitGroup
+}
+
+type job struct {
+	f          func()
+	enqueuedAt time.Time
+}
+
+func NewDispatcher(conf *DispatcherConfig) *Dispatcher {
+	if conf.MaxConcurrency < 1 {
+		conf.MaxConcurrency = 1
+	}
+	return &Dispatcher{
+		conf:   conf,
+		sem:    make(chan struct{}, conf.MaxConcurrency),
+		queues: make(map[string][]*job),
+	}
+}
+
+// Dispatch queues f behind the other jobs of the same key.
+// It returns ErrQueueFull if either the queue of the key or the dispatcher is full.
+func (d *Dispatcher) Dispatch(key string, f func()) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	q, running := d.queues[key]
+	if (d.conf.MaxQueueDepth > 0 && len(q) >= d.conf.MaxQueueDepth) ||
+		(d.conf.MaxPending > 0 && d.pending >= d.conf.MaxPending) {
+		metrics.Add("dispatcher.rejected", 1)
+		return ErrQueueFull
+	}
+
+	d.queues[key] = append(q, &job{f: f, enqueuedAt: time.Now()})
+	d.pending++
+	metrics.Add("dispatcher.pending", 1)
+
+	if !running {
+		d.wg.Add(1)
+		go d.drain(key)
+	}
+	return nil
+}
+
+// Wait blocks until all queued jobs are done.
+func (d *Dispatcher) Wait() {
+	d.wg.Wait()
+}
+
+// Pending returns the number of jobs waiting across all threads.
+func (d *Dispatcher) Pending() int {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.pending
+}
+
+func (d *Dispatcher) drain(key string) {
+	defer d.wg.Done()
+	for {
+		d.sem <- struct{}{}
+
+		d.mu.Lock()
+		q := d.queues[key]
+		if len(q) == 0 {
+			// the presence of the key tells Dispatch a worker is running.
+			delete(d.queues, key)
+			d.mu.Unlock()
+			<-d.sem
+			return
+		}
+		j := q[0]
+		d.queues[key] = q[1:]
+		d.pending--
+		d.mu.Unlock()
+
+		metrics.Add("dispatcher.pending", -1)
+		queueWait.Observe(time.Since(j.enqueuedAt))
+
+		j.f()
+		<-d.sem
+	}
+}
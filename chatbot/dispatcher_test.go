@@ -0,0 +1,90 @@
+package chatbot
+
+import (
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestDispatcher_OrderPerKey(t *testing.T) {
+	d := NewDispatcher(&DispatcherConfig{MaxConcurrency: 4, MaxQueueDepth: 100})
+
+	var mu sync.Mutex
+	got := map[string][]int{}
+	for i := 0; i < 20; i++ {
+		for _, key := range []string{"a", "b"} {
+			i, key := i, key
+			if err := d.Dispatch(key, func() {
+				time.Sleep(time.Millisecond)
+				mu.Lock()
+				got[key] = append(got[key], i)
+				mu.Unlock()
+			}); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	d.Wait()
+
+	for key, seq := range got {
+		for i, n := range seq {
+			if i != n {
+				t.Fatalf("%s: jobs ran out of order: %v", key, seq)
+			}
+		}
+	}
+}
+
+func TestDispatcher_MaxConcurrency(t *testing.T) {
+	d := NewDispatcher(&DispatcherConfig{MaxConcurrency: 2})
+
+	var running, peak int32
+	for i := 0; i < 10; i++ {
+		key := string(rune('a' + i))
+		_ = d.Dispatch(key, func() {
+			n := atomic.AddInt32(&running, 1)
+			for {
+				p := atomic.LoadInt32(&peak)
+				if n <= p || atomic.CompareAndSwapInt32(&peak, p, n) {
+					break
+				}
+			}
+			time.Sleep(5 * time.Millisecond)
+			atomic.AddInt32(&running, -1)
+		})
+	}
+	d.Wait()
+
+	if peak > 2 {
+		t.Fatalf("expected at most 2 jobs at the same time, got %d", peak)
+	}
+}
+
+func TestDispatcher_QueueFull(t *testing.T) {
+	d := NewDispatcher(&DispatcherConfig{MaxConcurrency: 1, MaxQueueDepth: 1})
+
+	block := make(chan struct{})
+	started := make(chan struct{})
+	if err := d.Dispatch("a", func() {
+		close(started)
+		<-block
+	}); err != nil {
+		t.Fatal(err)
+	}
+	<-started
+
+	if err := d.Dispatch("a", func() {}); err != nil {
+		t.Fatalf("second job should be queued: %s", err)
+	}
+	if err := d.Dispatch("a", func() {}); !errors.Is(err, ErrQueueFull) {
+		t.Fatalf("expected ErrQueueFull, got %v", err)
+	}
+	if err := d.Dispatch("b", func() {}); err != nil {
+		t.Fatalf("other threads should not be affected: %s", err)
+	}
+
+	close(block)
+	d.Wait()
+}
@@ -0,0 +1,100 @@
+package chatbot
+
+import (
+	"context"
+	"github.com/ku/chatbot-slack-llm/internal/completion"
+	"github.com/ku/chatbot-slack-llm/messagestore"
+	"github.com/slack-go/slack/slackevents"
+	"time"
+)
+
+// subTypeTombstone replaces a deleted message which has replies.
+const subTypeTombstone = "tombstone"
+
+// WithRegenerateOnEdit answers again when the question the bot answered last is edited.
+func WithRegenerateOnEdit() Option {
+	return func(c *ChatBot) {
+		c.regenerateOnEdit = true
+	}
+}
+
+// changedMessage returns the inner message of a message_changed or message_deleted event,
+// which doesn't have the channel.
+func changedMessage(ev *slackevents.MessageEvent, inner *slackevents.MessageEvent) *messagestore.SlackMessage {
+	m := *inner
+	m.Channel = ev.Channel
+	return messagestore.NewMessageFromMessage(&m)
+}
+
+// editedAt returns the time of the edit told by Slack, or now when the event doesn't tell it.
+func editedAt(inner *slackevents.MessageEvent, now time.Time) time.Time {
+	if inner.Edited == nil {
+		return now
+	}
+	t := (&messagestore.SlackMessage{TS: inner.Edited.TimeStamp}).GetCreatedAt()
+	if t.IsZero() {
+		return now
+	}
+	return t
+}
+
+// OnMessageChanged follows the edit of a message in the conversation.
+func (c *ChatBot) OnMessageChanged(ctx context.Context, ev *slackevents.MessageEvent) error {
+	if ev.Message == nil || c.isMuted(ev.Channel) {
+		return nil
+	}
+	if ev.Message.SubType == subTypeTombstone {
+		// the message is deleted but the thread is kept.
+		return c.deleteMessage(ctx, changedMessage(ev, ev.Message))
+	}
+
+	m := changedMessage(ev, ev.Message)
+	if c.botID == m.GetFrom() {
+		return nil
+	}
+	editor, ok := c.store.(messagestore.MessageEditor)
+	if !ok {
+		return nil
+	}
+	edited, err := editor.EditMessage(ctx, m, editedAt(ev.Message, time.Now()))
+	if !edited || !c.regenerateOnEdit {
+		return err
+	}
+
+	cv, err := c.store.GetConversation(ctx, m.GetThreadID())
+	if err != nil {
+		return err
+	}
+	if c.shouldIgnore(cv, m) || !isLastQuestion(cv, m) {
+		return nil
+	}
+	return c.dispatch(ctx, m, &completion.Options{NoCache: true})
+}
+
+// OnMessageDeleted removes the message from the conversation.
+func (c *ChatBot) OnMessageDeleted(ctx context.Context, ev *slackevents.MessageEvent) error {
+	if ev.PreviousMessage == nil || c.isMuted(ev.Channel) {
+		return nil
+	}
+	return c.deleteMessage(ctx, changedMessage(ev, ev.PreviousMessage))
+}
+
+func (c *ChatBot) deleteMessage(ctx context.Context, m messagestore.Message) error {
+	editor, ok := c.store.(messagestore.MessageEditor)
+	if !ok {
+		return nil
+	}
+	_, err := editor.DeleteMessage(ctx, m)
+	return err
+}
+
+// isLastQuestion tells whether m is the last message from the initiator.
+func isLastQuestion(cv messagestore.Conversation, m messagestore.Message) bool {
+	msgs := cv.GetMessages()
+	for i := len(msgs) - 1; i >= 0; i-- {
+		if cv.IsFromInitiater(msgs[i]) {
+			return msgs[i].GetTimestamp() == m.GetTimestamp()
+		}
+	}
+	return false
+}
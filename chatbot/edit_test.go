@@ -0,0 +1,89 @@
+package chatbot
+
+import (
+	"context"
+	"github.com/ku/chatbot-slack-llm/internal/conversation/memory"
+	"github.com/ku/chatbot-slack-llm/messagestore"
+	"github.com/slack-go/slack"
+	"github.com/slack-go/slack/slackevents"
+	"testing"
+	"time"
+)
+
+type answer string
+
+func (a answer) GetText() string              { return string(a) }
+func (a answer) GetUsage() messagestore.Usage { return messagestore.Usage{} }
+
+// lastQuestionLLM answers with the last message of the conversation.
+type lastQuestionLLM struct{}
+
+func (l *lastQuestionLLM) Name() string { return "last-question" }
+
+func (l *lastQuestionLLM) Completion(_ context.Context, cv messagestore.Conversation) (messagestore.CompletionMessage, error) {
+	msgs := cv.GetMessages()
+	return answer("answer to " + msgs[len(msgs)-1].GetText()), nil
+}
+
+func TestChatBot_OnMessageChanged(t *testing.T) {
+	ctx := context.Background()
+	store := memory.NewConversations("B1")
+	chat := &chatRecorder{}
+	c := New(store, chat, &lastQuestionLLM{}, nil, "B1", WithRegenerateOnEdit())
+
+	message := func(ts, text string) *slackevents.MessageEvent {
+		return &slackevents.MessageEvent{User: "U1", Channel: "C1", Text: text, TimeStamp: ts, ThreadTimeStamp: "1.0"}
+	}
+	changed := func(ts, text string) *slackevents.MessageEvent {
+		return &slackevents.MessageEvent{SubType: slack.MsgSubTypeMessageChanged, Channel: "C1", Message: &slackevents.MessageEvent{
+			User: "U1", Text: text, TimeStamp: ts, ThreadTimeStamp: "1.0",
+			Edited: &slackevents.Edited{User: "U1", TimeStamp: "1690000000.000000"},
+		}}
+	}
+	for _, ev := range []*slackevents.MessageEvent{message("1.0", "<@B1> what is go?"), message("1.1", "and rust?")} {
+		if err := c.OnMessage(ctx, ev); err != nil {
+			t.Fatal(err)
+		}
+		c.dispatcher.Wait()
+	}
+
+	// the first question isn't answered again since it's followed by another one.
+	for _, ev := range []*slackevents.MessageEvent{changed("1.0", "<@B1> what is golang?"), changed("1.1", "and zig?"), changed("1.1", "and zig?")} {
+		if err := c.OnMessageChanged(ctx, ev); err != nil {
+			t.Fatal(err)
+		}
+		c.dispatcher.Wait()
+	}
+	want := []string{"answer to what is go?", "answer to and rust?", "answer to and zig?"}
+	if len(chat.texts) != len(want) {
+		t.Fatalf("got answers %q, want %q", chat.texts, want)
+	}
+	for i := range want {
+		if chat.texts[i] != want[i] {
+			t.Errorf("answer #%d is %q, want %q", i+1, chat.texts[i], want[i])
+		}
+	}
+
+	edits, err := store.GetEdits(ctx, messagestore.NewMessageFromMessage(message("1.1", "")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(edits) != 1 || edits[0].Text != "and rust?" {
+		t.Errorf("unexpected edits %v", edits)
+	}
+	if !edits[0].EditedAt.Equal(time.Unix(1690000000, 0)) {
+		t.Errorf("the edit should be at the edited ts, got %s", edits[0].EditedAt)
+	}
+
+	deleted := &slackevents.MessageEvent{SubType: slack.MsgSubTypeMessageDeleted, Channel: "C1", PreviousMessage: message("1.1", "and zig?")}
+	if err := c.OnMessageDeleted(ctx, deleted); err != nil {
+		t.Fatal(err)
+	}
+	cv, err := store.GetConversation(ctx, "1.0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if msgs := cv.GetMessages(); len(msgs) != 1 || msgs[0].GetText() != "what is golang?" {
+		t.Errorf("unexpected conversation %q", cv.String())
+	}
+}
@@ -0,0 +1,51 @@
+package chatbot
+
+import (
+	"encoding/json"
+	"expvar"
+	"sync"
+	"time"
+)
+
+// metrics are published under "chatbot" in expvar.
+// they can be read at /debug/vars when the http server uses http.DefaultServeMux.
+var metrics = expvar.NewMap("chatbot")
+
+var queueWait = newDurationStat("dispatcher.queue_wait")
+
+// durationStat keeps count, sum and max of observed durations.
+type durationStat struct {
+	mu    sync.Mutex
+	count int64
+	sum   time.Duration
+	max   time.Duration
+}
+
+var _ expvar.Var = (*durationStat)(nil)
+
+func newDurationStat(name string) *durationStat {
+	s := &durationStat{}
+	metrics.Set(name, s)
+	return s
+}
+
+func (s *durationStat) Observe(d time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.count++
+	s.sum += d
+	if d > s.max {
+		s.max = d
+	}
+}
+
+func (s *durationStat) String() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	b, _ := json.Marshal(map[string]any{
+		"count":       s.count,
+		"sum_seconds": s.sum.Seconds(),
+		"max_seconds": s.max.Seconds(),
+	})
+	return string(b)
+}
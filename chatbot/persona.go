@@ -0,0 +1,101 @@
+package chatbot
+
+import (
+	"context"
+	"sort"
+)
+
+// DefaultResponder is the name of the BlockActionResponder passed to New.
+const DefaultResponder = "bash"
+
+// Persona is how the bot behaves in a channel.
+type Persona struct {
+	Name string
+	// LLM answers with the prompt, model and temperature of the persona.
+	LLM LLMClient
+	// Responders are the names of the responders allowed to run the code blocks in the replies.
+	Responders []string
+	// RunButtons shows a Run button per allowed responder on the code blocks.
+	RunButtons bool
+}
+
+func (p *Persona) allows(responder string) bool {
+	for _, r := range p.Responders {
+		if r == responder {
+			return true
+		}
+	}
+	return false
+}
+
+// Personas maps channel IDs to personas.
+type Personas struct {
+	Default  *Persona
+	Channels map[string]*Persona
+	// Named are the personas by name regardless of the channel.
+	Named map[string]*Persona
+}
+
+// ForChannel returns the persona of the channel, or the default one.
+func (p *Personas) ForChannel(channel string) *Persona {
+	if ps, ok := p.Channels[channel]; ok {
+		return ps
+	}
+	return p.Default
+}
+
+func (p *Personas) names() []string {
+	names := make([]string, 0, len(p.Named))
+	for name := range p.Named {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// WithPersonas replaces the default persona, which answers with the llm passed to New
+// and runs the code blocks with the default responder.
+func WithPersonas(p *Personas) Option {
+	return func(c *ChatBot) {
+		c.SetPersonas(p)
+	}
+}
+
+// SetPersonas replaces the personas while the bot is running.
+// The replies being generated finish with the previous ones.
+func (c *ChatBot) SetPersonas(p *Personas) {
+	c.personas.Store(p)
+}
+
+// WithResponder adds a responder which personas can allow by the name.
+func WithResponder(name string, r BlockActionResponder) Option {
+	return func(c *ChatBot) {
+		c.responders[name] = r
+	}
+}
+
+// within returns a copy of the persona which runs only what limit allows.
+func (p *Persona) within(limit *Persona) *Persona {
+	q := *p
+	q.Responders = nil
+	for _, r := range p.Responders {
+		if limit.allows(r) {
+			q.Responders = append(q.Responders, r)
+		}
+	}
+	q.RunButtons = p.RunButtons && limit.RunButtons
+	return &q
+}
+
+// persona resolves the persona for the thread, which is overridden by "persona <name>" in the thread.
+// The override never runs more responders than the persona of the channel.
+func (c *ChatBot) persona(ctx context.Context, channel, thid string) *Persona {
+	personas := c.personas.Load()
+	p := personas.ForChannel(channel)
+	if name := c.threadSettings(ctx, thid).Persona; name != "" {
+		if o, ok := personas.Named[name]; ok && o != p {
+			return o.within(p)
+		}
+	}
+	return p
+}
@@ -0,0 +1,32 @@
+package chatbot
+
+import "testing"
+
+func TestPersonas_ForChannel(t *testing.T) {
+	ops := &Persona{Name: "ops", Responders: []string{DefaultResponder}}
+	sql := &Persona{Name: "sql-helper"}
+	p := &Personas{
+		Default:  ops,
+		Channels: map[string]*Persona{"C1": sql},
+	}
+
+	tests := map[string]struct {
+		channel   string
+		want      *Persona
+		allowBash bool
+	}{
+		"configured channel": {channel: "C1", want: sql, allowBash: false},
+		"other channel":      {channel: "C2", want: ops, allowBash: true},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			got := p.ForChannel(tt.channel)
+			if got != tt.want {
+				t.Errorf("got %s, want %s", got.Name, tt.want.Name)
+			}
+			if got.allows(DefaultResponder) != tt.allowBash {
+				t.Errorf("allows(%s) = %v", DefaultResponder, !tt.allowBash)
+			}
+		})
+	}
+}
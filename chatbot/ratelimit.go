@@ -0,0 +1,170 @@
+package chatbot
+
+import (
+	"context"
+	"fmt"
+	"github.com/ku/chatbot-slack-llm/messagestore"
+	"log"
+	"time"
+)
+
+// RateLimitConfig sets the limits of llm usage. Zero means unlimited.
+type RateLimitConfig struct {
+	UserRequestsPerMinute    int64
+	ChannelRequestsPerMinute int64
+	UserDailyTokens          int64
+	ChannelDailyTokens       int64
+}
+
+// ThrottledError is returned by RateLimiter when the message exceeds one of the limits.
+type ThrottledError struct {
+	Scope   string
+	Limit   string
+	ResetAt time.Time
+}
+
+func (e *ThrottledError) Error() string {
+	return fmt.Sprintf("%s %s exceeded until %s", e.Scope, e.Limit, e.ResetAt.Format(time.RFC3339))
+}
+
+// RateLimiter counts requests per minute and tokens per day with fixed windows.
+// The counters are kept in a CounterStore so that they survive restarts with a persistent store.
+type RateLimiter struct {
+	conf     *RateLimitConfig
+	counters messagestore.CounterStore
+	now      func() time.Time
+}
+
+func NewRateLimiter(conf *RateLimitConfig, counters messagestore.CounterStore) *RateLimiter {
+	return &RateLimiter{
+		conf:     conf,
+		counters: counters,
+		now:      time.Now,
+	}
+}
+
+type limitScope struct {
+	name     string
+	id       string
+	rpm      int64
+	tokens   int64
+	rpmKey   string
+	tokenKey string
+}
+
+func (r *RateLimiter) scopes(m messagestore.Message, now time.Time) []limitScope {
+	minute := now.Unix() / 60
+	day := now.UTC().Format("2006-01-02")
+	return []limitScope{
+		{
+			name:     "user",
+			id:       m.GetFrom(),
+			rpm:      r.conf.UserRequestsPerMinute,
+			tokens:   r.conf.UserDailyTokens,
+			rpmKey:   fmt.Sprintf("ratelimit/requests/user/%s/%d", m.GetFrom(), minute),
+			tokenKey: fmt.Sprintf("ratelimit/tokens/user/%s/%s", m.GetFrom(), day),
+		},
+		{
+			name:     "channel",
+			id:       m.GetChannel(),
+			rpm:      r.conf.ChannelRequestsPerMinute,
+			tokens:   r.conf.ChannelDailyTokens,
+			rpmKey:   fmt.Sprintf("ratelimit/requests/channel/%s/%d", m.GetChannel(), minute),
+			tokenKey: fmt.Sprintf("ratelimit/tokens/channel/%s/%s", m.GetChannel(), day),
+		},
+	}
+}
+
+func nextMinute(now time.Time) time.Time {
+	return now.Truncate(time.Minute).Add(time.Minute)
+}
+
+func nextDay(now time.Time) time.Time {
+	y, m, d := now.UTC().Date()
+	return time.Date(y, m, d+1, 0, 0, 0, 0, time.UTC)
+}
+
+// Allow counts the request of the message and returns *ThrottledError if it exceeds the limits.
+// A refused request isn't counted in any scope.
+func (r *RateLimiter) Allow(ctx context.Context, m messagestore.Message) error {
+	now := r.now()
+	scopes := r.scopes(m, now)
+	for _, s := range scopes {
+		if s.tokens > 0 {
+			used, err := r.counters.IncrementCounter(ctx, s.tokenKey, 0, nextDay(now))
+			if err != nil {
+				return fmt.Errorf("failed to read token counter: %w", err)
+			}
+			if used >= s.tokens {
+				return &ThrottledError{
+					Scope:   s.name,
+					Limit:   fmt.Sprintf("daily quota of %d tokens", s.tokens),
+					ResetAt: nextDay(now),
+				}
+			}
+		}
+	}
+
+	// the requests are counted before they're compared so that concurrent ones don't exceed the limits.
+	var counted []counter
+	for _, s := range scopes {
+		if s.rpm <= 0 {
+			continue
+		}
+		c := counter{key: s.rpmKey, expiresAt: nextMinute(now)}
+		n, err := r.counters.IncrementCounter(ctx, c.key, 1, c.expiresAt)
+		if err != nil {
+			r.uncount(ctx, counted)
+			return fmt.Errorf("failed to count request: %w", err)
+		}
+		counted = append(counted, c)
+		if n > s.rpm {
+			r.uncount(ctx, counted)
+			return &ThrottledError{
+				Scope:   s.name,
+				Limit:   fmt.Sprintf("limit of %d requests per minute", s.rpm),
+				ResetAt: nextMinute(now),
+			}
+		}
+	}
+	return nil
+}
+
+// counter is a counter incremented for a request, remembered to take the request back.
+type counter struct {
+	key       string
+	expiresAt time.Time
+}
+
+// uncount takes back the request from the exact counters which counted it, with their expiry.
+func (r *RateLimiter) uncount(ctx context.Context, counted []counter) {
+	for _, c := range counted {
+		if _, err := r.counters.IncrementCounter(ctx, c.key, -1, c.expiresAt); err != nil {
+			log.Printf("failed to take back the request from %s: %s", c.key, err.Error())
+		}
+	}
+}
+
+// AddTokens records the tokens used to answer the message.
+func (r *RateLimiter) AddTokens(ctx context.Context, m messagestore.Message, tokens int64) error {
+	if tokens <= 0 {
+		return nil
+	}
+	now := r.now()
+	for _, s := range r.scopes(m, now) {
+		if s.tokens <= 0 {
+			continue
+		}
+		if _, err := r.counters.IncrementCounter(ctx, s.tokenKey, tokens, nextDay(now)); err != nil {
+			return fmt.Errorf("failed to count tokens: %w", err)
+		}
+	}
+	return nil
+}
+
+// throttledMessage tells when the limit resets in the user's timezone.
+// https://api.slack.com/reference/surfaces/formatting#date-formatting
+func throttledMessage(e *ThrottledError) string {
+	return fmt.Sprintf("You've reached the %s %s. It resets at <!date^%d^{date_short} {time}|%s>.",
+		e.Scope, e.Limit, e.ResetAt.Unix(), e.ResetAt.Format(time.RFC1123))
+}
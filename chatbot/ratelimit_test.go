@@ -0,0 +1,139 @@
+package chatbot
+
+import (
+	"context"
+	"errors"
+	"github.com/ku/chatbot-slack-llm/internal/conversation/memory"
+	"github.com/ku/chatbot-slack-llm/messagestore"
+	"github.com/slack-go/slack/slackevents"
+	"testing"
+	"time"
+)
+
+func TestRateLimiter_Allow(t *testing.T) {
+	ctx := context.Background()
+	// the store expires counters by the wall clock.
+	now := time.Now()
+
+	m := messagestore.NewMessageFromMessage(&slackevents.MessageEvent{
+		User:    "U1",
+		Channel: "C1",
+	})
+
+	t.Run("requests per minute", func(t *testing.T) {
+		rl := NewRateLimiter(&RateLimitConfig{UserRequestsPerMinute: 2}, memory.NewConversations(""))
+		rl.now = func() time.Time { return now }
+
+		for i := 0; i < 2; i++ {
+			if err := rl.Allow(ctx, m); err != nil {
+				t.Fatalf("request %d should be allowed: %s", i, err)
+			}
+		}
+
+		var te *ThrottledError
+		if err := rl.Allow(ctx, m); !errors.As(err, &te) {
+			t.Fatalf("expected ThrottledError, got %v", err)
+		}
+		if te.Scope != "user" || !te.ResetAt.Equal(now.Truncate(time.Minute).Add(time.Minute)) {
+			t.Fatalf("unexpected error: %s", te)
+		}
+
+		rl.now = func() time.Time { return now.Add(time.Minute) }
+		if err := rl.Allow(ctx, m); err != nil {
+			t.Fatalf("should be allowed in the next minute: %s", err)
+		}
+	})
+
+	t.Run("daily tokens", func(t *testing.T) {
+		rl := NewRateLimiter(&RateLimitConfig{ChannelDailyTokens: 100}, memory.NewConversations(""))
+		rl.now = func() time.Time { return now }
+
+		if err := rl.Allow(ctx, m); err != nil {
+			t.Fatal(err)
+		}
+		if err := rl.AddTokens(ctx, m, 100); err != nil {
+			t.Fatal(err)
+		}
+
+		var te *ThrottledError
+		if err := rl.Allow(ctx, m); !errors.As(err, &te) {
+			t.Fatalf("expected ThrottledError, got %v", err)
+		}
+		if te.Scope != "channel" || !te.ResetAt.Equal(nextDay(now)) {
+			t.Fatalf("unexpected error: %s", te)
+		}
+	})
+	t.Run("refused requests aren't counted", func(t *testing.T) {
+		rl := NewRateLimiter(&RateLimitConfig{UserRequestsPerMinute: 2, ChannelRequestsPerMinute: 1}, memory.NewConversations(""))
+		rl.now = func() time.Time { return now }
+
+		if err := rl.Allow(ctx, m); err != nil {
+			t.Fatal(err)
+		}
+		// refused by the channel limit.
+		for i := 0; i < 3; i++ {
+			var te *ThrottledError
+			if err := rl.Allow(ctx, m); !errors.As(err, &te) || te.Scope != "channel" {
+				t.Fatalf("expected ThrottledError of the channel, got %v", err)
+			}
+		}
+
+		// the user has made only one request in another channel.
+		other := messagestore.NewMessageFromMessage(&slackevents.MessageEvent{User: "U1", Channel: "C2"})
+		if err := rl.Allow(ctx, other); err != nil {
+			t.Fatalf("the refused requests should not count for the user: %s", err)
+		}
+	})
+	t.Run("refused requests are taken back from the counted window", func(t *testing.T) {
+		rl := NewRateLimiter(&RateLimitConfig{UserRequestsPerMinute: 2, ChannelRequestsPerMinute: 1}, nil)
+		next := now.Truncate(time.Minute).Add(time.Minute)
+		clock := next.Add(-time.Second)
+		rl.now = func() time.Time { return clock }
+		counters := &recordingCounters{CounterStore: memory.NewConversations(""), tick: func() { clock = clock.Add(time.Millisecond) }}
+		rl.counters = counters
+
+		if err := rl.Allow(ctx, m); err != nil {
+			t.Fatal(err)
+		}
+		// the clock passes the minute while the refused request is counted.
+		clock = next.Add(-time.Millisecond)
+		if err := rl.Allow(ctx, m); err == nil {
+			t.Fatal("expected ThrottledError")
+		}
+		incremented := map[counterCall]bool{}
+		var takenBack int
+		for _, c := range counters.calls {
+			switch c.delta {
+			case 1:
+				incremented[counterCall{key: c.key, expiresAt: c.expiresAt}] = true
+			case -1:
+				takenBack++
+				if !incremented[counterCall{key: c.key, expiresAt: c.expiresAt}] {
+					t.Errorf("taken back from %s expiring at %s, which wasn't counted", c.key, c.expiresAt)
+				}
+			}
+		}
+		if takenBack != 2 {
+			t.Errorf("the refused request should be taken back from 2 counters, got %d", takenBack)
+		}
+	})
+}
+
+type counterCall struct {
+	key       string
+	delta     int64
+	expiresAt time.Time
+}
+
+// recordingCounters records the calls and ticks the clock at each of them.
+type recordingCounters struct {
+	messagestore.CounterStore
+	tick  func()
+	calls []counterCall
+}
+
+func (r *recordingCounters) IncrementCounter(ctx context.Context, key string, delta int64, expiresAt time.Time) (int64, error) {
+	r.tick()
+	r.calls = append(r.calls, counterCall{key: key, delta: delta, expiresAt: expiresAt})
+	return r.CounterStore.IncrementCounter(ctx, key, delta, expiresAt)
+}
@@ -0,0 +1,102 @@
+package chatbot
+
+import (
+	"context"
+	"fmt"
+	"github.com/ku/chatbot-slack-llm/messagestore"
+	"log"
+)
+
+const (
+	ActionIDUseCachedAnswer = "semantic-use"
+	ActionIDAskModel        = "semantic-ask"
+)
+
+// SemanticCache finds answers to questions similar to the new one.
+// Answers are only found in the scope where they were stored.
+type SemanticCache interface {
+	// Lookup returns nil if no question in the scope is similar enough.
+	Lookup(ctx context.Context, scope SemanticScope, question string) (*SemanticMatch, error)
+	Get(ctx context.Context, scope SemanticScope, id string) (*SemanticMatch, error)
+	Store(ctx context.Context, scope SemanticScope, question, answer string) error
+}
+
+// SemanticScope is where an answer can be offered again.
+// Answers in a private channel must not show up in other channels,
+// and a persona doesn't answer with what another persona said.
+type SemanticScope struct {
+	Channel string
+	Persona string
+}
+
+type SemanticMatch struct {
+	ID         string
+	Question   string
+	Answer     string
+	Similarity float32
+}
+
+// WithSemanticCache offers the answers to similar questions before asking the model.
+func WithSemanticCache(sc SemanticCache) Option {
+	return func(c *ChatBot) {
+		c.semantic = sc
+	}
+}
+
+// isNewQuestion tells if the message started the thread.
+// Follow-ups depend on the context, so they are never answered from the cache.
+func isNewQuestion(cv messagestore.Conversation, m messagestore.Message) bool {
+	msgs := cv.GetMessages()
+	return len(msgs) > 0 && msgs[0].GetTimestamp() == m.GetTimestamp()
+}
+
+func (c *ChatBot) semanticScope(ctx context.Context, channel, thid string) SemanticScope {
+	return SemanticScope{Channel: channel, Persona: c.persona(ctx, channel, thid).Name}
+}
+
+// offerSemanticMatch asks the user whether to use the answer to a similar question.
+func (c *ChatBot) offerSemanticMatch(ctx context.Context, cv messagestore.Conversation, m messagestore.Message) (bool, error) {
+	if c.semantic == nil || !isNewQuestion(cv, m) {
+		return false, nil
+	}
+
+	match, err := c.semantic.Lookup(ctx, c.semanticScope(ctx, m.GetChannel(), m.GetThreadID()), m.GetText())
+	if err != nil || match == nil {
+		return false, err
+	}
+
+	text := fmt.Sprintf("I answered a similar question before (similarity %.2f):\n> %s", match.Similarity, match.Question)
+	nm := messagestore.NewMessage(m.GetChannel(), m.GetThreadID(), text)
+	nm.Actions = []messagestore.Action{
+		{ID: ActionIDUseCachedAnswer, Text: "Use cached answer", Value: match.ID},
+		{ID: ActionIDAskModel, Text: "Ask the model", Value: m.GetThreadID()},
+	}
+	if err := c.chat.PostActionableMessage(ctx, nm); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+func (c *ChatBot) useSemanticMatch(ctx context.Context, channel, thid, id string) error {
+	if c.semantic == nil {
+		return nil
+	}
+	match, err := c.semantic.Get(ctx, c.semanticScope(ctx, channel, thid), id)
+	if err != nil {
+		return err
+	}
+
+	nm := messagestore.NewMessage(channel, thid, match.Answer)
+	nm.Cached = true
+	nm.Actions = []messagestore.Action{regenerateAction(thid)}
+	return c.postReply(ctx, nm)
+}
+
+func (c *ChatBot) storeSemanticAnswer(ctx context.Context, cv messagestore.Conversation, m messagestore.Message, answer string) {
+	if c.semantic == nil || !isNewQuestion(cv, m) {
+		return
+	}
+	if err := c.semantic.Store(ctx, c.semanticScope(ctx, m.GetChannel(), m.GetThreadID()), m.GetText(), answer); err != nil {
+		log.Printf("failed to store the answer in the semantic cache: %s", err.Error())
+	}
+}
@@ -14,3 +14,11 @@ func postMessageContext(ctx context.Context, client *slack.Client, m messagestor
 	opts = append(opts, options...)
 	return client.PostMessageContext(ctx, m.GetChannel(), opts...)
 }
+
+func postEphemeralContext(ctx context.Context, client *slack.Client, user string, m messagestore.Message) error {
+	_, err := client.PostEphemeralContext(ctx, m.GetChannel(), user,
+		slack.MsgOptionTS(m.GetThreadID()),
+		slack.MsgOptionText(m.GetText(), false),
+	)
+	return err
+}
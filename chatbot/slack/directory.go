@@ -0,0 +1,68 @@
+package slack
+
+import (
+	"context"
+	"fmt"
+	"github.com/slack-go/slack"
+	"sync"
+)
+
+// directory looks up the names of users and channels and remembers them
+// since they are rarely renamed and the APIs are rate limited.
+type directory struct {
+	client *slack.Client
+
+	mu       sync.Mutex
+	users    map[string]string
+	channels map[string]string
+}
+
+func newDirectory(client *slack.Client) *directory {
+	return &directory{
+		client:   client,
+		users:    make(map[string]string),
+		channels: make(map[string]string),
+	}
+}
+
+func (d *directory) lookup(cache map[string]string, id string, f func() (string, error)) (string, error) {
+	d.mu.Lock()
+	name, ok := cache[id]
+	d.mu.Unlock()
+	if ok {
+		return name, nil
+	}
+
+	name, err := f()
+	if err != nil {
+		return "", err
+	}
+
+	d.mu.Lock()
+	cache[id] = name
+	d.mu.Unlock()
+	return name, nil
+}
+
+func (d *directory) UserName(ctx context.Context, user string) (string, error) {
+	return d.lookup(d.users, user, func() (string, error) {
+		u, err := d.client.GetUserInfoContext(ctx, user)
+		if err != nil {
+			return "", fmt.Errorf("failed to get user %s: %w", user, err)
+		}
+		if u.Profile.DisplayName != "" {
+			return u.Profile.DisplayName, nil
+		}
+		return u.RealName, nil
+	})
+}
+
+func (d *directory) ChannelName(ctx context.Context, channel string) (string, error) {
+	return d.lookup(d.channels, channel, func() (string, error) {
+		c, err := d.client.GetConversationInfoContext(ctx, &slack.GetConversationInfoInput{ChannelID: channel})
+		if err != nil {
+			return "", fmt.Errorf("failed to get channel %s: %w", channel, err)
+		}
+		return c.Name, nil
+	})
+}
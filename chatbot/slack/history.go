@@ -0,0 +1,176 @@
+package slack
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/ku/chatbot-slack-llm/messagestore"
+	"github.com/slack-go/slack"
+	"github.com/slack-go/slack/slackevents"
+	"log"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Thread is a root message and its replies.
+type Thread struct {
+	Channel   string
+	TS        string
+	Permalink string
+	// LatestReply is the ts of the last reply.
+	LatestReply string
+	Messages    []slack.Message
+}
+
+// maxRateLimitRetries is the number of retries of a request told to slow down.
+const maxRateLimitRetries = 5
+
+// withRateLimitRetry calls f again after the duration told by Slack when the request is rate limited.
+// https://api.slack.com/docs/rate-limits
+func withRateLimitRetry(ctx context.Context, f func() error) error {
+	for attempt := 0; ; attempt++ {
+		err := f()
+		var rle *slack.RateLimitedError
+		if !errors.As(err, &rle) || attempt >= maxRateLimitRetries {
+			return err
+		}
+
+		log.Printf("slack rate limited, retrying after %s", rle.RetryAfter)
+		t := time.NewTimer(rle.RetryAfter)
+		select {
+		case <-ctx.Done():
+			t.Stop()
+			return ctx.Err()
+		case <-t.C:
+		}
+	}
+}
+
+// getReplies returns all the messages of the thread including the root.
+func getReplies(ctx context.Context, client *slack.Client, channel, ts string) ([]slack.Message, error) {
+	var msgs []slack.Message
+	params := &slack.GetConversationRepliesParameters{
+		ChannelID: channel,
+		Timestamp: ts,
+		Limit:     200,
+	}
+	for {
+		var page []slack.Message
+		var hasMore bool
+		var cursor string
+		err := withRateLimitRetry(ctx, func() error {
+			var err error
+			page, hasMore, cursor, err = client.GetConversationRepliesContext(ctx, params)
+			return err
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to get replies of %s/%s: %w", channel, ts, err)
+		}
+		msgs = append(msgs, page...)
+		if !hasMore || cursor == "" {
+			return msgs, nil
+		}
+		params.Cursor = cursor
+	}
+}
+
+// fetchThread returns the messages of the thread posted by the users, oldest first.
+func fetchThread(ctx context.Context, client *slack.Client, channel, ts string) ([]messagestore.Message, error) {
+	replies, err := getReplies(ctx, client, channel, ts)
+	if err != nil {
+		return nil, err
+	}
+
+	var msgs []messagestore.Message
+	for _, r := range replies {
+		// e.g. channel_join
+		if r.SubType != "" && r.SubType != slack.MsgSubTypeThreadBroadcast {
+			continue
+		}
+		msgs = append(msgs, messagestore.NewMessageFromMessage(&slackevents.MessageEvent{
+			User:            r.User,
+			Text:            r.Text,
+			TimeStamp:       r.Timestamp,
+			ThreadTimeStamp: r.ThreadTimestamp,
+			Channel:         channel,
+		}))
+	}
+	return msgs, nil
+}
+
+// FetchThreads pages through the whole channel history and calls f with the threads replied after since,
+// in the order of the latest replies so that the caller can save the progress as the LatestReply.
+// The old threads are fetched again when they get new replies.
+func FetchThreads(ctx context.Context, client *slack.Client, channel, since string, f func(t *Thread) error) error {
+	var roots []slack.Message
+	params := &slack.GetConversationHistoryParameters{
+		ChannelID: channel,
+		Limit:     200,
+	}
+	for {
+		var resp *slack.GetConversationHistoryResponse
+		err := withRateLimitRetry(ctx, func() error {
+			var err error
+			resp, err = client.GetConversationHistoryContext(ctx, params)
+			return err
+		})
+		if err != nil {
+			return fmt.Errorf("failed to get history of %s: %w", channel, err)
+		}
+		for _, m := range resp.Messages {
+			if m.ReplyCount > 0 && tsAfter(m.LatestReply, since) {
+				roots = append(roots, m)
+			}
+		}
+		if !resp.HasMore || resp.ResponseMetaData.NextCursor == "" {
+			break
+		}
+		params.Cursor = resp.ResponseMetaData.NextCursor
+	}
+
+	sort.SliceStable(roots, func(i, j int) bool {
+		return tsAfter(roots[j].LatestReply, roots[i].LatestReply)
+	})
+	for _, root := range roots {
+		ts := root.Timestamp
+		msgs, err := getReplies(ctx, client, channel, ts)
+		if err != nil {
+			return err
+		}
+
+		var permalink string
+		err = withRateLimitRetry(ctx, func() error {
+			var err error
+			permalink, err = client.GetPermalinkContext(ctx, &slack.PermalinkParameters{Channel: channel, Ts: ts})
+			return err
+		})
+		if err != nil {
+			return fmt.Errorf("failed to get permalink of %s/%s: %w", channel, ts, err)
+		}
+
+		if err := f(&Thread{
+			Channel:     channel,
+			TS:          ts,
+			Permalink:   permalink,
+			LatestReply: root.LatestReply,
+			Messages:    msgs,
+		}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// tsAfter tells if the Slack ts a is newer than b. Any ts is newer than the empty one.
+func tsAfter(a, b string) bool {
+	ai, af, _ := strings.Cut(a, ".")
+	bi, bf, _ := strings.Cut(b, ".")
+	if len(ai) != len(bi) {
+		return len(ai) > len(bi)
+	}
+	if ai != bi {
+		return ai > bi
+	}
+	return af > bf
+}
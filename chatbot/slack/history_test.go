@@ -0,0 +1,140 @@
+package slack
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/slack-go/slack"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+)
+
+func TestFetchThreads(t *testing.T) {
+	limited := false
+	mux := http.NewServeMux()
+	mux.HandleFunc("/conversations.history", func(w http.ResponseWriter, r *http.Request) {
+		// newest first, the second one has no replies and the last one has no new replies.
+		_ = json.NewEncoder(w).Encode(map[string]any{
+			"ok": true,
+			"messages": []map[string]any{
+				{"ts": "300.000", "text": "q2", "reply_count": 1, "latest_reply": "310.000"},
+				{"ts": "200.000", "text": "hello"},
+				{"ts": "150.000", "text": "q1", "reply_count": 2, "latest_reply": "400.000"},
+				{"ts": "50.000", "text": "q0", "reply_count": 1, "latest_reply": "60.000"},
+			},
+		})
+	})
+	mux.HandleFunc("/conversations.replies", func(w http.ResponseWriter, r *http.Request) {
+		_ = r.ParseForm()
+		if !limited {
+			limited = true
+			w.Header().Set("Retry-After", "0")
+			w.WriteHeader(http.StatusTooManyRequests)
+			return
+		}
+		ts := r.Form.Get("ts")
+		_ = json.NewEncoder(w).Encode(map[string]any{
+			"ok": true,
+			"messages": []map[string]any{
+				{"ts": ts, "text": "question"},
+				{"ts": ts + "1", "text": "answer"},
+			},
+		})
+	})
+	mux.HandleFunc("/chat.getPermalink", func(w http.ResponseWriter, r *http.Request) {
+		_ = r.ParseForm()
+		_ = json.NewEncoder(w).Encode(map[string]any{
+			"ok":        true,
+			"channel":   r.Form.Get("channel"),
+			"permalink": "https://example.slack.com/" + r.Form.Get("message_ts"),
+		})
+	})
+	ts := httptest.NewServer(mux)
+	defer ts.Close()
+
+	client := slack.New("token", slack.OptionAPIURL(ts.URL+"/"))
+
+	var got []string
+	err := FetchThreads(context.Background(), client, "C1", "100.000", func(th *Thread) error {
+		if len(th.Messages) != 2 {
+			t.Errorf("%s has %d messages", th.TS, len(th.Messages))
+		}
+		got = append(got, th.TS+" "+th.Permalink)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// in the order of the latest replies.
+	want := []string{
+		"300.000 https://example.slack.com/300.000",
+		"150.000 https://example.slack.com/150.000",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
+
+func TestFetchThread(t *testing.T) {
+	pages := 0
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_ = r.ParseForm()
+		pages++
+		if pages == 1 {
+			_ = json.NewEncoder(w).Encode(map[string]any{
+				"ok":       true,
+				"has_more": true,
+				"messages": []map[string]any{
+					{"ts": "100.000", "thread_ts": "100.000", "user": "U1", "text": "<@B1> question"},
+					{"ts": "100.001", "thread_ts": "100.000", "user": "U2", "subtype": "channel_join", "text": "joined"},
+				},
+				"response_metadata": map[string]any{"next_cursor": "next"},
+			})
+			return
+		}
+		if r.Form.Get("cursor") != "next" {
+			t.Errorf("cursor = %s", r.Form.Get("cursor"))
+		}
+		_ = json.NewEncoder(w).Encode(map[string]any{
+			"ok": true,
+			"messages": []map[string]any{
+				{"ts": "100.002", "thread_ts": "100.000", "user": "U1", "text": "more"},
+			},
+		})
+	}))
+	defer ts.Close()
+
+	client := slack.New("token", slack.OptionAPIURL(ts.URL+"/"))
+	msgs, err := fetchThread(context.Background(), client, "C1", "100.000")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var got []string
+	for _, m := range msgs {
+		got = append(got, m.GetChannel()+"/"+m.GetTimestamp()+" "+m.GetFrom())
+	}
+	if want := []string{"C1/100.000 U1", "C1/100.002 U1"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
+
+func TestTsAfter(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want bool
+	}{
+		{a: "100.000002", b: "100.000001", want: true},
+		{a: "100.000001", b: "100.000001", want: false},
+		{a: "99.000009", b: "100.000001", want: false},
+		{a: "1000.000000", b: "999.999999", want: true},
+		{a: "100.000001", b: "", want: true},
+	}
+	for _, tt := range tests {
+		if got := tsAfter(tt.a, tt.b); got != tt.want {
+			t.Errorf("tsAfter(%q, %q) = %v, want %v", tt.a, tt.b, got, tt.want)
+		}
+	}
+}
@@ -21,18 +21,16 @@ type ResponseBlock struct {
 
 func BuildBlocksFromResponse(m messagestore.Message) ([]slack.Block, error) {
 	blocks := []slack.Block{}
-	mid := m.GetMessageID()
+	var responders []string
+	if rm, ok := m.(interface{ GetResponders() []string }); ok {
+		responders = rm.GetResponders()
+	}
 	s := m.GetText()
 	responseBlocks := CommandBlocksFromResponse(s)
 	for _, block := range responseBlocks {
 		s := block.Text
 		if block.Type == ResponseBlockTypeCommands {
-			runBtnText := slack.NewTextBlockObject("plain_text", "Run", true, false)
-			runBtnEle := slack.NewButtonBlockElement(fmt.Sprintf("run-%s", mid), block.Text, runBtnText)
-
-			text := slack.NewTextBlockObject("mrkdwn", fmt.Sprintf("```%s```", block.Text), false, false)
-			section := slack.NewSectionBlock(text, nil, slack.NewAccessory(runBtnEle))
-			blocks = append(blocks, section)
+			blocks = append(blocks, commandBlocks(block.Text, responders)...)
 			continue
 		}
 
@@ -41,9 +39,67 @@ func BuildBlocksFromResponse(m messagestore.Message) ([]slack.Block, error) {
 		blocks = append(blocks, section)
 	}
 
+	if sm, ok := m.(interface{ GetSources() []messagestore.Source }); ok && len(sm.GetSources()) > 0 {
+		blocks = append(blocks, sourcesBlock(sm.GetSources()))
+	}
+
+	if cm, ok := m.(interface{ IsCached() bool }); ok && cm.IsCached() {
+		note := slack.NewTextBlockObject("mrkdwn", ":recycle: cached answer", false, false)
+		blocks = append(blocks, slack.NewContextBlock("", note))
+	}
+
+	if am, ok := m.(interface{ GetActions() []messagestore.Action }); ok && len(am.GetActions()) > 0 {
+		blocks = append(blocks, actionBlock(am.GetActions()))
+	}
+
 	return blocks, nil
 }
 
+// commandBlocks shows the code with a Run button per responder.
+// A single button is placed beside the code and more are placed below it.
+func commandBlocks(code string, responders []string) []slack.Block {
+	text := slack.NewTextBlockObject("mrkdwn", fmt.Sprintf("```%s```", code), false, false)
+	switch len(responders) {
+	case 0:
+		return []slack.Block{slack.NewSectionBlock(text, nil, nil)}
+	case 1:
+		return []slack.Block{slack.NewSectionBlock(text, nil, slack.NewAccessory(runButton(responders[0], code, "Run")))}
+	}
+
+	buttons := make([]slack.BlockElement, len(responders))
+	for i, r := range responders {
+		buttons[i] = runButton(r, code, fmt.Sprintf("Run (%s)", r))
+	}
+	return []slack.Block{slack.NewSectionBlock(text, nil, nil), slack.NewActionBlock("", buttons...)}
+}
+
+func runButton(responder, code, label string) *slack.ButtonBlockElement {
+	text := slack.NewTextBlockObject("plain_text", label, true, false)
+	return slack.NewButtonBlockElement(messagestore.ActionIDRunPrefix+responder, code, text)
+}
+
+func sourcesBlock(sources []messagestore.Source) slack.Block {
+	links := make([]string, len(sources))
+	for i, s := range sources {
+		if s.URL == "" {
+			links[i] = s.Title
+			continue
+		}
+		links[i] = fmt.Sprintf("<%s|%s>", s.URL, s.Title)
+	}
+	text := slack.NewTextBlockObject("mrkdwn", "Sources: "+strings.Join(links, ", "), false, false)
+	return slack.NewContextBlock("", text)
+}
+
+func actionBlock(actions []messagestore.Action) slack.Block {
+	elements := make([]slack.BlockElement, len(actions))
+	for i, a := range actions {
+		text := slack.NewTextBlockObject("plain_text", a.Text, true, false)
+		elements[i] = slack.NewButtonBlockElement(a.ID, a.Value, text)
+	}
+	return slack.NewActionBlock("", elements...)
+}
+
 func CommandBlocksFromResponse(rawText string) []*ResponseBlock {
 	var blocks []*ResponseBlock
 	//Replace the ampersand, &, with &amp;
@@ -24,7 +24,14 @@ func HandleEventMessage(ctx context.Context, listener chatbot.EventListener, eve
 			// do nothing
 			println(ev.Text)
 		case *slackevents.MessageEvent:
-			err = listener.OnMessage(ctx, ev)
+			switch ev.SubType {
+			case slack.MsgSubTypeMessageChanged:
+				err = listener.OnMessageChanged(ctx, ev)
+			case slack.MsgSubTypeMessageDeleted:
+				err = listener.OnMessageDeleted(ctx, ev)
+			default:
+				err = listener.OnMessage(ctx, ev)
+			}
 		default:
 			err = fmt.Errorf("unknown inner event type: %s", event.Type)
 		}
@@ -44,6 +51,16 @@ func HandleEventMessage(ctx context.Context, listener chatbot.EventListener, eve
 	return nil, nil
 }
 
+// HandleSlashCommand runs the command and returns the reply shown only to the user who ran it.
+func HandleSlashCommand(ctx context.Context, listener chatbot.EventListener, cmd *slack.SlashCommand) *slack.Msg {
+	text, err := listener.OnSlashCommand(ctx, cmd)
+	if err != nil {
+		log.Printf("%s %s: %s", cmd.Command, cmd.Text, err.Error())
+		text = "Failed: " + err.Error()
+	}
+	return &slack.Msg{ResponseType: slack.ResponseTypeEphemeral, Text: text}
+}
+
 func dumpAsJson(blocks []slack.Block) error {
 	//test JSON on block kit builder
 	//https://app.slack.com/block-kit-builder/
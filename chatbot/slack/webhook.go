@@ -15,12 +15,15 @@ import (
 )
 
 type WebHook struct {
+	*directory
 	conf     *WebHookConfig
 	client   *slack.Client
 	listener chatbot.EventListener
 }
 
 var _ chatbot.ChatService = (*WebHook)(nil)
+var _ chatbot.Directory = (*WebHook)(nil)
+var _ chatbot.ThreadFetcher = (*WebHook)(nil)
 
 type WebHookConfig struct {
 	SigningSecret string
@@ -31,12 +34,14 @@ type WebHookHTTPConfig struct {
 	Addr                  string
 	EventSubscriptionPath string
 	InteractionPath       string
+	SlashCommandPath      string
 }
 
 func NewWebHook(conf *WebHookConfig, client *slack.Client) *WebHook {
 	return &WebHook{
-		conf:   conf,
-		client: client,
+		directory: newDirectory(client),
+		conf:      conf,
+		client:    client,
 	}
 }
 
@@ -54,6 +59,9 @@ func (w *WebHook) Run(ctx context.Context) error {
 	}))
 	http.HandleFunc(w.conf.HTTP.EventSubscriptionPath, w.EventSubscriptionHandler())
 	http.HandleFunc(w.conf.HTTP.InteractionPath, w.InteractivityHandler())
+	if w.conf.HTTP.SlashCommandPath != "" {
+		http.HandleFunc(w.conf.HTTP.SlashCommandPath, w.SlashCommandHandler())
+	}
 	return http.ListenAndServe(w.conf.HTTP.Addr, nil)
 }
 
@@ -93,6 +101,32 @@ func (w *WebHook) EventSubscriptionHandler() func(http.ResponseWriter, *http.Req
 	})
 }
 
+// SlashCommandHandler handles the admin commands, e.g. "/chatbot status".
+func (w *WebHook) SlashCommandHandler() func(http.ResponseWriter, *http.Request) {
+	return wrap(func(_ http.ResponseWriter, req *http.Request) (any, error) {
+		body, err := io.ReadAll(req.Body)
+		if err != nil {
+			return nil, err
+		}
+
+		if err := w.verifySignature(req, body); err != nil {
+			return nil, err
+		}
+
+		vals, err := url.ParseQuery(string(body))
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse query: %w", err)
+		}
+		req.PostForm = vals
+		cmd, err := slack.SlashCommandParse(req)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse slash command: %w", err)
+		}
+
+		return HandleSlashCommand(req.Context(), w.listener, &cmd), nil
+	})
+}
+
 func (w *WebHook) eventSubscriptionHandler(ctx context.Context, body []byte) (any, error) {
 	eventsAPIEvent, err := slackevents.ParseEvent(body, slackevents.OptionNoVerifyToken())
 	if err != nil {
@@ -121,19 +155,24 @@ func wrap(f func(w http.ResponseWriter, r *http.Request) (interface{}, error)) f
 	return func(w http.ResponseWriter, r *http.Request) {
 		resp, err := f(w, r)
 		if err != nil {
+			log.Printf("%s %s: %s", r.Method, r.URL.Path, err.Error())
 			w.WriteHeader(http.StatusInternalServerError)
+			return
 		}
 
-		w.WriteHeader(http.StatusOK)
+		// the headers must be set before the status.
 		switch v := resp.(type) {
 		case string:
-			w.Header().Set("content-type", "text")
-			_, _ = w.Write([]byte(v))
+			w.Header().Set("Content-Type", "text/plain")
+			w.WriteHeader(http.StatusOK)
+			_, err = w.Write([]byte(v))
 		case []byte:
-			w.Header().Set("content-type", "text")
+			w.Header().Set("Content-Type", "text/plain")
+			w.WriteHeader(http.StatusOK)
 			_, err = w.Write(v)
 		default:
-			w.Header().Set("content-type", "application/json")
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusOK)
 			err = json.NewEncoder(w).Encode(resp)
 		}
 		if err != nil {
@@ -164,3 +203,11 @@ func (w *WebHook) PostMessage(ctx context.Context, message messagestore.Message)
 func (w *WebHook) PostActionableMessage(ctx context.Context, message messagestore.Message) error {
 	return postActionableMessage(ctx, w.client, message)
 }
+
+func (w *WebHook) PostEphemeralMessage(ctx context.Context, user string, message messagestore.Message) error {
+	return postEphemeralContext(ctx, w.client, user, message)
+}
+
+func (w *WebHook) FetchThread(ctx context.Context, channel, thid string) ([]messagestore.Message, error) {
+	return fetchThread(ctx, w.client, channel, thid)
+}
@@ -3,6 +3,7 @@ package slack
 import (
 	"bytes"
 	"context"
+	"errors"
 	"github.com/ku/chatbot-slack-llm/chatbot"
 	"github.com/ku/chatbot-slack-llm/messagestore"
 	"io"
@@ -10,7 +11,10 @@ import (
 	"net/http/httptest"
 	"net/url"
 	"reflect"
+	"strconv"
+	"strings"
 	"testing"
+	"time"
 )
 
 type echoResponder struct{}
@@ -31,6 +35,10 @@ func (c *chatmock) PostMessage(ctx context.Context, message messagestore.Message
 func (c *chatmock) PostActionableMessage(ctx context.Context, message messagestore.Message) error {
 	return nil
 }
+func (c *chatmock) PostEphemeralMessage(ctx context.Context, user string, message messagestore.Message) error {
+	c.msg = message
+	return nil
+}
 func (c *chatmock) SetEventListener(listener chatbot.EventListener) {}
 func (c *chatmock) Run(ctx context.Context) error                   { return nil }
 
@@ -80,3 +88,53 @@ func Test_webhook_InteractivityHandler(t *testing.T) {
 		})
 	}
 }
+
+func Test_wrap(t *testing.T) {
+	tests := map[string]struct {
+		resp     any
+		err      error
+		wantCode int
+		wantType string
+		wantBody string
+	}{
+		"json":   {resp: map[string]string{"text": "ok"}, wantCode: http.StatusOK, wantType: "application/json", wantBody: "{\"text\":\"ok\"}\n"},
+		"string": {resp: "challenge", wantCode: http.StatusOK, wantType: "text/plain", wantBody: "challenge"},
+		"error":  {err: errors.New("invalid signature"), wantCode: http.StatusInternalServerError, wantBody: ""},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			h := wrap(func(w http.ResponseWriter, r *http.Request) (any, error) {
+				return tt.resp, tt.err
+			})
+			rec := httptest.NewRecorder()
+			h(rec, httptest.NewRequest(http.MethodPost, "/command", nil))
+
+			res := rec.Result()
+			if res.StatusCode != tt.wantCode {
+				t.Errorf("got status %d, want %d", res.StatusCode, tt.wantCode)
+			}
+			if got := res.Header.Get("Content-Type"); got != tt.wantType {
+				t.Errorf("got Content-Type %q, want %q", got, tt.wantType)
+			}
+			if got := rec.Body.String(); got != tt.wantBody {
+				t.Errorf("got body %q, want %q", got, tt.wantBody)
+			}
+		})
+	}
+}
+
+func TestWebHook_SlashCommandHandler_InvalidSignature(t *testing.T) {
+	w := NewWebHook(&WebHookConfig{SigningSecret: "secret"}, nil)
+	req := httptest.NewRequest(http.MethodPost, "/command", strings.NewReader("command=%2Fchatbot&text=status"))
+	req.Header.Set("X-Slack-Request-Timestamp", strconv.FormatInt(time.Now().Unix(), 10))
+	req.Header.Set("X-Slack-Signature", "v0=0000")
+	rec := httptest.NewRecorder()
+	w.SlashCommandHandler()(rec, req)
+
+	if rec.Code != http.StatusInternalServerError {
+		t.Errorf("got status %d", rec.Code)
+	}
+	if rec.Body.Len() != 0 {
+		t.Errorf("nothing should be written after the error, got %q", rec.Body.String())
+	}
+}
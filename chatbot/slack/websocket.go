@@ -12,11 +12,14 @@ import (
 )
 
 type websocket struct {
+	*directory
 	listener chatbot.EventListener
 	client   *slack.Client
 }
 
 var _ chatbot.ChatService = (*websocket)(nil)
+var _ chatbot.Directory = (*websocket)(nil)
+var _ chatbot.ThreadFetcher = (*websocket)(nil)
 
 type Slack interface {
 	Run(botToken, appToken string) error
@@ -27,7 +30,8 @@ type WebsocketConfig struct{}
 
 func NewWebsocket(conf *WebsocketConfig, client *slack.Client) *websocket {
 	return &websocket{
-		client: client,
+		directory: newDirectory(client),
+		client:    client,
 	}
 }
 
@@ -92,6 +96,14 @@ func (s *websocket) Run(ctx context.Context) error {
 						log.Println(err)
 					}
 					socketClient.Ack(*event.Request)
+				case socketmode.EventTypeSlashCommand:
+					cmd, ok := event.Data.(slack.SlashCommand)
+					if !ok {
+						log.Printf("Could not type cast the event to the SlashCommand: %v\n", event)
+						continue
+					}
+					// the reply is sent with the acknowledgement.
+					socketClient.Ack(*event.Request, HandleSlashCommand(ctx, s.listener, &cmd))
 				default:
 					log.Printf("other event: %s", event.Type)
 				}
@@ -110,3 +122,11 @@ func (w *websocket) PostMessage(ctx context.Context, message messagestore.Messag
 func (s *websocket) PostActionableMessage(ctx context.Context, nm messagestore.Message) error {
 	return postActionableMessage(ctx, s.client, nm)
 }
+
+func (s *websocket) PostEphemeralMessage(ctx context.Context, user string, nm messagestore.Message) error {
+	return postEphemeralContext(ctx, s.client, user, nm)
+}
+
+func (s *websocket) FetchThread(ctx context.Context, channel, thid string) ([]messagestore.Message, error) {
+	return fetchThread(ctx, s.client, channel, thid)
+}
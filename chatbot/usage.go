@@ -0,0 +1,136 @@
+package chatbot
+
+import (
+	"context"
+	"fmt"
+	"github.com/ku/chatbot-slack-llm/messagestore"
+	"log"
+	"sort"
+	"strings"
+	"time"
+)
+
+// ModelPrice is the price in USD per 1K tokens.
+type ModelPrice struct {
+	Prompt     float64
+	Completion float64
+}
+
+// Pricing maps model names to their prices.
+// A model matches the longest name which is a prefix of it, e.g. gpt-4-0613 matches gpt-4.
+type Pricing map[string]ModelPrice
+
+// https://openai.com/pricing
+var DefaultPricing = Pricing{
+	"gpt-3.5-turbo":     {Prompt: 0.0015, Completion: 0.002},
+	"gpt-3.5-turbo-16k": {Prompt: 0.003, Completion: 0.004},
+	"gpt-4":             {Prompt: 0.03, Completion: 0.06},
+	"gpt-4-32k":         {Prompt: 0.06, Completion: 0.12},
+}
+
+func (p Pricing) lookup(model string) (ModelPrice, bool) {
+	var found string
+	for name := range p {
+		if strings.HasPrefix(model, name) && len(name) > len(found) {
+			found = name
+		}
+	}
+	if found == "" {
+		return ModelPrice{}, false
+	}
+	return p[found], true
+}
+
+// Cost returns the price of the usage. Unknown models cost nothing.
+func (p Pricing) Cost(u messagestore.Usage) float64 {
+	price, ok := p.lookup(u.Model)
+	if !ok {
+		return 0
+	}
+	return (float64(u.PromptTokens)*price.Prompt + float64(u.CompletionTokens)*price.Completion) / 1000
+}
+
+// UsageSummary is the aggregated usage of a group.
+type UsageSummary struct {
+	Key              string
+	Requests         int
+	PromptTokens     int
+	CompletionTokens int
+	Cost             float64
+}
+
+func (s *UsageSummary) String() string {
+	return fmt.Sprintf("%s: %d requests, %d prompt + %d completion tokens, $%.4f",
+		s.Key, s.Requests, s.PromptTokens, s.CompletionTokens, s.Cost)
+}
+
+// SummarizeUsage groups the records by key and returns the summaries sorted by cost.
+func SummarizeUsage(records []*messagestore.UsageRecord, pricing Pricing, key func(r *messagestore.UsageRecord) string) []*UsageSummary {
+	groups := map[string]*UsageSummary{}
+	for _, r := range records {
+		k := key(r)
+		s, ok := groups[k]
+		if !ok {
+			s = &UsageSummary{Key: k}
+			groups[k] = s
+		}
+		s.Requests++
+		s.PromptTokens += r.PromptTokens
+		s.CompletionTokens += r.CompletionTokens
+		s.Cost += pricing.Cost(r.Usage)
+	}
+
+	summaries := make([]*UsageSummary, 0, len(groups))
+	for _, s := range groups {
+		summaries = append(summaries, s)
+	}
+	sort.Slice(summaries, func(i, j int) bool {
+		if summaries[i].Cost != summaries[j].Cost {
+			return summaries[i].Cost > summaries[j].Cost
+		}
+		return summaries[i].Key < summaries[j].Key
+	})
+	return summaries
+}
+
+// recordUsage counts the tokens toward the quotas and records the usage.
+// A failure of the quotas is only logged so that the usage reports don't miss the request.
+func (c *ChatBot) recordUsage(ctx context.Context, m messagestore.Message, u messagestore.Usage) error {
+	if limiter := c.limiter.Load(); limiter != nil {
+		if err := limiter.AddTokens(ctx, m, int64(u.TotalTokens())); err != nil {
+			log.Printf("quotas of %s are not updated: %s", m.GetThreadID(), err.Error())
+		}
+	}
+
+	us, ok := c.store.(messagestore.UsageStore)
+	if !ok {
+		return nil
+	}
+	return us.RecordUsage(ctx, &messagestore.UsageRecord{
+		Usage:     u,
+		ThreadID:  m.GetThreadID(),
+		Channel:   m.GetChannel(),
+		User:      m.GetFrom(),
+		CreatedAt: time.Now(),
+	})
+}
+
+func (c *ChatBot) threadUsage(ctx context.Context, thid string) (string, error) {
+	us, ok := c.store.(messagestore.UsageStore)
+	if !ok {
+		return "", fmt.Errorf("messagestore %s doesn't record usage", c.store.Name())
+	}
+	rs, err := us.ListUsage(ctx, &messagestore.UsageFilter{ThreadID: thid})
+	if err != nil {
+		return "", err
+	}
+	if len(rs) == 0 {
+		return "no usage recorded in this thread", nil
+	}
+
+	var lines []string
+	for _, s := range SummarizeUsage(rs, c.pricing, func(r *messagestore.UsageRecord) string { return r.Model }) {
+		lines = append(lines, s.String())
+	}
+	return strings.Join(lines, "\n"), nil
+}
@@ -0,0 +1,87 @@
+package chatbot
+
+import (
+	"context"
+	"errors"
+	"github.com/ku/chatbot-slack-llm/internal/conversation/memory"
+	"github.com/ku/chatbot-slack-llm/messagestore"
+	"github.com/slack-go/slack/slackevents"
+	"math"
+	"testing"
+	"time"
+)
+
+func TestPricing_Cost(t *testing.T) {
+	tests := map[string]struct {
+		usage messagestore.Usage
+		want  float64
+	}{
+		"exact": {
+			usage: messagestore.Usage{Model: "gpt-4", PromptTokens: 1000, CompletionTokens: 500},
+			want:  0.06,
+		},
+		"longest prefix": {
+			usage: messagestore.Usage{Model: "gpt-3.5-turbo-16k-0613", PromptTokens: 1000, CompletionTokens: 1000},
+			want:  0.007,
+		},
+		"unknown": {
+			usage: messagestore.Usage{Model: "echo", PromptTokens: 1000},
+			want:  0,
+		},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			if got := DefaultPricing.Cost(tt.usage); math.Abs(got-tt.want) > 1e-9 {
+				t.Errorf("Cost() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSummarizeUsage(t *testing.T) {
+	rs := []*messagestore.UsageRecord{
+		{Usage: messagestore.Usage{Model: "gpt-3.5-turbo", PromptTokens: 100, CompletionTokens: 10}, User: "U1"},
+		{Usage: messagestore.Usage{Model: "gpt-4", PromptTokens: 100, CompletionTokens: 10}, User: "U2"},
+		{Usage: messagestore.Usage{Model: "gpt-4", PromptTokens: 200, CompletionTokens: 20}, User: "U1"},
+	}
+	got := SummarizeUsage(rs, DefaultPricing, func(r *messagestore.UsageRecord) string { return r.Model })
+	if len(got) != 2 {
+		t.Fatalf("expected 2 groups, got %d", len(got))
+	}
+	if got[0].Key != "gpt-4" || got[0].Requests != 2 || got[0].PromptTokens != 300 || got[0].CompletionTokens != 30 {
+		t.Errorf("unexpected summary: %s", got[0])
+	}
+}
+
+type usageCounterStore interface {
+	messagestore.MessageStore
+	messagestore.UsageStore
+	messagestore.CounterStore
+}
+
+// brokenCounters fails to count while the usage can be recorded.
+type brokenCounters struct {
+	usageCounterStore
+}
+
+func (b *brokenCounters) IncrementCounter(context.Context, string, int64, time.Time) (int64, error) {
+	return 0, errors.New("counters are unavailable")
+}
+
+func TestChatBot_recordUsage(t *testing.T) {
+	ctx := context.Background()
+	store := &brokenCounters{memory.NewConversations("B1")}
+	c := New(store, &chatRecorder{}, nil, nil, "B1", WithRateLimit(&RateLimitConfig{UserDailyTokens: 100}))
+	m := messagestore.NewMessageFromMessage(&slackevents.MessageEvent{User: "U1", Channel: "C1", TimeStamp: "1.0"})
+
+	if err := c.recordUsage(ctx, m, messagestore.Usage{Model: "gpt-4", PromptTokens: 10}); err != nil {
+		t.Fatal(err)
+	}
+	rs, err := store.ListUsage(ctx, &messagestore.UsageFilter{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rs) != 1 || rs[0].PromptTokens != 10 {
+		t.Errorf("the usage should be recorded when the quota fails: %+v", rs)
+	}
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"fmt"
+	"github.com/ku/chatbot-slack-llm/internal/conversation/jsonl"
+	"github.com/spf13/cobra"
+	"io"
+	"log"
+	"os"
+)
+
+func buildExportCommand() *cobra.Command {
+	var output string
+	exportCmd := &cobra.Command{
+		Use:   "export",
+		Short: "export the conversations in the messagestore to JSON Lines",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			ms, err := newMessageStore(cmd.Context(), conf.Slack.BotID)
+			if err != nil {
+				return err
+			}
+
+			var w io.Writer = os.Stdout
+			var f *os.File
+			if output != "" && output != "-" {
+				if f, err = os.Create(output); err != nil {
+					return err
+				}
+				defer f.Close()
+				w = f
+			}
+			n, err := jsonl.Export(cmd.Context(), ms, w)
+			if err != nil {
+				return fmt.Errorf("failed to export: %w", err)
+			}
+			// a failed write may be reported on close, e.g. on a network file system.
+			if f != nil {
+				if err := f.Close(); err != nil {
+					return fmt.Errorf("failed to write %s: %w", output, err)
+				}
+			}
+			log.Printf("exported %d messages from %s", n, ms.Name())
+			return nil
+		},
+	}
+	exportCmd.Flags().StringVarP(&output, "output", "o", "-", "file to write, - for stdout")
+	return exportCmd
+}
+
+func buildImportCommand() *cobra.Command {
+	importCmd := &cobra.Command{
+		Use:   "import [file]",
+		Short: "import the conversations exported by export into the messagestore",
+		Args:  cobra.MaximumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			ms, err := newMessageStore(cmd.Context(), conf.Slack.BotID)
+			if err != nil {
+				return err
+			}
+
+			var r io.Reader = os.Stdin
+			if len(args) == 1 && args[0] != "-" {
+				f, err := os.Open(args[0])
+				if err != nil {
+					return err
+				}
+				defer f.Close()
+				r = f
+			}
+			n, err := jsonl.Import(cmd.Context(), ms, conf.Slack.BotID, r)
+			if err != nil {
+				return fmt.Errorf("failed to import after %d messages: %w", n, err)
+			}
+			log.Printf("imported %d messages into %s", n, ms.Name())
+			return nil
+		},
+	}
+	return importCmd
+}
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"fmt"
+	slack2 "github.com/ku/chatbot-slack-llm/chatbot/slack"
+	"github.com/ku/chatbot-slack-llm/internal/rag"
+	"github.com/ku/chatbot-slack-llm/messagestore"
+	"github.com/spf13/cobra"
+	"strings"
+)
+
+func buildIndexCommand() *cobra.Command {
+	var baseURL string
+	var chunkSize int
+	indexCmd := &cobra.Command{
+		Use:   "index <dir>",
+		Short: "index Markdown and text files for retrieval",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			idx, err := rag.LoadIndex(conf.Retrieval.Index)
+			if err != nil {
+				return err
+			}
+
+			ix := rag.NewIndexer(idx, newEmbedder(), chunkSize)
+			n, removed, err := ix.AddDir(cmd.Context(), args[0], baseURL)
+			if err != nil {
+				return fmt.Errorf("failed to index %s: %w", args[0], err)
+			}
+			if err := idx.Save(conf.Retrieval.Index); err != nil {
+				return fmt.Errorf("failed to save index: %w", err)
+			}
+			fmt.Printf("indexed %d files, removed %d files, %d chunks in %s\n", n, removed, idx.Len(), conf.Retrieval.Index)
+			return nil
+		},
+	}
+	indexCmd.Flags().StringVar(&baseURL, "base-url", "", "url the relative paths are joined to for the links, e.g. https://github.com/org/runbooks/blob/main")
+	indexCmd.Flags().IntVar(&chunkSize, "chunk-size", 1500, "max bytes of a chunk")
+	return indexCmd
+}
+
+func buildIndexSlackCommand() *cobra.Command {
+	var channels []string
+	var chunkSize int
+	indexSlackCmd := &cobra.Command{
+		Use:   "index-slack",
+		Short: "index the threads of Slack channels for retrieval",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			ctx := cmd.Context()
+			idx, err := rag.LoadIndex(conf.Retrieval.Index)
+			if err != nil {
+				return err
+			}
+
+			client := newSlackClient()
+			ix := rag.NewIndexer(idx, newEmbedder(), chunkSize)
+			for _, channel := range channels {
+				key := "slack:" + channel
+				var n int
+				err := slack2.FetchThreads(ctx, client, channel, idx.GetMeta(key), func(t *slack2.Thread) error {
+					if _, err := ix.Add(ctx, threadDocument(t)); err != nil {
+						return err
+					}
+					idx.SetMeta(key, t.LatestReply)
+					n++
+					// save the progress so that an interrupted run resumes from here.
+					return idx.Save(conf.Retrieval.Index)
+				})
+				if err != nil {
+					return fmt.Errorf("failed to index %s: %w", channel, err)
+				}
+				fmt.Printf("indexed %d threads of %s\n", n, channel)
+			}
+			return idx.Save(conf.Retrieval.Index)
+		},
+	}
+	indexSlackCmd.Flags().StringSliceVar(&channels, "channels", nil, "channel IDs to index")
+	indexSlackCmd.Flags().IntVar(&chunkSize, "chunk-size", 1500, "max bytes of a chunk")
+	_ = indexSlackCmd.MarkFlagRequired("channels")
+	return indexSlackCmd
+}
+
+// threadDocument formats the thread as a conversation titled by the first line of the question.
+func threadDocument(t *slack2.Thread) *rag.Document {
+	lines := make([]string, 0, len(t.Messages))
+	for _, m := range t.Messages {
+		lines = append(lines, fmt.Sprintf("<@%s>: %s", m.User, m.Text))
+	}
+
+	var title string
+	if len(t.Messages) > 0 {
+		title = strings.SplitN(messagestore.FilterSlackMention(t.Messages[0].Text), "\n", 2)[0]
+	}
+	if r := []rune(title); len(r) > 80 {
+		title = string(r[:80]) + "..."
+	}
+
+	return &rag.Document{
+		Source: fmt.Sprintf("slack:%s/%s", t.Channel, t.TS),
+		Title:  title,
+		URL:    t.Permalink,
+		Text:   strings.Join(lines, "\n\n"),
+	}
+}
@@ -6,14 +6,25 @@ import (
 	"fmt"
 	"github.com/ku/chatbot-slack-llm/chatbot"
 	slack2 "github.com/ku/chatbot-slack-llm/chatbot/slack"
+	"github.com/ku/chatbot-slack-llm/internal/config"
 	"github.com/ku/chatbot-slack-llm/internal/conversation/memory"
+	"github.com/ku/chatbot-slack-llm/internal/conversation/postgres"
+	"github.com/ku/chatbot-slack-llm/internal/conversation/redis"
 	"github.com/ku/chatbot-slack-llm/internal/conversation/spanner"
+	"github.com/ku/chatbot-slack-llm/internal/conversation/sqlite"
+	"github.com/ku/chatbot-slack-llm/internal/embedding"
 	"github.com/ku/chatbot-slack-llm/internal/llm"
+	"github.com/ku/chatbot-slack-llm/internal/llm/openai"
+	"github.com/ku/chatbot-slack-llm/internal/prompt"
+	"github.com/ku/chatbot-slack-llm/internal/rag"
 	"github.com/ku/chatbot-slack-llm/internal/responder"
+	"github.com/ku/chatbot-slack-llm/internal/semanticcache"
 	"github.com/ku/chatbot-slack-llm/messagestore"
+	goredis "github.com/redis/go-redis/v9"
 	"github.com/slack-go/slack"
 	"github.com/spf13/cobra"
 	"os"
+	"strings"
 )
 
 type slackClientWrapper struct {
@@ -36,81 +47,325 @@ func _main() error {
 }
 
 var opts struct {
-	llm     string
-	store   string
-	chat    string
-	webhook string
+	config   string
+	personas string
 }
 
+// flagConf is built from the flags and the environment variables when --config isn't given.
+var flagConf = config.Default()
+
+// conf is the config in effect, loaded before any command runs.
+var conf *config.Config
+
+// responderNames are the responders the personas can allow.
+var responderNames = []string{chatbot.DefaultResponder}
+
 func buildCommand() *cobra.Command {
 	var rootCmd = &cobra.Command{
 		Use:   "chatbot",
 		Short: "llm chatbot",
+		PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
+			var err error
+			conf, err = loadConfig()
+			return err
+		},
 		RunE: func(cmd *cobra.Command, args []string) error {
 			return start()
 		},
 	}
 
-	rootCmd.PersistentFlags().StringVarP(&opts.llm, "llm", "l", "echo", "llm service [openai|echo]")
-	rootCmd.PersistentFlags().StringVarP(&opts.store, "messagestore", "m", "memory", "messagestore [memory|spanner]")
-	rootCmd.PersistentFlags().StringVarP(&opts.chat, "chat", "c", "websocket", "chat service [websocket|webhook]")
-	rootCmd.PersistentFlags().StringVarP(&opts.webhook, "webhook", "w", "", "use incoming webhook to send message")
+	f := flagConf
+	rootCmd.PersistentFlags().StringVar(&opts.config, "config", "", "yaml config file, see config.sample.yaml. The other flags are ignored when it's given")
+	rootCmd.PersistentFlags().StringVarP(&f.LLM.Backend, "llm", "l", f.LLM.Backend, "llm service [openai|echo]")
+	rootCmd.PersistentFlags().StringVar(&f.LLM.Model, "model", "", "model of the llm service (default gpt-3.5-turbo for openai)")
+	rootCmd.PersistentFlags().StringSliceVar(&f.LLM.Models, "models", nil, "models which can be chosen in a thread or a channel (default "+strings.Join(chatbot.DefaultModels, ",")+")")
+	rootCmd.PersistentFlags().StringSliceVar(&f.LLM.Fallback, "fallback", nil, "llm services tried in order when the llm fails, e.g. openai:gpt-3.5-turbo-16k,echo")
+	rootCmd.PersistentFlags().IntVar(&f.LLM.Retries, "retries", llm.DefaultRetryConfig().MaxRetries, "max retries of transient llm errors per service")
+	rootCmd.PersistentFlags().IntVar(&f.LLM.BreakerThreshold, "breaker-threshold", llm.DefaultBreakerConfig().FailureThreshold, "consecutive llm failures to stop calling the service")
+	rootCmd.PersistentFlags().DurationVar(&f.LLM.BreakerCooldown, "breaker-cooldown", llm.DefaultBreakerConfig().Cooldown, "duration until a stopped llm service is tried again")
+	rootCmd.PersistentFlags().DurationVar(&f.Cache.TTL, "cache-ttl", 0, "cache llm responses to identical prompts for the duration (0 = disabled)")
+	rootCmd.PersistentFlags().IntVar(&f.Cache.Size, "cache-size", f.Cache.Size, "max number of responses cached in memory")
+	rootCmd.PersistentFlags().BoolVar(&f.Cache.InStore, "cache-in-store", false, "also cache responses in the messagestore (not memory)")
+	rootCmd.PersistentFlags().Float32Var(&f.Cache.SemanticThreshold, "semantic-threshold", 0, "offer the answer to a question more similar than the threshold, e.g. 0.95 (0 = disabled)")
+	rootCmd.PersistentFlags().StringVar(&f.Retrieval.EmbeddingURL, "embedding-url", f.Retrieval.EmbeddingURL, "base url of an openai compatible embeddings api")
+	rootCmd.PersistentFlags().StringVar(&f.Retrieval.EmbeddingModel, "embedding-model", f.Retrieval.EmbeddingModel, "embedding model")
+	rootCmd.PersistentFlags().StringVar(&f.Retrieval.Index, "index", f.Retrieval.Index, "retrieval index file built by the index command")
+	rootCmd.PersistentFlags().IntVar(&f.Retrieval.TopK, "top-k", f.Retrieval.TopK, "number of indexed chunks injected into the prompt")
+	rootCmd.PersistentFlags().Float32Var(&f.Retrieval.MinScore, "min-score", f.Retrieval.MinScore, "min similarity of an indexed chunk to be injected into the prompt")
+	rootCmd.PersistentFlags().StringVar(&f.LLM.Prompt, "prompt", f.LLM.Prompt, "system prompt template, see prompt.sample.txt")
+	rootCmd.PersistentFlags().StringVar(&opts.personas, "personas", "", "yaml file mapping channels to personas, see personas.sample.yaml")
+	rootCmd.PersistentFlags().StringVarP(&f.MessageStore.Type, "messagestore", "m", f.MessageStore.Type, "messagestore [memory|sqlite|postgres|redis|spanner]")
+	rootCmd.PersistentFlags().StringVar(&f.MessageStore.SQLitePath, "sqlite-path", f.MessageStore.SQLitePath, "database file of the sqlite messagestore")
+	rootCmd.PersistentFlags().IntVar(&f.MessageStore.MaxConversations, "max-conversations", f.MessageStore.MaxConversations, "max number of conversations kept in the memory messagestore (0 = unlimited)")
+	rootCmd.PersistentFlags().DurationVar(&f.MessageStore.IdleTTL, "conversation-ttl", f.MessageStore.IdleTTL, "drop conversations idle for the duration from the memory and redis messagestores (0 = never)")
+	rootCmd.PersistentFlags().StringVarP(&f.Slack.Mode, "chat", "c", f.Slack.Mode, "chat service [websocket|webhook]")
+	rootCmd.PersistentFlags().StringSliceVar(&f.Slack.Admins, "admins", nil, "user IDs allowed to run the debug commands and /chatbot")
+	rootCmd.PersistentFlags().BoolVar(&f.Slack.RegenerateOnEdit, "regenerate-on-edit", false, "answer again when the last question is edited")
+	rootCmd.PersistentFlags().StringVarP(&f.Slack.APIURL, "webhook", "w", "", "use incoming webhook to send message")
+	rootCmd.PersistentFlags().IntVar(&f.Dispatcher.MaxConcurrency, "max-concurrency", f.Dispatcher.MaxConcurrency, "max number of llm completions running at the same time")
+	rootCmd.PersistentFlags().IntVar(&f.Dispatcher.MaxQueueDepth, "max-queue-depth", f.Dispatcher.MaxQueueDepth, "max number of messages waiting for a reply in a thread")
+	rootCmd.PersistentFlags().Int64Var(&f.RateLimit.UserRequestsPerMinute, "user-rpm", 0, "max requests per minute per user (0 = unlimited)")
+	rootCmd.PersistentFlags().Int64Var(&f.RateLimit.ChannelRequestsPerMinute, "channel-rpm", 0, "max requests per minute per channel (0 = unlimited)")
+	rootCmd.PersistentFlags().Int64Var(&f.RateLimit.UserDailyTokens, "user-daily-tokens", 0, "max tokens per day per user (0 = unlimited)")
+	rootCmd.PersistentFlags().Int64Var(&f.RateLimit.ChannelDailyTokens, "channel-daily-tokens", 0, "max tokens per day per channel (0 = unlimited)")
+	rootCmd.AddCommand(buildUsageCommand())
+	rootCmd.AddCommand(buildIndexCommand())
+	rootCmd.AddCommand(buildIndexSlackCommand())
+	rootCmd.AddCommand(buildMigrateCommand())
+	rootCmd.AddCommand(buildExportCommand())
+	rootCmd.AddCommand(buildImportCommand())
 	return rootCmd
 }
 
-func start() error {
-	ctx := context.Background()
-	botID := os.Getenv("CHATBOT_BOT_ID")
+// loadConfig loads --config, or builds the config from the flags and the environment variables.
+func loadConfig() (*config.Config, error) {
+	if opts.config != "" {
+		return config.Load(opts.config, responderNames)
+	}
 
-	var llmClient chatbot.LLMClient
-	var ms messagestore.MessageStore
-	var chat chatbot.ChatService
+	c := flagConf
+	c.Slack.BotID = os.Getenv("CHATBOT_BOT_ID")
+	c.Slack.BotToken = os.Getenv("SLACK_BOT_TOKEN")
+	c.Slack.AppToken = os.Getenv("SLACK_APP_TOKEN")
+	c.Slack.SigningSecret = os.Getenv("SLACK_SIGNING_SECRET")
+	c.LLM.APIKey = os.Getenv("OPENAI_API_KEY")
+	c.MessageStore.SpannerDSN = os.Getenv("CHATBOT_SPANNER_DSN")
+	c.MessageStore.PostgresDSN = os.Getenv("CHATBOT_POSTGRES_DSN")
+	c.MessageStore.RedisURL = os.Getenv("CHATBOT_REDIS_URL")
+	if opts.personas != "" {
+		p, err := config.LoadPersonas(opts.personas, responderNames)
+		if err != nil {
+			return nil, err
+		}
+		c.Personas = p
+	}
+	if err := c.Validate(responderNames); err != nil {
+		return nil, fmt.Errorf("invalid flags: %w", err)
+	}
+	return c, nil
+}
 
-	if opts.llm == "openai" {
-		openaiApiKey := os.Getenv("OPENAI_API_KEY")
-		llmClient = chatbot.NewOpenAIClient(openaiApiKey, func() (string, error) {
-			b, err := os.ReadFile("./prompt.txt")
-			return string(b), err
-		})
-	} else {
-		llmClient = llm.NewEcho()
+func newCacheStores(ms messagestore.MessageStore) []messagestore.ResponseCacheStore {
+	var cacheStores []messagestore.ResponseCacheStore
+	if conf.Cache.TTL > 0 {
+		cacheStores = append(cacheStores, llm.NewLRUCache(conf.Cache.Size))
+		if cs, ok := ms.(messagestore.ResponseCacheStore); ok && conf.Cache.InStore {
+			cacheStores = append(cacheStores, cs)
+		}
+	}
+	return cacheStores
+}
+
+// newLLMChain builds the llm of the persona and the fallbacks, which answer with the prompt of the persona.
+// Each service is wrapped by a circuit breaker, then by the response cache.
+func newLLMChain(c *config.Config, cacheStores []messagestore.ResponseCacheStore, retriever openai.Retriever, persona *config.Persona) (chatbot.LLMClient, error) {
+	specs := append([]string{persona.LLM + ":" + persona.Model}, c.LLM.Fallback...)
+	var p *prompt.File
+	llmClients := make([]chatbot.LLMClient, len(specs))
+	for i, spec := range specs {
+		backend, model, _ := strings.Cut(spec, ":")
+		// the template is parsed here so that a broken prompt stops the bot at startup.
+		if backend == "openai" && p == nil {
+			var err error
+			if p, err = prompt.Load(persona.Prompt); err != nil {
+				return nil, err
+			}
+		}
+		var client chatbot.LLMClient = llm.NewBreaker(&llm.BreakerConfig{
+			FailureThreshold: c.LLM.BreakerThreshold,
+			Cooldown:         c.LLM.BreakerCooldown,
+		}, newLLMClient(c, backend, model, persona.Temperature, retriever, p))
+		if len(cacheStores) > 0 {
+			client = llm.NewCache(&llm.CacheConfig{TTL: c.Cache.TTL}, client, cacheStores...)
+		}
+		llmClients[i] = client
 	}
 
-	if opts.store == "spanner" {
-		dsn := os.Getenv("CHATBOT_SPANNER_DSN")
-		spc, err := gospanner.NewClient(ctx, dsn)
+	retryConf := llm.DefaultRetryConfig()
+	retryConf.MaxRetries = c.LLM.Retries
+	return llm.NewFallback(retryConf, llmClients...), nil
+}
+
+func newLLMClient(c *config.Config, backend, model string, temperature float32, retriever openai.Retriever, p openai.Prompt) chatbot.LLMClient {
+	if backend != "openai" {
+		return llm.NewEcho()
+	}
+
+	llmOpts := []openai.Option{
+		openai.WithTemperature(temperature),
+	}
+	if model != "" {
+		llmOpts = append(llmOpts, openai.WithModel(model))
+	}
+	if retriever != nil {
+		llmOpts = append(llmOpts, openai.WithRetriever(retriever))
+	}
+	return chatbot.NewOpenAIClient(c.LLM.APIKey, p, llmOpts...)
+}
+
+// newRetriever returns nil when the index is empty.
+func newRetriever() (openai.Retriever, error) {
+	idx, err := rag.LoadIndex(conf.Retrieval.Index)
+	if err != nil {
+		return nil, err
+	}
+	if idx.Len() == 0 {
+		return nil, nil
+	}
+	return rag.NewRetriever(idx, newEmbedder(), conf.Retrieval.TopK, conf.Retrieval.MinScore), nil
+}
+
+func newEmbedder() embedding.Embedder {
+	return embedding.NewHTTPEmbedder(&embedding.HTTPConfig{
+		BaseURL: conf.Retrieval.EmbeddingURL,
+		APIKey:  conf.LLM.APIKey,
+		Model:   conf.Retrieval.EmbeddingModel,
+	})
+}
+
+// newPersonas builds the llm of each persona, or of the llm section when no personas are configured.
+func newPersonas(c *config.Config, cacheStores []messagestore.ResponseCacheStore, retriever openai.Retriever) (*chatbot.Personas, error) {
+	if c.Personas == nil {
+		client, err := newLLMChain(c, cacheStores, retriever, c.LLM.Persona())
+		if err != nil {
+			return nil, err
+		}
+		return &chatbot.Personas{
+			Default: &chatbot.Persona{
+				Name:       "default",
+				LLM:        client,
+				Responders: []string{chatbot.DefaultResponder},
+				RunButtons: true,
+			},
+		}, nil
+	}
+
+	personas := &chatbot.Personas{
+		Channels: make(map[string]*chatbot.Persona),
+		Named:    make(map[string]*chatbot.Persona),
+	}
+	for name, pc := range c.Personas.Personas {
+		client, err := newLLMChain(c, cacheStores, retriever, pc)
 		if err != nil {
-			return fmt.Errorf("failed to create spanner client: %w", err)
+			return nil, fmt.Errorf("persona %s: %w", name, err)
 		}
-		ms = spanner.NewConversations(botID, spc)
+		personas.Named[name] = &chatbot.Persona{
+			Name:       name,
+			LLM:        client,
+			Responders: pc.Responders,
+			RunButtons: pc.RunButtons,
+		}
+	}
+	personas.Default = personas.Named[c.Personas.Default]
+	for channel, name := range c.Personas.Channels {
+		personas.Channels[channel] = personas.Named[name]
+	}
+	return personas, nil
+}
+
+func rateLimitConfig(c *config.Config) *chatbot.RateLimitConfig {
+	return &chatbot.RateLimitConfig{
+		UserRequestsPerMinute:    c.RateLimit.UserRequestsPerMinute,
+		ChannelRequestsPerMinute: c.RateLimit.ChannelRequestsPerMinute,
+		UserDailyTokens:          c.RateLimit.UserDailyTokens,
+		ChannelDailyTokens:       c.RateLimit.ChannelDailyTokens,
+	}
+}
+
+// pricing returns the default prices with the ones in the config.
+func pricing(c *config.Config) chatbot.Pricing {
+	p := chatbot.Pricing{}
+	for model, price := range chatbot.DefaultPricing {
+		p[model] = price
+	}
+	for model, price := range c.Pricing {
+		p[model] = chatbot.ModelPrice{Prompt: price.Prompt, Completion: price.Completion}
+	}
+	return p
+}
+
+func newSlackClient() *slack.Client {
+	slackOpts := []slack.Option{
+		slack.OptionDebug(true),
+	}
+	if conf.Slack.APIURL == "" {
+		slackOpts = append(slackOpts, slack.OptionAppLevelToken(conf.Slack.AppToken))
 	} else {
-		ms = memory.NewConversations(botID)
+		slackOpts = append(slackOpts, slack.OptionAPIURL(conf.Slack.APIURL+"?"))
 	}
 
-	{
-		botToken := os.Getenv("SLACK_BOT_TOKEN")
-		appToken := os.Getenv("SLACK_APP_TOKEN")
+	return slack.New(conf.Slack.BotToken, slackOpts...)
+}
 
-		slackOpts := []slack.Option{
-			slack.OptionDebug(true),
+func newMessageStore(ctx context.Context, botID string) (messagestore.MessageStore, error) {
+	if conf.MessageStore.Type == "spanner" {
+		spc, err := gospanner.NewClient(ctx, conf.MessageStore.SpannerDSN)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create spanner client: %w", err)
 		}
-		if opts.webhook == "" {
-			slackOpts = append(slackOpts, slack.OptionAppLevelToken(appToken))
-		} else {
-			slackOpts = append(slackOpts, slack.OptionAPIURL(opts.webhook+"?"))
+		return spanner.NewConversations(botID, spc), nil
+	}
+	if conf.MessageStore.Type == "postgres" {
+		db, err := postgres.Open(ctx, conf.MessageStore.PostgresDSN)
+		if err != nil {
+			return nil, err
+		}
+		return postgres.NewConversations(botID, db), nil
+	}
+	if conf.MessageStore.Type == "redis" {
+		ro, err := goredis.ParseURL(conf.MessageStore.RedisURL)
+		if err != nil {
+			return nil, fmt.Errorf("invalid redis url: %w", err)
+		}
+		return redis.NewConversations(botID, goredis.NewClient(ro), redis.WithTTL(conf.MessageStore.IdleTTL)), nil
+	}
+	if conf.MessageStore.Type == "sqlite" {
+		db, err := sqlite.Open(ctx, conf.MessageStore.SQLitePath)
+		if err != nil {
+			return nil, err
 		}
+		return sqlite.NewConversations(botID, db), nil
+	}
+	return memory.NewConversations(botID,
+		memory.WithMaxConversations(conf.MessageStore.MaxConversations),
+		memory.WithIdleTTL(conf.MessageStore.IdleTTL),
+	), nil
+}
 
-		slackClient := slack.New(botToken, slackOpts...)
+func start() error {
+	ctx := context.Background()
+	botID := conf.Slack.BotID
 
-		if opts.chat == "websocket" {
+	var chat chatbot.ChatService
+
+	ms, err := newMessageStore(ctx, botID)
+	if err != nil {
+		return err
+	}
+
+	retriever, err := newRetriever()
+	if err != nil {
+		return err
+	}
+	cacheStores := newCacheStores(ms)
+	personas, err := newPersonas(conf, cacheStores, retriever)
+	if err != nil {
+		return err
+	}
+
+	{
+		slackClient := newSlackClient()
+
+		if conf.Slack.Mode == "websocket" {
 			chat = slack2.NewWebsocket(&slack2.WebsocketConfig{}, slackClient)
 		} else {
 			chat = slack2.NewWebHook(&slack2.WebHookConfig{
-				SigningSecret: os.Getenv("SLACK_SIGNING_SECRET"),
+				SigningSecret: conf.Slack.SigningSecret,
 				HTTP: &slack2.WebHookHTTPConfig{
-					Addr:                  "localhost:3000",
-					EventSubscriptionPath: "/subscription",
-					InteractionPath:       "/interaction",
+					Addr:                  conf.Slack.HTTP.Addr,
+					EventSubscriptionPath: conf.Slack.HTTP.EventSubscriptionPath,
+					InteractionPath:       conf.Slack.HTTP.InteractionPath,
+					SlashCommandPath:      conf.Slack.HTTP.SlashCommandPath,
 				},
 			}, slackClient)
 		}
@@ -118,7 +373,55 @@ func start() error {
 
 	responder := responder.NewBashResponder()
 
-	cb = chatbot.New(ms, chat, llmClient, responder, botID)
+	dispatcher := chatbot.NewDispatcher(&chatbot.DispatcherConfig{
+		MaxConcurrency: conf.Dispatcher.MaxConcurrency,
+		MaxQueueDepth:  conf.Dispatcher.MaxQueueDepth,
+		MaxPending:     chatbot.DefaultDispatcherConfig().MaxPending,
+	})
+
+	cbOpts := []chatbot.Option{
+		chatbot.WithDispatcher(dispatcher),
+		chatbot.WithRateLimit(rateLimitConfig(conf)),
+		chatbot.WithPersonas(personas),
+		chatbot.WithAdmins(conf.Slack.Admins...),
+		chatbot.WithPricing(pricing(conf)),
+	}
+	if len(conf.LLM.Models) > 0 {
+		cbOpts = append(cbOpts, chatbot.WithModels(conf.LLM.Models...))
+	}
+	if conf.Slack.RegenerateOnEdit {
+		cbOpts = append(cbOpts, chatbot.WithRegenerateOnEdit())
+	}
+	if conf.Cache.SemanticThreshold > 0 {
+		cbOpts = append(cbOpts, chatbot.WithSemanticCache(semanticcache.New(&semanticcache.Config{
+			Threshold:  conf.Cache.SemanticThreshold,
+			MaxEntries: conf.Cache.Size,
+			TTL:        conf.Cache.TTL,
+		}, newEmbedder())))
+	}
+
+	var w *config.Watcher
+	if opts.config != "" {
+		// the llm, personas, models and rate limits are rebuilt from the new config and swapped in.
+		w = config.NewWatcher(opts.config, conf, responderNames, func(c *config.Config) error {
+			p, err := newPersonas(c, cacheStores, retriever)
+			if err != nil {
+				return err
+			}
+			cb.SetPersonas(p)
+			cb.SetRateLimit(rateLimitConfig(c))
+			cb.SetModels(c.LLM.Models)
+			return nil
+		})
+		cbOpts = append(cbOpts, chatbot.WithReloader(w.Reload))
+	}
+
+	cb = chatbot.New(ms, chat, personas.Default.LLM, responder, botID, cbOpts...)
+	// the watcher starts after the bot is built since it swaps the personas of the bot.
+	if w != nil {
+		go w.Run(ctx)
+	}
+
 	chat.SetEventListener(cb)
 	return chat.Run(ctx)
 }
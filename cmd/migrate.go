@@ -0,0 +1,31 @@
+package main
+
+import (
+	"fmt"
+	"github.com/ku/chatbot-slack-llm/internal/conversation/spanner"
+	"github.com/spf13/cobra"
+)
+
+func buildMigrateCommand() *cobra.Command {
+	var create bool
+	var baseline int64
+	migrateCmd := &cobra.Command{
+		Use:   "migrate",
+		Short: "apply the Spanner schema to CHATBOT_SPANNER_DSN",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			dsn := conf.MessageStore.SpannerDSN
+			if dsn == "" {
+				return fmt.Errorf("CHATBOT_SPANNER_DSN is not set")
+			}
+			if create {
+				if err := spanner.CreateEmulatorDatabase(cmd.Context(), dsn); err != nil {
+					return err
+				}
+			}
+			return spanner.Migrate(cmd.Context(), dsn, conf.Slack.BotID, baseline)
+		},
+	}
+	migrateCmd.Flags().BoolVar(&create, "create", false, "create the instance and the database in the emulator given by SPANNER_EMULATOR_HOST")
+	migrateCmd.Flags().Int64Var(&baseline, "baseline", 0, "record the migrations up to this version as applied without running them")
+	return migrateCmd
+}
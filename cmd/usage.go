@@ -0,0 +1,85 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"github.com/ku/chatbot-slack-llm/chatbot"
+	"github.com/ku/chatbot-slack-llm/messagestore"
+	"github.com/spf13/cobra"
+	"time"
+)
+
+const dateLayout = "2006-01-02"
+
+func buildUsageCommand() *cobra.Command {
+	usageCmd := &cobra.Command{
+		Use:   "usage",
+		Short: "token usage",
+	}
+
+	now := time.Now()
+	var from, to, by string
+	reportCmd := &cobra.Command{
+		Use:   "report",
+		Short: "aggregate token usage and cost over a date range",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return reportUsage(cmd.Context(), from, to, by)
+		},
+	}
+	reportCmd.Flags().StringVar(&from, "from", now.Format("2006-01")+"-01", "first date of the range (inclusive)")
+	reportCmd.Flags().StringVar(&to, "to", now.Format(dateLayout), "last date of the range (inclusive)")
+	reportCmd.Flags().StringVar(&by, "by", "model", "group by [model|user|channel|thread]")
+
+	usageCmd.AddCommand(reportCmd)
+	return usageCmd
+}
+
+func reportUsage(ctx context.Context, from, to, by string) error {
+	f, err := time.ParseInLocation(dateLayout, from, time.Local)
+	if err != nil {
+		return fmt.Errorf("invalid --from: %w", err)
+	}
+	t, err := time.ParseInLocation(dateLayout, to, time.Local)
+	if err != nil {
+		return fmt.Errorf("invalid --to: %w", err)
+	}
+
+	keys := map[string]func(r *messagestore.UsageRecord) string{
+		"model":   func(r *messagestore.UsageRecord) string { return r.Model },
+		"user":    func(r *messagestore.UsageRecord) string { return r.User },
+		"channel": func(r *messagestore.UsageRecord) string { return r.Channel },
+		"thread":  func(r *messagestore.UsageRecord) string { return r.Channel + "/" + r.ThreadID },
+	}
+	key, ok := keys[by]
+	if !ok {
+		return fmt.Errorf("invalid --by: %s", by)
+	}
+
+	ms, err := newMessageStore(ctx, conf.Slack.BotID)
+	if err != nil {
+		return err
+	}
+	us, ok := ms.(messagestore.UsageStore)
+	if !ok {
+		return fmt.Errorf("messagestore %s doesn't record usage", ms.Name())
+	}
+
+	rs, err := us.ListUsage(ctx, &messagestore.UsageFilter{
+		From: f,
+		To:   t.AddDate(0, 0, 1),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to list usage: %w", err)
+	}
+
+	total := &chatbot.UsageSummary{Key: "total"}
+	for _, s := range chatbot.SummarizeUsage(rs, pricing(conf), key) {
+		fmt.Println(s.String())
+		total.Requests += s.Requests
+		total.PromptTokens += s.PromptTokens
+		total.CompletionTokens += s.CompletionTokens
+		total.Cost += s.Cost
+	}
+	fmt.Println(total.String())
+	return nil
+}
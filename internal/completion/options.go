@@ -0,0 +1,57 @@
+// Package completion carries per-request options of llm completions through the context
+// so that decorators and backends can read them without depending on chatbot.
+package completion
+
+import (
+	"context"
+	"sync"
+)
+
+type Options struct {
+	// NoCache makes the response caches ask the model again.
+	NoCache bool
+
+	// Model replaces the model of the primary llm, e.g. by a command in the thread.
+	Model string
+
+	// UserName and ChannelName are the display names for the prompt template.
+	UserName    string
+	ChannelName string
+
+	// Trace receives the request and the response when debug is on in the thread.
+	Trace *Trace
+}
+
+// Trace keeps the last request sent to the llm and its raw response.
+type Trace struct {
+	mu       sync.Mutex
+	request  string
+	response string
+}
+
+func (t *Trace) Record(request, response string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.request = request
+	t.response = response
+}
+
+func (t *Trace) Get() (request, response string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.request, t.response
+}
+
+type optionsKey struct{}
+
+func WithOptions(ctx context.Context, o *Options) context.Context {
+	return context.WithValue(ctx, optionsKey{}, o)
+}
+
+// OptionsFrom returns the options in the context, or the zero options.
+func OptionsFrom(ctx context.Context) *Options {
+	if o, ok := ctx.Value(optionsKey{}).(*Options); ok {
+		return o
+	}
+	return &Options{}
+}
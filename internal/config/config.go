@@ -0,0 +1,271 @@
+package config
+
+import (
+	"bytes"
+	"fmt"
+	"gopkg.in/yaml.v3"
+	"os"
+	"strings"
+	"time"
+)
+
+// Config is the configuration file of the bot. See config.sample.yaml.
+// ${VAR} in the file is replaced with the environment variable so that secrets can be kept out of it.
+type Config struct {
+	Slack        Slack        `yaml:"slack"`
+	LLM          LLM          `yaml:"llm"`
+	Cache        Cache        `yaml:"cache"`
+	Retrieval    Retrieval    `yaml:"retrieval"`
+	MessageStore MessageStore `yaml:"messagestore"`
+	Dispatcher   Dispatcher   `yaml:"dispatcher"`
+	RateLimit    RateLimit    `yaml:"rate_limit"`
+	// Pricing adds or replaces the prices of the models in the usage reports.
+	Pricing map[string]Price `yaml:"pricing"`
+	// Personas are optional. The llm section is the only persona without them.
+	Personas *Personas `yaml:"personas"`
+}
+
+type Slack struct {
+	// Mode is websocket or webhook.
+	Mode  string `yaml:"mode"`
+	BotID string `yaml:"bot_id"`
+	// Admins are the user IDs allowed to run the debug commands and the slash commands.
+	Admins []string `yaml:"admins"`
+	// RegenerateOnEdit answers again when the last question in a thread is edited.
+	RegenerateOnEdit bool   `yaml:"regenerate_on_edit"`
+	BotToken         string `yaml:"bot_token" secret:"true"`
+	AppToken         string `yaml:"app_token" secret:"true"`
+	SigningSecret    string `yaml:"signing_secret" secret:"true"`
+	// APIURL replaces the Slack API, e.g. with an incoming webhook.
+	APIURL string `yaml:"api_url"`
+	HTTP   HTTP   `yaml:"http"`
+}
+
+// HTTP is the server receiving the events in webhook mode.
+type HTTP struct {
+	Addr                  string `yaml:"addr"`
+	EventSubscriptionPath string `yaml:"event_subscription_path"`
+	InteractionPath       string `yaml:"interaction_path"`
+	// SlashCommandPath receives the admin commands, e.g. "/chatbot status".
+	SlashCommandPath string `yaml:"slash_command_path"`
+}
+
+// LLM is the persona without personas, and the settings shared by all the personas.
+type LLM struct {
+	// Backend is openai or echo.
+	Backend     string  `yaml:"backend"`
+	Model       string  `yaml:"model"`
+	Prompt      string  `yaml:"prompt"`
+	Temperature float32 `yaml:"temperature"`
+	APIKey      string  `yaml:"api_key" secret:"true"`
+	// Models can be chosen in a thread or a channel. Empty is the default ones of the bot.
+	Models []string `yaml:"models"`
+	// Fallback are backend:model tried in order when the llm fails.
+	Fallback         []string      `yaml:"fallback"`
+	Retries          int           `yaml:"retries"`
+	BreakerThreshold int           `yaml:"breaker_threshold"`
+	BreakerCooldown  time.Duration `yaml:"breaker_cooldown"`
+}
+
+// Persona returns the llm section as a persona, which is used when no personas are configured.
+// The responders are left to the bot.
+func (l *LLM) Persona() *Persona {
+	return &Persona{
+		Prompt:      l.Prompt,
+		LLM:         l.Backend,
+		Model:       l.Model,
+		Temperature: l.Temperature,
+		RunButtons:  true,
+	}
+}
+
+type Cache struct {
+	TTL               time.Duration `yaml:"ttl"`
+	Size              int           `yaml:"size"`
+	InStore           bool          `yaml:"in_store"`
+	SemanticThreshold float32       `yaml:"semantic_threshold"`
+}
+
+type Retrieval struct {
+	Index string `yaml:"index"`
+	TopK  int    `yaml:"top_k"`
+	// MinScore is the min cosine similarity of a chunk to the question to be injected and cited.
+	MinScore       float32 `yaml:"min_score"`
+	EmbeddingURL   string  `yaml:"embedding_url"`
+	EmbeddingModel string  `yaml:"embedding_model"`
+}
+
+type MessageStore struct {
+	// Type is memory, sqlite, postgres, redis or spanner.
+	Type        string `yaml:"type"`
+	SpannerDSN  string `yaml:"spanner_dsn"`
+	PostgresDSN string `yaml:"postgres_dsn" secret:"true"`
+	RedisURL    string `yaml:"redis_url" secret:"true"`
+	// SQLitePath is the database file created on the first run.
+	SQLitePath string `yaml:"sqlite_path"`
+	// MaxConversations bounds the memory store, and IdleTTL the memory and redis stores. 0 is unlimited.
+	MaxConversations int           `yaml:"max_conversations"`
+	IdleTTL          time.Duration `yaml:"idle_ttl"`
+}
+
+type Dispatcher struct {
+	MaxConcurrency int `yaml:"max_concurrency"`
+	MaxQueueDepth  int `yaml:"max_queue_depth"`
+}
+
+// RateLimit is zero for unlimited.
+type RateLimit struct {
+	UserRequestsPerMinute    int64 `yaml:"user_rpm"`
+	ChannelRequestsPerMinute int64 `yaml:"channel_rpm"`
+	UserDailyTokens          int64 `yaml:"user_daily_tokens"`
+	ChannelDailyTokens       int64 `yaml:"channel_daily_tokens"`
+}
+
+// Price is the price in USD per 1K tokens. A model matches the longest name which is a prefix of it.
+type Price struct {
+	Prompt     float64 `yaml:"prompt"`
+	Completion float64 `yaml:"completion"`
+}
+
+// Default returns the defaults of the flags.
+func Default() *Config {
+	return &Config{
+		Slack: Slack{
+			Mode: "websocket",
+			HTTP: HTTP{
+				Addr:                  "localhost:3000",
+				EventSubscriptionPath: "/subscription",
+				InteractionPath:       "/interaction",
+				SlashCommandPath:      "/command",
+			},
+		},
+		LLM: LLM{
+			Backend:          "echo",
+			Prompt:           "./prompt.txt",
+			Retries:          2,
+			BreakerThreshold: 5,
+			BreakerCooldown:  time.Minute,
+		},
+		Cache: Cache{
+			Size: 1000,
+		},
+		Retrieval: Retrieval{
+			Index:          "./index.json",
+			TopK:           3,
+			MinScore:       0.75,
+			EmbeddingURL:   "https://api.openai.com/v1",
+			EmbeddingModel: "text-embedding-ada-002",
+		},
+		MessageStore: MessageStore{
+			Type:             "memory",
+			SQLitePath:       "./chatbot.db",
+			MaxConversations: 10000,
+			IdleTTL:          24 * time.Hour,
+		},
+		Dispatcher: Dispatcher{
+			MaxConcurrency: 4,
+			MaxQueueDepth:  3,
+		},
+	}
+}
+
+// Load reads the file over the defaults and validates it.
+func Load(path string, responders []string) (*Config, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read config: %w", err)
+	}
+
+	conf := Default()
+	dec := yaml.NewDecoder(bytes.NewReader([]byte(os.ExpandEnv(string(b)))))
+	dec.KnownFields(true)
+	if err := dec.Decode(conf); err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", path, err)
+	}
+	if err := conf.Validate(responders); err != nil {
+		return nil, fmt.Errorf("invalid %s: %w", path, err)
+	}
+	return conf, nil
+}
+
+func oneOf(field, value string, values ...string) error {
+	for _, v := range values {
+		if v == value {
+			return nil
+		}
+	}
+	return fmt.Errorf("%s: %q is not one of %v", field, value, values)
+}
+
+// Validate checks the values which would fail later, e.g. at the first message.
+func (c *Config) Validate(responders []string) error {
+	if err := oneOf("slack.mode", c.Slack.Mode, "websocket", "webhook"); err != nil {
+		return err
+	}
+	if c.Slack.Mode == "webhook" {
+		if c.Slack.HTTP.Addr == "" || c.Slack.HTTP.EventSubscriptionPath == "" || c.Slack.HTTP.InteractionPath == "" {
+			return fmt.Errorf("slack.http: addr and paths are required in webhook mode")
+		}
+		if c.Slack.HTTP.EventSubscriptionPath == c.Slack.HTTP.InteractionPath ||
+			c.Slack.HTTP.SlashCommandPath == c.Slack.HTTP.EventSubscriptionPath ||
+			c.Slack.HTTP.SlashCommandPath == c.Slack.HTTP.InteractionPath {
+			return fmt.Errorf("slack.http: event_subscription_path, interaction_path and slash_command_path must differ")
+		}
+	}
+	if err := c.LLM.Persona().validate("llm", responders); err != nil {
+		return err
+	}
+	for _, f := range c.LLM.Fallback {
+		backend, _, _ := strings.Cut(f, ":")
+		if err := oneOf("llm.fallback", backend, "openai", "echo"); err != nil {
+			return err
+		}
+	}
+	if c.LLM.Retries < 0 || c.LLM.BreakerThreshold < 1 {
+		return fmt.Errorf("llm: retries must be >= 0 and breaker_threshold >= 1")
+	}
+	if c.Cache.TTL < 0 || (c.Cache.TTL > 0 && c.Cache.Size < 1) {
+		return fmt.Errorf("cache: ttl must be >= 0 and size >= 1 when enabled")
+	}
+	if c.Cache.SemanticThreshold < 0 || c.Cache.SemanticThreshold > 1 {
+		return fmt.Errorf("cache.semantic_threshold: %g is not within [0, 1]", c.Cache.SemanticThreshold)
+	}
+	if c.Retrieval.TopK < 1 {
+		return fmt.Errorf("retrieval.top_k: must be >= 1")
+	}
+	if c.Retrieval.MinScore < 0 || c.Retrieval.MinScore > 1 {
+		return fmt.Errorf("retrieval.min_score: %g is not within [0, 1]", c.Retrieval.MinScore)
+	}
+	if err := oneOf("messagestore.type", c.MessageStore.Type, "memory", "sqlite", "postgres", "redis", "spanner"); err != nil {
+		return err
+	}
+	if c.MessageStore.Type == "spanner" && c.MessageStore.SpannerDSN == "" {
+		return fmt.Errorf("messagestore.spanner_dsn: required for spanner")
+	}
+	if c.MessageStore.Type == "postgres" && c.MessageStore.PostgresDSN == "" {
+		return fmt.Errorf("messagestore.postgres_dsn: required for postgres")
+	}
+	if c.MessageStore.Type == "redis" && c.MessageStore.RedisURL == "" {
+		return fmt.Errorf("messagestore.redis_url: required for redis")
+	}
+	if c.MessageStore.Type == "sqlite" && c.MessageStore.SQLitePath == "" {
+		return fmt.Errorf("messagestore.sqlite_path: required for sqlite")
+	}
+	if c.MessageStore.MaxConversations < 0 || c.MessageStore.IdleTTL < 0 {
+		return fmt.Errorf("messagestore: max_conversations and idle_ttl must be >= 0")
+	}
+	if c.Dispatcher.MaxConcurrency < 1 || c.Dispatcher.MaxQueueDepth < 1 {
+		return fmt.Errorf("dispatcher: max_concurrency and max_queue_depth must be >= 1")
+	}
+	for model, p := range c.Pricing {
+		if p.Prompt < 0 || p.Completion < 0 {
+			return fmt.Errorf("pricing.%s: prices must be >= 0", model)
+		}
+	}
+	if c.Personas != nil {
+		if err := c.Personas.Validate(responders); err != nil {
+			return fmt.Errorf("personas: %w", err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,170 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func writeConfig(t *testing.T, path, s string) {
+	t.Helper()
+	if err := os.WriteFile(path, []byte(s), 0o644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestLoad(t *testing.T) {
+	t.Setenv("TEST_SLACK_BOT_TOKEN", "xoxb-secret")
+
+	tests := map[string]struct {
+		yaml    string
+		wantErr string
+	}{
+		"sample": {yaml: ""},
+		"env": {
+			yaml: `
+slack:
+  bot_token: ${TEST_SLACK_BOT_TOKEN}
+llm:
+  breaker_cooldown: 30s
+`,
+		},
+		"unknown field": {
+			yaml: `
+llm:
+  modle: gpt-4
+`,
+			wantErr: "field modle not found",
+		},
+		"invalid mode": {
+			yaml: `
+slack:
+  mode: rtm
+`,
+			wantErr: `slack.mode: "rtm" is not one of`,
+		},
+		"same paths": {
+			yaml: `
+slack:
+  mode: webhook
+  http:
+    event_subscription_path: /slack
+    interaction_path: /slack
+`,
+			wantErr: "must differ",
+		},
+		"negative price": {
+			yaml: `
+pricing:
+  gpt-4: {prompt: -1, completion: 0.06}
+`,
+			wantErr: "pricing.gpt-4: prices must be >= 0",
+		},
+		"spanner without dsn": {
+			yaml: `
+messagestore:
+  type: spanner
+`,
+			wantErr: "spanner_dsn: required",
+		},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "config.yaml")
+			if name == "sample" {
+				path = "../../config.sample.yaml"
+			} else {
+				writeConfig(t, path, tt.yaml)
+			}
+
+			c, err := Load(path, []string{"bash"})
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatal(err)
+				}
+				if name == "env" && (c.Slack.BotToken != "xoxb-secret" || c.LLM.BreakerCooldown != 30*time.Second) {
+					t.Errorf("unexpected config: %+v", c)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("got %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestDiff(t *testing.T) {
+	old := Default()
+	new := Default()
+	new.LLM.Model = "gpt-4"
+	new.Slack.BotToken = "xoxb-new"
+	new.Personas = &Personas{Default: "ops"}
+
+	want := []string{
+		"llm.model:  -> gpt-4",
+		"personas.default: added ops",
+		"slack.bot_token: changed",
+	}
+	if got := Diff(old, new); !reflect.DeepEqual(got, want) {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+func TestWatcher_Reload(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	writeConfig(t, path, "llm:\n  model: gpt-3.5-turbo\n")
+	conf, err := Load(path, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var applied *Config
+	w := NewWatcher(path, conf, nil, func(c *Config) error {
+		applied = c
+		return nil
+	})
+
+	writeConfig(t, path, "llm:\n  model: gpt-4\n")
+	diff, err := w.Reload()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(diff, []string{"llm.model: gpt-3.5-turbo -> gpt-4"}) {
+		t.Errorf("unexpected diff: %q", diff)
+	}
+	if applied == nil || w.Current() != applied || applied.LLM.Model != "gpt-4" {
+		t.Errorf("the new config isn't applied")
+	}
+
+	// the sections needing a restart are not applied and stay in the changes.
+	writeConfig(t, path, "llm:\n  model: gpt-4\n  temperature: 0.5\nslack:\n  bot_id: B2\n")
+	for _, want := range [][]string{
+		{"llm.temperature: 0 -> 0.5", "slack.bot_id:  -> B2 (restart required)"},
+		{"slack.bot_id:  -> B2 (restart required)"},
+	} {
+		diff, err := w.Reload()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(diff, want) {
+			t.Errorf("got diff %q, want %q", diff, want)
+		}
+	}
+	if c := w.Current(); c.LLM.Temperature != 0.5 || c.Slack.BotID != "" || applied != c {
+		t.Errorf("only the reloadable sections should be applied: %+v", c)
+	}
+
+	// an invalid file keeps the current config.
+	writeConfig(t, path, "llm:\n  backend: gpt\n")
+	if _, err := w.Reload(); err == nil {
+		t.Error("expected an error")
+	}
+	if w.Current().LLM.Model != "gpt-4" {
+		t.Errorf("the current config is replaced by an invalid one")
+	}
+}
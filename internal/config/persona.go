@@ -0,0 +1,108 @@
+// Package config loads the configuration files of the bot.
+package config
+
+import (
+	"fmt"
+	"gopkg.in/yaml.v3"
+	"os"
+)
+
+// Persona configures the prompt, the llm and the responders of a persona.
+type Persona struct {
+	// Prompt is the path of the prompt template.
+	Prompt string `yaml:"prompt"`
+	// LLM is the backend, openai or echo.
+	LLM         string  `yaml:"llm"`
+	Model       string  `yaml:"model"`
+	Temperature float32 `yaml:"temperature"`
+	// Responders are the names of the responders allowed in the channels of the persona.
+	Responders []string `yaml:"responders"`
+	RunButtons bool     `yaml:"run_buttons"`
+}
+
+func (p *Persona) validate(field string, responders []string) error {
+	switch p.LLM {
+	case "openai":
+		if p.Prompt == "" {
+			return fmt.Errorf("%s: prompt is required for openai", field)
+		}
+	case "echo":
+	default:
+		return fmt.Errorf("%s: unknown llm %q", field, p.LLM)
+	}
+	if p.Temperature < 0 || p.Temperature > 2 {
+		return fmt.Errorf("%s: temperature %g is not within [0, 2]", field, p.Temperature)
+	}
+
+	known := map[string]bool{}
+	for _, r := range responders {
+		known[r] = true
+	}
+	for _, r := range p.Responders {
+		if !known[r] {
+			return fmt.Errorf("%s: unknown responder %q", field, r)
+		}
+	}
+	return nil
+}
+
+// Personas is the persona file, e.g.
+//
+//	default: ops
+//	personas:
+//	  ops:
+//	    prompt: ./prompt.txt
+//	    llm: openai
+//	    responders: [bash]
+//	    run_buttons: true
+//	  sql-helper:
+//	    prompt: ./prompts/sql.txt
+//	    llm: openai
+//	    model: gpt-4
+//	    temperature: 0.2
+//	channels:
+//	  C0123456789: sql-helper
+type Personas struct {
+	Default  string              `yaml:"default"`
+	Personas map[string]*Persona `yaml:"personas"`
+	// Channels maps channel IDs to persona names.
+	Channels map[string]string `yaml:"channels"`
+}
+
+// LoadPersonas parses and validates the persona file. responders are the names of the responders the bot has.
+func LoadPersonas(path string, responders []string) (*Personas, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open personas: %w", err)
+	}
+	defer f.Close()
+
+	var p Personas
+	dec := yaml.NewDecoder(f)
+	dec.KnownFields(true)
+	if err := dec.Decode(&p); err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", path, err)
+	}
+	if err := p.Validate(responders); err != nil {
+		return nil, fmt.Errorf("invalid %s: %w", path, err)
+	}
+	return &p, nil
+}
+
+// Validate checks that the referenced personas and responders exist.
+func (p *Personas) Validate(responders []string) error {
+	if _, ok := p.Personas[p.Default]; !ok {
+		return fmt.Errorf("default persona %q is not defined", p.Default)
+	}
+	for name, ps := range p.Personas {
+		if err := ps.validate("persona "+name, responders); err != nil {
+			return err
+		}
+	}
+	for channel, name := range p.Channels {
+		if _, ok := p.Personas[name]; !ok {
+			return fmt.Errorf("channel %s: persona %q is not defined", channel, name)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,103 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestLoadPersonas(t *testing.T) {
+	tests := map[string]struct {
+		yaml    string
+		wantErr string
+	}{
+		"valid": {
+			yaml: `
+default: ops
+personas:
+  ops:
+    prompt: ./prompt.txt
+    llm: openai
+    responders: [bash]
+    run_buttons: true
+  echo:
+    llm: echo
+channels:
+  C1: echo
+`,
+		},
+		"unknown default": {
+			yaml: `
+default: nope
+personas:
+  ops:
+    llm: echo
+`,
+			wantErr: `default persona "nope" is not defined`,
+		},
+		"unknown responder": {
+			yaml: `
+default: ops
+personas:
+  ops:
+    llm: echo
+    responders: [sql]
+`,
+			wantErr: `unknown responder "sql"`,
+		},
+		"unknown channel persona": {
+			yaml: `
+default: ops
+personas:
+  ops:
+    llm: echo
+channels:
+  C1: sql-helper
+`,
+			wantErr: `persona "sql-helper" is not defined`,
+		},
+		"openai without prompt": {
+			yaml: `
+default: ops
+personas:
+  ops:
+    llm: openai
+`,
+			wantErr: "prompt is required",
+		},
+		"unknown field": {
+			yaml: `
+default: ops
+personas:
+  ops:
+    llm: echo
+    temprature: 1
+`,
+			wantErr: "field temprature not found",
+		},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "personas.yaml")
+			if err := os.WriteFile(path, []byte(tt.yaml), 0o644); err != nil {
+				t.Fatal(err)
+			}
+
+			p, err := LoadPersonas(path, []string{"bash"})
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatal(err)
+				}
+				if p.Channels["C1"] != "echo" || !p.Personas["ops"].RunButtons {
+					t.Errorf("unexpected personas: %+v", p)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("got %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,215 @@
+package config
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+)
+
+// reloadable are the sections applied without a restart.
+var reloadable = []string{"llm.", "personas.", "rate_limit."}
+
+// Watcher reloads the config file on SIGHUP or when the file is modified.
+// An invalid file is logged and the current config is kept.
+type Watcher struct {
+	path       string
+	responders []string
+	// apply builds the components of the new config and swaps them in. The config is kept when it fails.
+	apply    func(conf *Config) error
+	interval time.Duration
+
+	mu      sync.Mutex
+	current atomic.Pointer[Config]
+	modTime time.Time
+}
+
+func NewWatcher(path string, conf *Config, responders []string, apply func(conf *Config) error) *Watcher {
+	w := &Watcher{
+		path:       path,
+		responders: responders,
+		apply:      apply,
+		interval:   2 * time.Second,
+	}
+	w.current.Store(conf)
+	if fi, err := os.Stat(path); err == nil {
+		w.modTime = fi.ModTime()
+	}
+	return w
+}
+
+func (w *Watcher) Current() *Config {
+	return w.current.Load()
+}
+
+// Reload loads the file and applies the reloadable sections of it. It returns the changes,
+// where the ones of the other sections are marked "(restart required)" until the process restarts.
+func (w *Watcher) Reload() ([]string, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if fi, err := os.Stat(w.path); err == nil {
+		w.modTime = fi.ModTime()
+	}
+	conf, err := Load(w.path, w.responders)
+	if err != nil {
+		return nil, err
+	}
+	diff := Diff(w.current.Load(), conf)
+	if len(diff) == 0 {
+		return nil, nil
+	}
+	next := withReloadable(w.current.Load(), conf)
+	if len(Diff(w.current.Load(), next)) > 0 {
+		if err := w.apply(next); err != nil {
+			return nil, fmt.Errorf("failed to apply %s: %w", w.path, err)
+		}
+		w.current.Store(next)
+	}
+
+	for i, d := range diff {
+		if !isReloadable(d) {
+			diff[i] += " (restart required)"
+		}
+		log.Printf("config reloaded: %s", diff[i])
+	}
+	return diff, nil
+}
+
+// withReloadable returns a copy of current with the reloadable sections of conf,
+// so that the sections needing a restart keep the values in use.
+func withReloadable(current, conf *Config) *Config {
+	next := *current
+	v, cv := reflect.ValueOf(&next).Elem(), reflect.ValueOf(conf).Elem()
+	for i := 0; i < v.NumField(); i++ {
+		name, _, _ := strings.Cut(v.Type().Field(i).Tag.Get("yaml"), ",")
+		if isReloadable(name + ".") {
+			v.Field(i).Set(cv.Field(i))
+		}
+	}
+	return &next
+}
+
+func isReloadable(change string) bool {
+	for _, prefix := range reloadable {
+		if strings.HasPrefix(change, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// Run reloads the config until the context is canceled.
+func (w *Watcher) Run(ctx context.Context) {
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	defer signal.Stop(hup)
+
+	t := time.NewTicker(w.interval)
+	defer t.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-hup:
+		case <-t.C:
+			if !w.modified() {
+				continue
+			}
+		}
+		if _, err := w.Reload(); err != nil {
+			log.Printf("keep the current config: %s", err.Error())
+		}
+	}
+}
+
+func (w *Watcher) modified() bool {
+	fi, err := os.Stat(w.path)
+	if err != nil {
+		return false
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return !fi.ModTime().Equal(w.modTime)
+}
+
+// Diff lists the changed fields as "yaml.path: old -> new". The values of secrets aren't shown.
+func Diff(old, new *Config) []string {
+	o, n := map[string]string{}, map[string]string{}
+	secrets := map[string]bool{}
+	flatten("", reflect.ValueOf(old), o, secrets)
+	flatten("", reflect.ValueOf(new), n, secrets)
+
+	keys := map[string]bool{}
+	for k := range o {
+		keys[k] = true
+	}
+	for k := range n {
+		keys[k] = true
+	}
+
+	var diff []string
+	for k := range keys {
+		ov, ook := o[k]
+		nv, nok := n[k]
+		switch {
+		case ook && nok && ov == nv:
+		case secrets[k]:
+			diff = append(diff, k+": changed")
+		case !ook:
+			diff = append(diff, fmt.Sprintf("%s: added %s", k, nv))
+		case !nok:
+			diff = append(diff, fmt.Sprintf("%s: removed %s", k, ov))
+		default:
+			diff = append(diff, fmt.Sprintf("%s: %s -> %s", k, ov, nv))
+		}
+	}
+	sort.Strings(diff)
+	return diff
+}
+
+func flatten(prefix string, v reflect.Value, out map[string]string, secrets map[string]bool) {
+	switch v.Kind() {
+	case reflect.Ptr:
+		if !v.IsNil() {
+			flatten(prefix, v.Elem(), out, secrets)
+		}
+	case reflect.Struct:
+		t := v.Type()
+		for i := 0; i < t.NumField(); i++ {
+			f := t.Field(i)
+			name, opts, _ := strings.Cut(f.Tag.Get("yaml"), ",")
+			if opts == "inline" {
+				flatten(prefix, v.Field(i), out, secrets)
+				continue
+			}
+			key := join(prefix, name)
+			if f.Tag.Get("secret") == "true" {
+				secrets[key] = true
+			}
+			flatten(key, v.Field(i), out, secrets)
+		}
+	case reflect.Map:
+		for _, k := range v.MapKeys() {
+			flatten(join(prefix, fmt.Sprint(k.Interface())), v.MapIndex(k), out, secrets)
+		}
+	default:
+		out[prefix] = fmt.Sprintf("%v", v.Interface())
+	}
+}
+
+func join(prefix, name string) string {
+	if prefix == "" {
+		return name
+	}
+	return prefix + "." + name
+}
@@ -0,0 +1,158 @@
+// Package jsonl exports the conversations of a MessageStore to JSON Lines and imports them to another one.
+package jsonl
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/ku/chatbot-slack-llm/messagestore"
+	"io"
+	"log"
+	"time"
+)
+
+// RoleUser is the role of all the messages. The replies of the bot are not stored in the messagestores,
+// so there are no messages from the assistant.
+const RoleUser = "user"
+
+// Record is a line of the export, a message of a conversation.
+type Record struct {
+	Thread   string `json:"thread"`
+	Channel  string `json:"channel"`
+	TS       string `json:"ts"`
+	ThreadTS string `json:"thread_ts,omitempty"`
+	Author   string `json:"author"`
+	Role     string `json:"role"`
+	// Initiator is set to the messages from the user who started the conversation.
+	Initiator bool      `json:"initiator,omitempty"`
+	Text      string    `json:"text"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+func (r *Record) message() *messagestore.SlackMessage {
+	return &messagestore.SlackMessage{
+		From:     r.Author,
+		Text:     r.Text,
+		TS:       r.TS,
+		ThreadTS: r.ThreadTS,
+		Channel:  r.Channel,
+	}
+}
+
+// Export writes the messages of all the conversations, a thread after another, and returns the number of them.
+func Export(ctx context.Context, store messagestore.MessageStore, w io.Writer) (int, error) {
+	lister, ok := store.(messagestore.ConversationLister)
+	if !ok {
+		return 0, fmt.Errorf("messagestore %s can't list conversations", store.Name())
+	}
+
+	enc := json.NewEncoder(w)
+	enc.SetEscapeHTML(false)
+	seen := map[string]bool{}
+	var n int
+	err := lister.ListConversations(ctx, func(thid string) error {
+		if seen[thid] {
+			return nil
+		}
+		seen[thid] = true
+
+		cv, err := store.GetConversation(ctx, thid)
+		if err != nil {
+			// expired or deleted after listed.
+			return nil
+		}
+		for _, m := range cv.GetMessages() {
+			// the root has no thread timestamp in some stores.
+			threadTS := m.GetThreadTimestamp()
+			if threadTS == m.GetTimestamp() {
+				threadTS = ""
+			}
+			if err := enc.Encode(&Record{
+				Thread:    thid,
+				Channel:   m.GetChannel(),
+				TS:        m.GetTimestamp(),
+				ThreadTS:  threadTS,
+				Author:    m.GetFrom(),
+				Role:      RoleUser,
+				Initiator: cv.IsFromInitiater(m),
+				Text:      m.GetRawText(),
+				CreatedAt: m.GetCreatedAt(),
+			}); err != nil {
+				return err
+			}
+			n++
+		}
+		return nil
+	})
+	return n, err
+}
+
+// Import adds the messages to the store of the bot and returns the number of the ones added.
+// The lines of a thread are expected to be consecutive as exported. The messages already stored are skipped,
+// so an import can be run again after a failure.
+func Import(ctx context.Context, store messagestore.MessageStore, botID string, r io.Reader) (int, error) {
+	sc := bufio.NewScanner(r)
+	sc.Buffer(make([]byte, 64*1024), 16*1024*1024)
+
+	var n int
+	var thread []*Record
+	flush := func() error {
+		added, err := importThread(ctx, store, botID, thread)
+		n += added
+		thread = nil
+		return err
+	}
+	for line := 1; sc.Scan(); line++ {
+		if len(sc.Bytes()) == 0 {
+			continue
+		}
+		rec := &Record{}
+		if err := json.Unmarshal(sc.Bytes(), rec); err != nil {
+			return n, fmt.Errorf("line %d: %w", line, err)
+		}
+		if len(thread) > 0 && thread[0].Thread != rec.Thread {
+			if err := flush(); err != nil {
+				return n, err
+			}
+		}
+		thread = append(thread, rec)
+	}
+	if err := sc.Err(); err != nil {
+		return n, err
+	}
+	return n, flush()
+}
+
+// importThread adds the mention of the initiator first since it starts the conversation.
+// The store puts the others in the order of the timestamps.
+func importThread(ctx context.Context, store messagestore.MessageStore, botID string, recs []*Record) (int, error) {
+	start := -1
+	for i, rec := range recs {
+		if !rec.message().IsMentionAt(botID) {
+			continue
+		}
+		if start < 0 || (rec.Initiator && !recs[start].Initiator) {
+			start = i
+		}
+	}
+	if start < 0 {
+		if len(recs) > 0 {
+			log.Printf("skipped thread %s without a mention of %s", recs[0].Thread, botID)
+		}
+		return 0, nil
+	}
+
+	var n int
+	order := append([]*Record{recs[start]}, append(recs[:start:start], recs[start+1:]...)...)
+	for _, rec := range order {
+		added, err := store.OnMessage(ctx, rec.message())
+		if err != nil {
+			return n, fmt.Errorf("failed to import %s/%s: %w", rec.Channel, rec.TS, err)
+		}
+		if added {
+			n++
+		}
+	}
+	return n, nil
+}
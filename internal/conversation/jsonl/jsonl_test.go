@@ -0,0 +1,121 @@
+package jsonl
+
+import (
+	"bytes"
+	"context"
+	"github.com/ku/chatbot-slack-llm/chatbot"
+	"github.com/ku/chatbot-slack-llm/internal/conversation/memory"
+	"github.com/ku/chatbot-slack-llm/internal/conversation/sqlite"
+	"github.com/ku/chatbot-slack-llm/messagestore"
+	"github.com/slack-go/slack/slackevents"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// slackChat posts nothing and returns the threads started before the bot joined.
+type slackChat struct {
+	threads map[string][]*slackevents.MessageEvent
+}
+
+func (c *slackChat) Name() string { return "slack-test" }
+func (c *slackChat) PostMessage(context.Context, messagestore.Message) error {
+	return nil
+}
+func (c *slackChat) PostActionableMessage(context.Context, messagestore.Message) error {
+	return nil
+}
+func (c *slackChat) PostEphemeralMessage(context.Context, string, messagestore.Message) error {
+	return nil
+}
+func (c *slackChat) SetEventListener(chatbot.EventListener) {}
+func (c *slackChat) Run(context.Context) error              { return nil }
+func (c *slackChat) FetchThread(_ context.Context, _, thid string) ([]messagestore.Message, error) {
+	var msgs []messagestore.Message
+	for _, ev := range c.threads[thid] {
+		msgs = append(msgs, messagestore.NewMessageFromMessage(ev))
+	}
+	return msgs, nil
+}
+
+type answer string
+
+func (a answer) GetText() string              { return string(a) }
+func (a answer) GetUsage() messagestore.Usage { return messagestore.Usage{} }
+
+type answerLLM struct{}
+
+func (answerLLM) Name() string { return "answer" }
+func (answerLLM) Completion(context.Context, messagestore.Conversation) (messagestore.CompletionMessage, error) {
+	return answer("a language"), nil
+}
+
+func TestExportImport(t *testing.T) {
+	ctx := context.Background()
+	broken := &slackevents.MessageEvent{User: "U2", Channel: "C2", Text: "the build is broken", TimeStamp: "1690000001.000100", ThreadTimeStamp: "1690000001.000100"}
+	src := memory.NewConversations("B1")
+	dispatcher := chatbot.NewDispatcher(chatbot.DefaultDispatcherConfig())
+	bot := chatbot.New(src, &slackChat{threads: map[string][]*slackevents.MessageEvent{
+		"1690000001.000100": {broken},
+	}}, answerLLM{}, nil, "B1", chatbot.WithDispatcher(dispatcher))
+	for _, ev := range []*slackevents.MessageEvent{
+		{User: "U1", Channel: "C1", Text: "<@B1> what is go?", TimeStamp: "1690000000.000100"},
+		{User: "U2", Channel: "C1", Text: "<@B1> me too", TimeStamp: "1690000000.000200", ThreadTimeStamp: "1690000000.000100"},
+		// the reply of the bot isn't stored.
+		{User: "B1", Channel: "C1", Text: "a language", TimeStamp: "1690000000.000250", ThreadTimeStamp: "1690000000.000100"},
+		{User: "U1", Channel: "C1", Text: "who made it?", TimeStamp: "1690000000.000300", ThreadTimeStamp: "1690000000.000100"},
+		// the bot is mentioned in the middle of the thread and the root is backfilled.
+		broken,
+		{User: "U3", Channel: "C2", Text: "<@B1> why?", TimeStamp: "1690000001.000200", ThreadTimeStamp: "1690000001.000100"},
+	} {
+		if err := bot.OnMessage(ctx, ev); err != nil {
+			t.Fatal(err)
+		}
+	}
+	dispatcher.Wait()
+
+	var exported bytes.Buffer
+	n, err := Export(ctx, src, &exported)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 5 {
+		t.Errorf("exported %d messages, want 5:\n%s", n, exported.String())
+	}
+	for _, want := range []string{
+		`"author":"U1","role":"user","initiator":true`,
+		`"author":"U2","role":"user","text"`,
+		`"author":"U3","role":"user","initiator":true`,
+	} {
+		if !strings.Contains(exported.String(), want) {
+			t.Errorf("%s is missing in:\n%s", want, exported.String())
+		}
+	}
+	if strings.Contains(exported.String(), `"author":"B1"`) {
+		t.Errorf("the bot's reply is exported:\n%s", exported.String())
+	}
+
+	db, err := sqlite.Open(ctx, filepath.Join(t.TempDir(), "chatbot.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	dst := sqlite.NewConversations("B1", db)
+	for i, want := range []int{5, 0} {
+		n, err := Import(ctx, dst, "B1", bytes.NewReader(exported.Bytes()))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if n != want {
+			t.Errorf("import #%d added %d messages, want %d", i+1, n, want)
+		}
+	}
+
+	var reexported bytes.Buffer
+	if _, err := Export(ctx, dst, &reexported); err != nil {
+		t.Fatal(err)
+	}
+	if reexported.String() != exported.String() {
+		t.Errorf("got\n%s\nwant\n%s", reexported.String(), exported.String())
+	}
+}
@@ -1,65 +1,172 @@
 package memory
 
 import (
+	"container/list"
 	"context"
 	"fmt"
 	"github.com/ku/chatbot-slack-llm/messagestore"
+	"sync"
+	"time"
 )
 
 type conversation struct {
+	thid      string
 	initiater string
-	messages  []messagestore.Message
+
+	mu       sync.Mutex
+	messages []messagestore.Message
+	// edits are the previous texts by the timestamps of the messages.
+	edits    map[string][]*messagestore.Edit
+	lastUsed time.Time
 }
 
+// conversations keeps the conversations in memory.
+// The least recently used ones are evicted over maxConversations or after idleTTL.
 type conversations struct {
-	botID string
-	cvs   map[string]*conversation
+	botID            string
+	maxConversations int
+	idleTTL          time.Duration
+	now              func() time.Time
+
+	// mu guards cvs and order. Each conversation has its own lock for the messages.
+	mu    sync.Mutex
+	cvs   map[string]*list.Element
+	order *list.List
+
+	countersMu sync.Mutex
+	counters   map[string]*counter
+
+	usagesMu sync.Mutex
+	usages   []*messagestore.UsageRecord
+
+	settingsMu sync.Mutex
+	settings   map[string]*messagestore.ThreadSettings
 }
 
 var _ messagestore.Conversation = (*conversation)(nil)
 var _ messagestore.MessageStore = (*conversations)(nil)
 
-func NewConversations(botID string) *conversations {
-	return &conversations{
-		botID: botID,
-		cvs:   make(map[string]*conversation),
+type Option func(c *conversations)
+
+// WithMaxConversations evicts the least recently used conversations over n. 0 is unlimited.
+func WithMaxConversations(n int) Option {
+	return func(c *conversations) {
+		c.maxConversations = n
+	}
+}
+
+// WithIdleTTL evicts the conversations not used for d. 0 keeps them forever.
+func WithIdleTTL(d time.Duration) Option {
+	return func(c *conversations) {
+		c.idleTTL = d
 	}
 }
 
-func (c *conversations) addNewConversation(m messagestore.Message) {
-	_, ok := c.cvs[m.GetThreadID()]
+func NewConversations(botID string, opts ...Option) *conversations {
+	c := &conversations{
+		botID:    botID,
+		now:      time.Now,
+		cvs:      make(map[string]*list.Element),
+		order:    list.New(),
+		counters: make(map[string]*counter),
+		settings: make(map[string]*messagestore.ThreadSettings),
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	return c
+}
+
+// get returns the conversation and marks it as used. c.mu must be held.
+func (c *conversations) get(thid string) (*conversation, bool) {
+	e, ok := c.cvs[thid]
 	if !ok {
-		c.cvs[m.GetThreadID()] = &conversation{
-			messages: []messagestore.Message{m},
+		return nil, false
+	}
+	cv := e.Value.(*conversation)
+	if c.expired(cv) {
+		return nil, false
+	}
+	c.order.MoveToFront(e)
+	cv.touch(c.now())
+	return cv, true
+}
+
+func (c *conversations) expired(cv *conversation) bool {
+	return c.idleTTL > 0 && !c.now().Before(cv.used().Add(c.idleTTL))
+}
+
+// evict removes the idle conversations and the ones over maxConversations from the back,
+// and returns their thread IDs. c.mu must be held.
+func (c *conversations) evict() []string {
+	var evicted []string
+	for e := c.order.Back(); e != nil; e = c.order.Back() {
+		cv := e.Value.(*conversation)
+		if !c.expired(cv) && (c.maxConversations <= 0 || c.order.Len() <= c.maxConversations) {
+			break
 		}
+		c.order.Remove(e)
+		delete(c.cvs, cv.thid)
+		evicted = append(evicted, cv.thid)
+	}
+	return evicted
+}
+
+// forgetSettings drops the settings of the evicted conversations.
+func (c *conversations) forgetSettings(thids []string) {
+	if len(thids) == 0 {
+		return
+	}
+	c.settingsMu.Lock()
+	defer c.settingsMu.Unlock()
+	for _, thid := range thids {
+		delete(c.settings, thid)
 	}
 }
 
 func (c *conversations) GetConversation(_ context.Context, thid string) (messagestore.Conversation, error) {
-	cnvs, ok := c.cvs[thid]
+	c.mu.Lock()
+	cv, ok := c.get(thid)
+	evicted := c.evict()
+	c.mu.Unlock()
+	c.forgetSettings(evicted)
+
 	if !ok {
 		return nil, fmt.Errorf("no conversation found for %s", thid)
 	}
-	return cnvs, nil
+	return cv, nil
 }
 
 func (c *conversations) OnMessage(ctx context.Context, m messagestore.Message) (bool, error) {
-	cv, ok := c.cvs[m.GetThreadID()]
+	c.mu.Lock()
+	cv, ok := c.get(m.GetThreadID())
 	if !ok {
 		if !m.IsMentionAt(c.botID) {
+			c.mu.Unlock()
 			// received a random message. ignore it.
 			return false, nil
 		}
 		cv = NewConversation(ctx, m)
-		c.cvs[m.GetThreadID()] = cv
-		return true, nil
+		cv.touch(c.now())
+		if e, exists := c.cvs[cv.thid]; exists {
+			// replace the expired one.
+			c.order.Remove(e)
+		}
+		c.cvs[cv.thid] = c.order.PushFront(cv)
 	}
+	evicted := c.evict()
+	c.mu.Unlock()
+	c.forgetSettings(evicted)
 
+	if !ok {
+		return true, nil
+	}
 	return cv.AddMessage(ctx, m)
 }
 
 func NewConversation(_ context.Context, m messagestore.Message) *conversation {
 	return &conversation{
+		thid:      m.GetThreadID(),
 		initiater: m.GetFrom(),
 		messages:  []messagestore.Message{m},
 	}
@@ -69,11 +176,26 @@ func (c *conversations) Name() string {
 	return "memory"
 }
 
+func (c *conversation) touch(now time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.lastUsed = now
+}
+
+func (c *conversation) used() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.lastUsed
+}
+
 func (c *conversation) IsFromInitiater(m messagestore.Message) bool {
 	return c.initiater == m.GetFrom()
 }
 
 func (c *conversation) AddMessage(_ context.Context, nm messagestore.Message) (bool, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
 	for _, m := range c.messages {
 		if m.GetTimestamp() == nm.GetTimestamp() {
 			// already added.
@@ -81,17 +203,27 @@ func (c *conversation) AddMessage(_ context.Context, nm messagestore.Message) (b
 		}
 	}
 
-	c.messages = append(c.messages, nm)
+	// keep the order of the timestamps even when a retried event arrives late.
+	i := len(c.messages)
+	for i > 0 && c.messages[i-1].GetTimestamp() > nm.GetTimestamp() {
+		i--
+	}
+	c.messages = append(c.messages, nil)
+	copy(c.messages[i+1:], c.messages[i:])
+	c.messages[i] = nm
 	return true, nil
 }
 
+// GetMessages returns a copy so that the caller can read it while messages are added.
 func (c *conversation) GetMessages() []messagestore.Message {
-	return c.messages
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return append([]messagestore.Message(nil), c.messages...)
 }
 
 func (c *conversation) String() string {
 	var s string
-	for _, m := range c.messages {
+	for _, m := range c.GetMessages() {
 		s += m.GetRawText() + "\n"
 	}
 	return s
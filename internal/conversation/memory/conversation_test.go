@@ -0,0 +1,115 @@
+package memory
+
+import (
+	"context"
+	"fmt"
+	"github.com/ku/chatbot-slack-llm/messagestore"
+	"github.com/ku/chatbot-slack-llm/messagestore/storetest"
+	"github.com/slack-go/slack/slackevents"
+	"sync"
+	"testing"
+	"time"
+)
+
+func newMessage(thid, ts, text string) messagestore.Message {
+	return messagestore.NewMessageFromMessage(&slackevents.MessageEvent{
+		User:            "human",
+		Channel:         "c1",
+		Text:            text,
+		TimeStamp:       ts,
+		ThreadTimeStamp: thid,
+	})
+}
+
+// run with -race
+func TestConversations_Concurrent(t *testing.T) {
+	ctx := context.Background()
+	c := NewConversations("B1", WithMaxConversations(8))
+
+	const threads, messages = 16, 50
+	var wg sync.WaitGroup
+	for i := 0; i < threads; i++ {
+		thid := fmt.Sprintf("%d.000000", i+1)
+		if _, err := c.OnMessage(ctx, newMessage(thid, thid, "<@B1> hello")); err != nil {
+			t.Fatal(err)
+		}
+		for j := 0; j < messages; j++ {
+			wg.Add(2)
+			go func(j int) {
+				defer wg.Done()
+				// slack retries deliver the same message twice.
+				ts := fmt.Sprintf("%s%03d", thid[:len(thid)-3], j%(messages/2))
+				if _, err := c.OnMessage(ctx, newMessage(thid, ts, "reply")); err != nil {
+					t.Error(err)
+				}
+			}(j)
+			go func() {
+				defer wg.Done()
+				if cv, err := c.GetConversation(ctx, thid); err == nil {
+					_ = cv.String()
+				}
+			}()
+		}
+	}
+	wg.Wait()
+
+	c.mu.Lock()
+	n := c.order.Len()
+	c.mu.Unlock()
+	if n > 8 {
+		t.Errorf("%d conversations are kept over the max", n)
+	}
+
+	for i := threads - 1; i >= 0; i-- {
+		thid := fmt.Sprintf("%d.000000", i+1)
+		cv, err := c.GetConversation(ctx, thid)
+		if err != nil {
+			continue
+		}
+		seen := map[string]bool{}
+		for _, m := range cv.GetMessages() {
+			if seen[m.GetTimestamp()] {
+				t.Errorf("duplicate message %s in %s", m.GetTimestamp(), thid)
+			}
+			seen[m.GetTimestamp()] = true
+		}
+	}
+}
+
+func TestConversations_Eviction(t *testing.T) {
+	ctx := context.Background()
+	now := time.Date(2023, 6, 1, 0, 0, 0, 0, time.UTC)
+	c := NewConversations("B1", WithMaxConversations(2), WithIdleTTL(time.Hour))
+	c.now = func() time.Time { return now }
+
+	for _, thid := range []string{"1.0", "2.0"} {
+		if _, err := c.OnMessage(ctx, newMessage(thid, thid, "<@B1> hello")); err != nil {
+			t.Fatal(err)
+		}
+		now = now.Add(time.Minute)
+	}
+	// 1.0 is used more recently than 2.0.
+	if _, err := c.GetConversation(ctx, "1.0"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.OnMessage(ctx, newMessage("3.0", "3.0", "<@B1> hello")); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.GetConversation(ctx, "2.0"); err == nil {
+		t.Error("the least recently used conversation should be evicted")
+	}
+
+	now = now.Add(time.Hour)
+	if added, _ := c.OnMessage(ctx, newMessage("1.0", "1.1", "are you there?")); added {
+		t.Error("messages to idle conversations shouldn't be added")
+	}
+	for _, thid := range []string{"1.0", "3.0"} {
+		if _, err := c.GetConversation(ctx, thid); err == nil {
+			t.Errorf("idle conversation %s should be evicted", thid)
+		}
+	}
+}
+
+func TestConversations_Conformance(t *testing.T) {
+	storetest.Run(t, "B1", NewConversations("B1"))
+}
@@ -0,0 +1,34 @@
+package memory
+
+import (
+	"context"
+	"github.com/ku/chatbot-slack-llm/messagestore"
+	"time"
+)
+
+type counter struct {
+	value     int64
+	expiresAt time.Time
+}
+
+var _ messagestore.CounterStore = (*conversations)(nil)
+
+func (c *conversations) IncrementCounter(_ context.Context, key string, delta int64, expiresAt time.Time) (int64, error) {
+	c.countersMu.Lock()
+	defer c.countersMu.Unlock()
+
+	now := time.Now()
+	for k, v := range c.counters {
+		if !now.Before(v.expiresAt) {
+			delete(c.counters, k)
+		}
+	}
+
+	cnt, ok := c.counters[key]
+	if !ok {
+		cnt = &counter{expiresAt: expiresAt}
+		c.counters[key] = cnt
+	}
+	cnt.value += delta
+	return cnt.value, nil
+}
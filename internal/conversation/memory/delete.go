@@ -0,0 +1,20 @@
+package memory
+
+import (
+	"context"
+	"github.com/ku/chatbot-slack-llm/messagestore"
+)
+
+var _ messagestore.ConversationDeleter = (*conversations)(nil)
+
+func (c *conversations) DeleteConversation(_ context.Context, thid string) error {
+	c.mu.Lock()
+	if e, ok := c.cvs[thid]; ok {
+		c.order.Remove(e)
+		delete(c.cvs, thid)
+	}
+	c.mu.Unlock()
+
+	c.forgetSettings([]string{thid})
+	return nil
+}
@@ -0,0 +1,78 @@
+package memory
+
+import (
+	"context"
+	"github.com/ku/chatbot-slack-llm/messagestore"
+	"time"
+)
+
+var _ messagestore.MessageEditor = (*conversations)(nil)
+
+// lookup returns the conversation of the thread without evicting others.
+func (c *conversations) lookup(thid string) (*conversation, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.get(thid)
+}
+
+func (c *conversations) EditMessage(_ context.Context, m messagestore.Message, editedAt time.Time) (bool, error) {
+	cv, ok := c.lookup(m.GetThreadID())
+	if !ok {
+		return false, nil
+	}
+
+	cv.mu.Lock()
+	defer cv.mu.Unlock()
+	for i, om := range cv.messages {
+		if om.GetChannel() != m.GetChannel() || om.GetTimestamp() != m.GetTimestamp() {
+			continue
+		}
+		if om.GetRawText() == m.GetRawText() {
+			// e.g. a link is unfurled.
+			return false, nil
+		}
+		if cv.edits == nil {
+			cv.edits = make(map[string][]*messagestore.Edit)
+		}
+		cv.edits[om.GetTimestamp()] = append(cv.edits[om.GetTimestamp()], &messagestore.Edit{Text: om.GetRawText(), EditedAt: editedAt})
+		cv.messages[i] = &messagestore.SlackMessage{
+			From:     om.GetFrom(),
+			Text:     m.GetRawText(),
+			TS:       om.GetTimestamp(),
+			ThreadTS: om.GetThreadTimestamp(),
+			Channel:  om.GetChannel(),
+		}
+		return true, nil
+	}
+	// deleted meanwhile.
+	return false, nil
+}
+
+func (c *conversations) DeleteMessage(_ context.Context, m messagestore.Message) (bool, error) {
+	cv, ok := c.lookup(m.GetThreadID())
+	if !ok {
+		return false, nil
+	}
+
+	cv.mu.Lock()
+	defer cv.mu.Unlock()
+	for i, om := range cv.messages {
+		if om.GetChannel() == m.GetChannel() && om.GetTimestamp() == m.GetTimestamp() {
+			cv.messages = append(cv.messages[:i], cv.messages[i+1:]...)
+			delete(cv.edits, om.GetTimestamp())
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func (c *conversations) GetEdits(_ context.Context, m messagestore.Message) ([]*messagestore.Edit, error) {
+	cv, ok := c.lookup(m.GetThreadID())
+	if !ok {
+		return nil, nil
+	}
+
+	cv.mu.Lock()
+	defer cv.mu.Unlock()
+	return append([]*messagestore.Edit(nil), cv.edits[m.GetTimestamp()]...), nil
+}
@@ -0,0 +1,29 @@
+package memory
+
+import (
+	"context"
+	"github.com/ku/chatbot-slack-llm/messagestore"
+	"sort"
+)
+
+var _ messagestore.ConversationLister = (*conversations)(nil)
+
+// ListConversations lists the conversations not expired, in the order of the thread timestamps.
+func (c *conversations) ListConversations(_ context.Context, f func(thid string) error) error {
+	c.mu.Lock()
+	var thids []string
+	for thid, e := range c.cvs {
+		if !c.expired(e.Value.(*conversation)) {
+			thids = append(thids, thid)
+		}
+	}
+	c.mu.Unlock()
+
+	sort.Strings(thids)
+	for _, thid := range thids {
+		if err := f(thid); err != nil {
+			return err
+		}
+	}
+	return nil
+}
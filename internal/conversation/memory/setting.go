@@ -0,0 +1,29 @@
+package memory
+
+import (
+	"context"
+	"github.com/ku/chatbot-slack-llm/messagestore"
+)
+
+var _ messagestore.SettingStore = (*conversations)(nil)
+
+func (c *conversations) GetThreadSettings(_ context.Context, thid string) (*messagestore.ThreadSettings, error) {
+	c.settingsMu.Lock()
+	defer c.settingsMu.Unlock()
+
+	s, ok := c.settings[thid]
+	if !ok {
+		return &messagestore.ThreadSettings{}, nil
+	}
+	cp := *s
+	return &cp, nil
+}
+
+func (c *conversations) PutThreadSettings(_ context.Context, thid string, s *messagestore.ThreadSettings) error {
+	c.settingsMu.Lock()
+	defer c.settingsMu.Unlock()
+
+	cp := *s
+	c.settings[thid] = &cp
+	return nil
+}
@@ -0,0 +1,28 @@
+package memory
+
+import (
+	"context"
+	"github.com/ku/chatbot-slack-llm/messagestore"
+)
+
+var _ messagestore.UsageStore = (*conversations)(nil)
+
+func (c *conversations) RecordUsage(_ context.Context, r *messagestore.UsageRecord) error {
+	c.usagesMu.Lock()
+	defer c.usagesMu.Unlock()
+	c.usages = append(c.usages, r)
+	return nil
+}
+
+func (c *conversations) ListUsage(_ context.Context, f *messagestore.UsageFilter) ([]*messagestore.UsageRecord, error) {
+	c.usagesMu.Lock()
+	defer c.usagesMu.Unlock()
+
+	var rs []*messagestore.UsageRecord
+	for _, r := range c.usages {
+		if f.Match(r) {
+			rs = append(rs, r)
+		}
+	}
+	return rs, nil
+}
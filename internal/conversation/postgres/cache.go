@@ -0,0 +1,53 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"github.com/ku/chatbot-slack-llm/messagestore"
+	"time"
+)
+
+var _ messagestore.ResponseCacheStore = (*conversations)(nil)
+
+func (c *conversations) GetCachedResponse(ctx context.Context, key string) (*messagestore.CachedResponse, error) {
+	var sources string
+	r := &messagestore.CachedResponse{}
+	err := c.db.QueryRowContext(ctx,
+		"SELECT text, model, prompt_tokens, completion_tokens, sources, created_at, expires_at FROM response_cache WHERE cache_key = $1", key,
+	).Scan(&r.Text, &r.Usage.Model, &r.Usage.PromptTokens, &r.Usage.CompletionTokens, &sources, &r.CreatedAt, &r.ExpiresAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if !time.Now().Before(r.ExpiresAt) {
+		return nil, nil
+	}
+	if sources != "" {
+		if err := json.Unmarshal([]byte(sources), &r.Sources); err != nil {
+			return nil, err
+		}
+	}
+	return r, nil
+}
+
+func (c *conversations) PutCachedResponse(ctx context.Context, key string, r *messagestore.CachedResponse) error {
+	var sources []byte
+	if len(r.Sources) > 0 {
+		b, err := json.Marshal(r.Sources)
+		if err != nil {
+			return err
+		}
+		sources = b
+	}
+	_, err := c.db.ExecContext(ctx,
+		`INSERT INTO response_cache (cache_key, text, model, prompt_tokens, completion_tokens, sources, created_at, expires_at) VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+		ON CONFLICT (cache_key) DO UPDATE SET text = excluded.text, model = excluded.model, prompt_tokens = excluded.prompt_tokens,
+			completion_tokens = excluded.completion_tokens, sources = excluded.sources, created_at = excluded.created_at, expires_at = excluded.expires_at`,
+		key, r.Text, r.Usage.Model, r.Usage.PromptTokens, r.Usage.CompletionTokens, string(sources), r.CreatedAt, r.ExpiresAt,
+	)
+	return err
+}
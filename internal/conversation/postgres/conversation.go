@@ -0,0 +1,129 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"github.com/ku/chatbot-slack-llm/messagestore"
+	"strings"
+)
+
+type conversations struct {
+	botID string
+	db    *sql.DB
+}
+
+var _ messagestore.MessageStore = (*conversations)(nil)
+
+// NewConversations returns the MessageStore on the database migrated by Migrate.
+func NewConversations(botID string, db *sql.DB) *conversations {
+	return &conversations{
+		botID: botID,
+		db:    db,
+	}
+}
+
+func (c *conversations) Name() string {
+	return "postgres"
+}
+
+// OnMessage starts a conversation with a mention, and adds the following messages in the thread.
+// The unique constraint on (channel, ts) keeps a retried event from being added twice.
+func (c *conversations) OnMessage(ctx context.Context, m messagestore.Message) (bool, error) {
+	tx, err := c.db.BeginTx(ctx, nil)
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback()
+
+	if m.IsMentionAt(c.botID) {
+		// the first mention is the initiator even when replicas receive the thread at once.
+		if _, err := tx.ExecContext(ctx,
+			"INSERT INTO conversations (thread_id, channel, initiator, created_at) VALUES ($1, $2, $3, $4) ON CONFLICT (thread_id) DO NOTHING",
+			m.GetThreadID(), m.GetChannel(), m.GetFrom(), m.GetCreatedAt(),
+		); err != nil {
+			return false, fmt.Errorf("failed to insert conversation %s: %w", m.GetThreadID(), err)
+		}
+	} else {
+		var exists int
+		err := tx.QueryRowContext(ctx, "SELECT 1 FROM conversations WHERE thread_id = $1", m.GetThreadID()).Scan(&exists)
+		if errors.Is(err, sql.ErrNoRows) {
+			// received a random message. ignore it.
+			return false, nil
+		}
+		if err != nil {
+			return false, err
+		}
+	}
+
+	res, err := tx.ExecContext(ctx,
+		"INSERT INTO messages (channel, ts, thread_id, user_id, text, created_at) VALUES ($1, $2, $3, $4, $5, $6) ON CONFLICT ON CONSTRAINT messages_channel_ts_key DO NOTHING",
+		m.GetChannel(), m.GetTimestamp(), m.GetThreadID(), m.GetFrom(), m.GetRawText(), m.GetCreatedAt(),
+	)
+	if err != nil {
+		return false, fmt.Errorf("failed to insert message %s: %w", m.GetTimestamp(), err)
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	if n == 0 {
+		// already added.
+		return false, nil
+	}
+	return true, tx.Commit()
+}
+
+func (c *conversations) GetConversation(ctx context.Context, thid string) (messagestore.Conversation, error) {
+	cv := &conversation{}
+	err := c.db.QueryRowContext(ctx, "SELECT initiator FROM conversations WHERE thread_id = $1", thid).Scan(&cv.initiator)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, fmt.Errorf("no conversation found for %s", thid)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := c.db.QueryContext(ctx, "SELECT channel, ts, thread_id, user_id, text FROM messages WHERE thread_id = $1 ORDER BY ts", thid)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		m := &messagestore.SlackMessage{}
+		var threadID string
+		if err := rows.Scan(&m.Channel, &m.TS, &threadID, &m.From, &m.Text); err != nil {
+			return nil, err
+		}
+		// the root has no thread timestamp as the events do.
+		if threadID != m.TS {
+			m.ThreadTS = threadID
+		}
+		cv.messages = append(cv.messages, m)
+	}
+	return cv, rows.Err()
+}
+
+type conversation struct {
+	initiator string
+	messages  []messagestore.Message
+}
+
+var _ messagestore.Conversation = (*conversation)(nil)
+
+func (c *conversation) GetMessages() []messagestore.Message {
+	return c.messages
+}
+
+func (c *conversation) IsFromInitiater(m messagestore.Message) bool {
+	return c.initiator == m.GetFrom()
+}
+
+func (c *conversation) String() string {
+	s := make([]string, len(c.messages))
+	for i, m := range c.messages {
+		s[i] = m.GetRawText()
+	}
+	return strings.Join(s, "\n")
+}
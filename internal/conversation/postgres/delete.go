@@ -0,0 +1,23 @@
+package postgres
+
+import (
+	"context"
+	"github.com/ku/chatbot-slack-llm/messagestore"
+)
+
+var _ messagestore.ConversationDeleter = (*conversations)(nil)
+
+func (c *conversations) DeleteConversation(ctx context.Context, thid string) error {
+	tx, err := c.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	for _, table := range []string{"messages", "message_edits", "conversations", "thread_settings"} {
+		if _, err := tx.ExecContext(ctx, "DELETE FROM "+table+" WHERE thread_id = $1", thid); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
@@ -0,0 +1,47 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"embed"
+	"fmt"
+	_ "github.com/jackc/pgx/v5/stdlib"
+	"github.com/ku/chatbot-slack-llm/internal/conversation/sqlmigrate"
+	"io/fs"
+)
+
+//go:embed migrations/*.sql
+var migrations embed.FS
+
+// migrationLock is the key of the advisory lock taken while migrating.
+const migrationLock = 7_246_210_001
+
+// Open connects to the database and applies the migrations.
+func Open(ctx context.Context, dsn string) (*sql.DB, error) {
+	db, err := sql.Open("pgx", dsn)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open postgres: %w", err)
+	}
+	if err := db.PingContext(ctx); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to connect to postgres: %w", err)
+	}
+	if err := Migrate(ctx, db); err != nil {
+		db.Close()
+		return nil, err
+	}
+	return db, nil
+}
+
+// Migrate applies the migrations in migrations/ which aren't applied yet.
+func Migrate(ctx context.Context, db *sql.DB) error {
+	fsys, err := fs.Sub(migrations, "migrations")
+	if err != nil {
+		return err
+	}
+	return sqlmigrate.Migrate(ctx, db, fsys, &sqlmigrate.Dialect{
+		Name:        "postgres",
+		Placeholder: "$1",
+		Lock:        fmt.Sprintf("SELECT pg_advisory_xact_lock(%d)", migrationLock),
+	})
+}
@@ -0,0 +1,12 @@
+CREATE TABLE message_edits (
+    id        BIGSERIAL PRIMARY KEY,
+    channel   TEXT NOT NULL,
+    ts        TEXT NOT NULL,
+    thread_id TEXT NOT NULL,
+    text      TEXT NOT NULL,
+    edited_at TIMESTAMPTZ NOT NULL
+);
+
+CREATE INDEX message_edits_by_message ON message_edits (channel, ts);
+
+CREATE INDEX message_edits_by_thread ON message_edits (thread_id);
@@ -0,0 +1,2 @@
+-- The sources of the cached responses as a JSON array, empty if there are none.
+ALTER TABLE response_cache ADD COLUMN sources TEXT NOT NULL DEFAULT '';
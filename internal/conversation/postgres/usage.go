@@ -0,0 +1,64 @@
+package postgres
+
+import (
+	"context"
+	"fmt"
+	"github.com/ku/chatbot-slack-llm/messagestore"
+	"strings"
+)
+
+var _ messagestore.UsageStore = (*conversations)(nil)
+
+func (c *conversations) RecordUsage(ctx context.Context, r *messagestore.UsageRecord) error {
+	_, err := c.db.ExecContext(ctx,
+		"INSERT INTO usages (thread_id, channel, user_id, model, prompt_tokens, completion_tokens, created_at) VALUES ($1, $2, $3, $4, $5, $6, $7)",
+		r.ThreadID, r.Channel, r.User, r.Model, r.PromptTokens, r.CompletionTokens, r.CreatedAt,
+	)
+	return err
+}
+
+func (c *conversations) ListUsage(ctx context.Context, f *messagestore.UsageFilter) ([]*messagestore.UsageRecord, error) {
+	var conds []string
+	var args []interface{}
+	where := func(cond string, arg interface{}) {
+		args = append(args, arg)
+		conds = append(conds, fmt.Sprintf(cond, len(args)))
+	}
+	if !f.From.IsZero() {
+		where("created_at >= $%d", f.From)
+	}
+	if !f.To.IsZero() {
+		where("created_at < $%d", f.To)
+	}
+	if f.ThreadID != "" {
+		where("thread_id = $%d", f.ThreadID)
+	}
+	if f.Channel != "" {
+		where("channel = $%d", f.Channel)
+	}
+	if f.User != "" {
+		where("user_id = $%d", f.User)
+	}
+
+	sqlstr := "SELECT thread_id, channel, user_id, model, prompt_tokens, completion_tokens, created_at FROM usages"
+	if len(conds) > 0 {
+		sqlstr += " WHERE " + strings.Join(conds, " AND ")
+	}
+	sqlstr += " ORDER BY created_at ASC"
+
+	rows, err := c.db.QueryContext(ctx, sqlstr, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var rs []*messagestore.UsageRecord
+	for rows.Next() {
+		r := &messagestore.UsageRecord{}
+		if err := rows.Scan(&r.ThreadID, &r.Channel, &r.User, &r.Model, &r.PromptTokens, &r.CompletionTokens, &r.CreatedAt); err != nil {
+			return nil, err
+		}
+		rs = append(rs, r)
+	}
+	return rs, rows.Err()
+}
@@ -0,0 +1,43 @@
+package redis
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/ku/chatbot-slack-llm/messagestore"
+	"github.com/redis/go-redis/v9"
+	"time"
+)
+
+var _ messagestore.ResponseCacheStore = (*conversations)(nil)
+
+func (c *conversations) cacheKey(key string) string {
+	return c.prefix + "cache:" + key
+}
+
+func (c *conversations) GetCachedResponse(ctx context.Context, key string) (*messagestore.CachedResponse, error) {
+	b, err := c.client.Get(ctx, c.cacheKey(key)).Bytes()
+	if err == redis.Nil {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	r := &messagestore.CachedResponse{}
+	if err := json.Unmarshal(b, r); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// PutCachedResponse lets redis drop the response when it expires.
+func (c *conversations) PutCachedResponse(ctx context.Context, key string, r *messagestore.CachedResponse) error {
+	ttl := time.Until(r.ExpiresAt)
+	if ttl <= 0 {
+		return nil
+	}
+	b, err := json.Marshal(r)
+	if err != nil {
+		return err
+	}
+	return c.client.Set(ctx, c.cacheKey(key), b, ttl).Err()
+}
@@ -0,0 +1,191 @@
+package redis
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/ku/chatbot-slack-llm/messagestore"
+	"github.com/redis/go-redis/v9"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// conversations keeps each thread in four keys which expire together after ttl without messages:
+//
+//	<prefix>thread:<thid>           hash of the conversation, e.g. the initiator
+//	<prefix>thread:<thid>:ts        sorted set of the message timestamps
+//	<prefix>thread:<thid>:messages  hash of the messages by timestamp
+//	<prefix>thread:<thid>:edits     hash of the previous texts of the edited messages by timestamp
+type conversations struct {
+	botID  string
+	client redis.UniversalClient
+	prefix string
+	ttl    time.Duration
+}
+
+var _ messagestore.MessageStore = (*conversations)(nil)
+
+type Option func(c *conversations)
+
+// WithKeyPrefix separates the keys of the bots sharing a redis. The default is "chatbot:".
+func WithKeyPrefix(prefix string) Option {
+	return func(c *conversations) {
+		c.prefix = prefix
+	}
+}
+
+// WithTTL expires the conversations idle for d. 0 keeps them forever.
+func WithTTL(d time.Duration) Option {
+	return func(c *conversations) {
+		c.ttl = d
+	}
+}
+
+func NewConversations(botID string, client redis.UniversalClient, opts ...Option) *conversations {
+	c := &conversations{
+		botID:  botID,
+		client: client,
+		prefix: "chatbot:",
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	return c
+}
+
+func (c *conversations) Name() string {
+	return "redis"
+}
+
+// threadKey is the key of the thread. The thread ID is the hash tag of all the keys of the thread
+// so that the scripts and transactions across them run on a single node of a cluster.
+func (c *conversations) threadKey(thid string) string {
+	return c.prefix + "thread:{" + thid + "}"
+}
+
+// threadKeys are the keys of the thread. The scripts refresh the expiry of all of them,
+// including the settings, so that the settings live as long as the conversation.
+func (c *conversations) threadKeys(thid string) []string {
+	k := c.threadKey(thid)
+	return []string{k, k + ":ts", k + ":messages", k + ":edits", c.settingsKey(thid)}
+}
+
+// message is the stored form of a message.
+type message struct {
+	From     string `json:"from"`
+	Text     string `json:"text"`
+	TS       string `json:"ts"`
+	ThreadTS string `json:"thread_ts,omitempty"`
+	Channel  string `json:"channel"`
+}
+
+// addMessage adds the message if its timestamp is new, and starts the conversation with a mention.
+// It returns 1 when the message is added.
+var addMessage = redis.NewScript(`
+if redis.call('EXISTS', KEYS[1]) == 0 then
+	if ARGV[5] ~= '1' then
+		return 0
+	end
+	redis.call('HSET', KEYS[1], 'initiator', ARGV[4])
+end
+local added = redis.call('ZADD', KEYS[2], 'NX', ARGV[2], ARGV[1])
+if added == 1 then
+	redis.call('HSET', KEYS[3], ARGV[1], ARGV[3])
+end
+local ttl = tonumber(ARGV[6])
+if ttl > 0 then
+	for _, k in ipairs(KEYS) do
+		redis.call('PEXPIRE', k, ttl)
+	end
+end
+return added
+`)
+
+// OnMessage adds the message atomically so that replicas receiving the same event add it once.
+func (c *conversations) OnMessage(ctx context.Context, m messagestore.Message) (bool, error) {
+	score, err := strconv.ParseFloat(m.GetTimestamp(), 64)
+	if err != nil {
+		return false, fmt.Errorf("invalid message timestamp %q: %w", m.GetTimestamp(), err)
+	}
+	b, err := json.Marshal(&message{
+		From:     m.GetFrom(),
+		Text:     m.GetRawText(),
+		TS:       m.GetTimestamp(),
+		ThreadTS: m.GetThreadTimestamp(),
+		Channel:  m.GetChannel(),
+	})
+	if err != nil {
+		return false, err
+	}
+	mention := "0"
+	if m.IsMentionAt(c.botID) {
+		mention = "1"
+	}
+
+	added, err := addMessage.Run(ctx, c.client, c.threadKeys(m.GetThreadID()),
+		m.GetTimestamp(), score, b, m.GetFrom(), mention, c.ttl.Milliseconds(),
+	).Int()
+	if err != nil {
+		return false, fmt.Errorf("failed to add message %s: %w", m.GetTimestamp(), err)
+	}
+	return added == 1, nil
+}
+
+func (c *conversations) GetConversation(ctx context.Context, thid string) (messagestore.Conversation, error) {
+	keys := c.threadKeys(thid)
+	var initiator *redis.StringCmd
+	var tss *redis.StringSliceCmd
+	var msgs *redis.MapStringStringCmd
+	_, err := c.client.TxPipelined(ctx, func(p redis.Pipeliner) error {
+		initiator = p.HGet(ctx, keys[0], "initiator")
+		tss = p.ZRange(ctx, keys[1], 0, -1)
+		msgs = p.HGetAll(ctx, keys[2])
+		return nil
+	})
+	if err == redis.Nil {
+		return nil, fmt.Errorf("no conversation found for %s", thid)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	cv := &conversation{initiator: initiator.Val()}
+	for _, ts := range tss.Val() {
+		var sm message
+		if err := json.Unmarshal([]byte(msgs.Val()[ts]), &sm); err != nil {
+			return nil, fmt.Errorf("broken message %s in %s: %w", ts, thid, err)
+		}
+		cv.messages = append(cv.messages, &messagestore.SlackMessage{
+			From:     sm.From,
+			Text:     sm.Text,
+			TS:       sm.TS,
+			ThreadTS: sm.ThreadTS,
+			Channel:  sm.Channel,
+		})
+	}
+	return cv, nil
+}
+
+type conversation struct {
+	initiator string
+	messages  []messagestore.Message
+}
+
+var _ messagestore.Conversation = (*conversation)(nil)
+
+func (c *conversation) GetMessages() []messagestore.Message {
+	return c.messages
+}
+
+func (c *conversation) IsFromInitiater(m messagestore.Message) bool {
+	return c.initiator == m.GetFrom()
+}
+
+func (c *conversation) String() string {
+	s := make([]string, len(c.messages))
+	for i, m := range c.messages {
+		s[i] = m.GetRawText()
+	}
+	return strings.Join(s, "\n")
+}
@@ -0,0 +1,150 @@
+package redis
+
+import (
+	"context"
+	"fmt"
+	"github.com/alicebob/miniredis/v2"
+	"github.com/ku/chatbot-slack-llm/messagestore"
+	"github.com/ku/chatbot-slack-llm/messagestore/storetest"
+	"github.com/redis/go-redis/v9"
+	"github.com/slack-go/slack/slackevents"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestConversations(t *testing.T) {
+	ctx := context.Background()
+	mr := miniredis.RunT(t)
+	c := NewConversations("B1", redis.NewClient(&redis.Options{Addr: mr.Addr()}), WithTTL(time.Hour))
+
+	message := func(user, ts, thts, text string) messagestore.Message {
+		return messagestore.NewMessageFromMessage(&slackevents.MessageEvent{User: user, Channel: "C1", Text: text, TimeStamp: ts, ThreadTimeStamp: thts})
+	}
+	if added, _ := c.OnMessage(ctx, message("U1", "1.000001", "", "hello")); added {
+		t.Error("a message without a mention shouldn't start a conversation")
+	}
+	if added, err := c.OnMessage(ctx, message("U1", "1.000001", "", "<@B1> hello")); err != nil || !added {
+		t.Fatalf("added = %v, %v", added, err)
+	}
+
+	// replicas receive the same retried events at once.
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	added := 0
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			ok, err := c.OnMessage(ctx, message("U2", fmt.Sprintf("1.00001%d", i%2), "1.000001", "reply"))
+			if err != nil {
+				t.Error(err)
+			}
+			if ok {
+				mu.Lock()
+				added++
+				mu.Unlock()
+			}
+		}(i)
+	}
+	wg.Wait()
+	if added != 2 {
+		t.Errorf("%d messages are added, want 2", added)
+	}
+
+	cv, err := c.GetConversation(ctx, "1.000001")
+	if err != nil {
+		t.Fatal(err)
+	}
+	msgs := cv.GetMessages()
+	if len(msgs) != 3 || msgs[0].GetRawText() != "<@B1> hello" || msgs[2].GetThreadID() != "1.000001" {
+		t.Fatalf("unexpected messages: %q", cv.String())
+	}
+	if !cv.IsFromInitiater(msgs[0]) || cv.IsFromInitiater(msgs[1]) {
+		t.Error("the initiator should be the user who mentioned the bot")
+	}
+
+	mr.FastForward(2 * time.Hour)
+	if _, err := c.GetConversation(ctx, "1.000001"); err == nil {
+		t.Error("the idle conversation should expire")
+	}
+}
+
+func TestConversations_ThreadSettingsTTL(t *testing.T) {
+	ctx := context.Background()
+	mr := miniredis.RunT(t)
+	c := NewConversations("B1", redis.NewClient(&redis.Options{Addr: mr.Addr()}), WithTTL(time.Hour))
+
+	message := func(ts, text string) messagestore.Message {
+		return messagestore.NewMessageFromMessage(&slackevents.MessageEvent{User: "U1", Channel: "C1", Text: text, TimeStamp: ts, ThreadTimeStamp: "1.0"})
+	}
+	if _, err := c.OnMessage(ctx, message("1.0", "<@B1> hello")); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.PutThreadSettings(ctx, "1.0", &messagestore.ThreadSettings{Model: "gpt-4"}); err != nil {
+		t.Fatal(err)
+	}
+
+	// the messages keep the settings alive with the conversation.
+	for i, ts := range []string{"2.0", "3.0"} {
+		mr.FastForward(50 * time.Minute)
+		if _, err := c.OnMessage(ctx, message(ts, fmt.Sprintf("reply %d", i))); err != nil {
+			t.Fatal(err)
+		}
+	}
+	mr.FastForward(50 * time.Minute)
+	if s, err := c.GetThreadSettings(ctx, "1.0"); err != nil || s.Model != "gpt-4" {
+		t.Errorf("the settings expired before the conversation: %+v, %v", s, err)
+	}
+
+	mr.FastForward(time.Hour)
+	if s, err := c.GetThreadSettings(ctx, "1.0"); err != nil || s.Model != "" {
+		t.Errorf("the settings should expire with the conversation: %+v, %v", s, err)
+	}
+}
+
+func TestConversations_IncrementCounter(t *testing.T) {
+	ctx := context.Background()
+	mr := miniredis.RunT(t)
+	c := NewConversations("B1", redis.NewClient(&redis.Options{Addr: mr.Addr()}))
+
+	exp := time.Now().Add(time.Minute)
+	for _, tt := range []struct{ delta, want int64 }{{2, 2}, {3, 5}} {
+		if got, err := c.IncrementCounter(ctx, "k", tt.delta, exp); err != nil || got != tt.want {
+			t.Errorf("got %d, %v, want %d", got, err, tt.want)
+		}
+	}
+	mr.FastForward(2 * time.Minute)
+	if got, _ := c.IncrementCounter(ctx, "k", 1, time.Now().Add(time.Minute)); got != 1 {
+		t.Errorf("got %d after the expiry, want 1", got)
+	}
+}
+
+func TestConversations_HashTag(t *testing.T) {
+	c := NewConversations("B1", nil)
+	for _, k := range c.threadKeys("1.0") {
+		// a cluster hashes the part in the first braces.
+		if i := strings.Index(k, "{"); i < 0 || !strings.HasPrefix(k[i:], "{1.0}") {
+			t.Errorf("%s isn't tagged with the thread", k)
+		}
+	}
+}
+
+// TestConversations_Conformance runs against CHATBOT_REDIS_URL, e.g. redis://localhost:6379/15,
+// or an in-process fake.
+func TestConversations_Conformance(t *testing.T) {
+	var client redis.UniversalClient
+	if url := os.Getenv("CHATBOT_REDIS_URL"); url != "" {
+		opts, err := redis.ParseURL(url)
+		if err != nil {
+			t.Fatal(err)
+		}
+		client = redis.NewClient(opts)
+		defer client.Close()
+	} else {
+		client = redis.NewClient(&redis.Options{Addr: miniredis.RunT(t).Addr()})
+	}
+	storetest.Run(t, "B1", NewConversations("B1", client, WithKeyPrefix(fmt.Sprintf("chatbot-test-%d:", time.Now().UnixNano()))))
+}
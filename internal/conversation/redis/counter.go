@@ -0,0 +1,23 @@
+package redis
+
+import (
+	"context"
+	"github.com/ku/chatbot-slack-llm/messagestore"
+	"github.com/redis/go-redis/v9"
+	"time"
+)
+
+var _ messagestore.CounterStore = (*conversations)(nil)
+
+// incrementCounter sets the expiry only when the counter is created, so that it starts from zero after that.
+var incrementCounter = redis.NewScript(`
+local v = redis.call('INCRBY', KEYS[1], ARGV[1])
+if redis.call('PTTL', KEYS[1]) < 0 then
+	redis.call('PEXPIREAT', KEYS[1], ARGV[2])
+end
+return v
+`)
+
+func (c *conversations) IncrementCounter(ctx context.Context, key string, delta int64, expiresAt time.Time) (int64, error) {
+	return incrementCounter.Run(ctx, c.client, []string{c.prefix + "counter:" + key}, delta, expiresAt.UnixMilli()).Int64()
+}
@@ -0,0 +1,12 @@
+package redis
+
+import (
+	"context"
+	"github.com/ku/chatbot-slack-llm/messagestore"
+)
+
+var _ messagestore.ConversationDeleter = (*conversations)(nil)
+
+func (c *conversations) DeleteConversation(ctx context.Context, thid string) error {
+	return c.client.Del(ctx, c.threadKeys(thid)...).Err()
+}
@@ -0,0 +1,105 @@
+package redis
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/ku/chatbot-slack-llm/messagestore"
+	"github.com/redis/go-redis/v9"
+	"strconv"
+	"time"
+)
+
+var _ messagestore.MessageEditor = (*conversations)(nil)
+
+// edit is the stored form of a previous text. EditedAt is in nanoseconds, kept as a string
+// because the numbers in Lua are floats.
+type edit struct {
+	Text     string `json:"text"`
+	EditedAt string `json:"edited_at"`
+}
+
+// editMessage replaces the text of the message in the channel and appends the previous one to the edits.
+// It returns 1 when the text is changed.
+var editMessage = redis.NewScript(`
+local raw = redis.call('HGET', KEYS[3], ARGV[1])
+if not raw then
+	return 0
+end
+local m = cjson.decode(raw)
+if m.channel ~= ARGV[2] or m.text == ARGV[3] then
+	return 0
+end
+local edits = {}
+local prev = redis.call('HGET', KEYS[4], ARGV[1])
+if prev then
+	edits = cjson.decode(prev)
+end
+table.insert(edits, {text = m.text, edited_at = ARGV[4]})
+redis.call('HSET', KEYS[4], ARGV[1], cjson.encode(edits))
+m.text = ARGV[3]
+redis.call('HSET', KEYS[3], ARGV[1], cjson.encode(m))
+local ttl = tonumber(ARGV[5])
+if ttl > 0 then
+	for _, k in ipairs(KEYS) do
+		redis.call('PEXPIRE', k, ttl)
+	end
+end
+return 1
+`)
+
+// deleteMessage removes the message in the channel and its edits. It returns 1 when the message is removed.
+var deleteMessage = redis.NewScript(`
+local raw = redis.call('HGET', KEYS[3], ARGV[1])
+if not raw or cjson.decode(raw).channel ~= ARGV[2] then
+	return 0
+end
+redis.call('ZREM', KEYS[2], ARGV[1])
+redis.call('HDEL', KEYS[3], ARGV[1])
+redis.call('HDEL', KEYS[4], ARGV[1])
+return 1
+`)
+
+func (c *conversations) EditMessage(ctx context.Context, m messagestore.Message, editedAt time.Time) (bool, error) {
+	edited, err := editMessage.Run(ctx, c.client, c.threadKeys(m.GetThreadID()),
+		m.GetTimestamp(), m.GetChannel(), m.GetRawText(), strconv.FormatInt(editedAt.UnixNano(), 10), c.ttl.Milliseconds(),
+	).Int()
+	if err != nil {
+		return false, fmt.Errorf("failed to edit message %s: %w", m.GetTimestamp(), err)
+	}
+	return edited == 1, nil
+}
+
+func (c *conversations) DeleteMessage(ctx context.Context, m messagestore.Message) (bool, error) {
+	deleted, err := deleteMessage.Run(ctx, c.client, c.threadKeys(m.GetThreadID()),
+		m.GetTimestamp(), m.GetChannel(),
+	).Int()
+	if err != nil {
+		return false, fmt.Errorf("failed to delete message %s: %w", m.GetTimestamp(), err)
+	}
+	return deleted == 1, nil
+}
+
+func (c *conversations) GetEdits(ctx context.Context, m messagestore.Message) ([]*messagestore.Edit, error) {
+	b, err := c.client.HGet(ctx, c.threadKeys(m.GetThreadID())[3], m.GetTimestamp()).Bytes()
+	if err == redis.Nil {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var stored []edit
+	if err := json.Unmarshal(b, &stored); err != nil {
+		return nil, fmt.Errorf("broken edits of %s: %w", m.GetTimestamp(), err)
+	}
+	edits := make([]*messagestore.Edit, len(stored))
+	for i, e := range stored {
+		ns, err := strconv.ParseInt(e.EditedAt, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("broken edits of %s: %w", m.GetTimestamp(), err)
+		}
+		edits[i] = &messagestore.Edit{Text: e.Text, EditedAt: time.Unix(0, ns)}
+	}
+	return edits, nil
+}
@@ -0,0 +1,42 @@
+package redis
+
+import (
+	"context"
+	"github.com/ku/chatbot-slack-llm/messagestore"
+	"github.com/redis/go-redis/v9"
+	"strings"
+	"sync"
+)
+
+var _ messagestore.ConversationLister = (*conversations)(nil)
+
+// ListConversations scans the thread keys, on every master of a cluster.
+// A conversation may be listed twice while the keys are added.
+func (c *conversations) ListConversations(ctx context.Context, f func(thid string) error) error {
+	cc, ok := c.client.(*redis.ClusterClient)
+	if !ok {
+		return c.scanConversations(ctx, c.client, f)
+	}
+	// the masters are scanned concurrently.
+	var mu sync.Mutex
+	return cc.ForEachMaster(ctx, func(ctx context.Context, client *redis.Client) error {
+		return c.scanConversations(ctx, client, func(thid string) error {
+			mu.Lock()
+			defer mu.Unlock()
+			return f(thid)
+		})
+	})
+}
+
+func (c *conversations) scanConversations(ctx context.Context, client redis.UniversalClient, f func(thid string) error) error {
+	prefix := c.prefix + "thread:{"
+	iter := client.Scan(ctx, 0, prefix+"*}", 1000).Iterator()
+	for iter.Next(ctx) {
+		// the other keys of the thread, e.g. {<thid>}:messages, don't end with the brace.
+		thid := strings.TrimSuffix(strings.TrimPrefix(iter.Val(), prefix), "}")
+		if err := f(thid); err != nil {
+			return err
+		}
+	}
+	return iter.Err()
+}
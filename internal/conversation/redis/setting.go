@@ -0,0 +1,42 @@
+package redis
+
+import (
+	"context"
+	"github.com/ku/chatbot-slack-llm/messagestore"
+	"github.com/redis/go-redis/v9"
+)
+
+var _ messagestore.SettingStore = (*conversations)(nil)
+
+func (c *conversations) settingsKey(thid string) string {
+	return c.threadKey(thid) + ":settings"
+}
+
+func (c *conversations) GetThreadSettings(ctx context.Context, thid string) (*messagestore.ThreadSettings, error) {
+	vals, err := c.client.HGetAll(ctx, c.settingsKey(thid)).Result()
+	if err != nil {
+		return nil, err
+	}
+	return &messagestore.ThreadSettings{
+		Model:   vals["model"],
+		Persona: vals["persona"],
+		Debug:   vals["debug"] == "1",
+	}, nil
+}
+
+// PutThreadSettings keeps the settings as long as the conversation.
+func (c *conversations) PutThreadSettings(ctx context.Context, thid string, s *messagestore.ThreadSettings) error {
+	debug := "0"
+	if s.Debug {
+		debug = "1"
+	}
+	key := c.settingsKey(thid)
+	_, err := c.client.TxPipelined(ctx, func(p redis.Pipeliner) error {
+		p.HSet(ctx, key, "model", s.Model, "persona", s.Persona, "debug", debug)
+		if c.ttl > 0 {
+			p.PExpire(ctx, key, c.ttl)
+		}
+		return nil
+	})
+	return err
+}
@@ -0,0 +1,50 @@
+package redis
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/ku/chatbot-slack-llm/messagestore"
+	"github.com/redis/go-redis/v9"
+	"strconv"
+)
+
+var _ messagestore.UsageStore = (*conversations)(nil)
+
+// usagesKey is a sorted set of the records by the time in milliseconds.
+func (c *conversations) usagesKey() string {
+	return c.prefix + "usages"
+}
+
+func (c *conversations) RecordUsage(ctx context.Context, r *messagestore.UsageRecord) error {
+	b, err := json.Marshal(r)
+	if err != nil {
+		return err
+	}
+	return c.client.ZAdd(ctx, c.usagesKey(), redis.Z{Score: float64(r.CreatedAt.UnixMilli()), Member: b}).Err()
+}
+
+func (c *conversations) ListUsage(ctx context.Context, f *messagestore.UsageFilter) ([]*messagestore.UsageRecord, error) {
+	by := &redis.ZRangeBy{Min: "-inf", Max: "+inf"}
+	if !f.From.IsZero() {
+		by.Min = strconv.FormatInt(f.From.UnixMilli(), 10)
+	}
+	if !f.To.IsZero() {
+		by.Max = "(" + strconv.FormatInt(f.To.UnixMilli(), 10)
+	}
+	members, err := c.client.ZRangeByScore(ctx, c.usagesKey(), by).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	var rs []*messagestore.UsageRecord
+	for _, m := range members {
+		r := &messagestore.UsageRecord{}
+		if err := json.Unmarshal([]byte(m), r); err != nil {
+			return nil, err
+		}
+		if f.Match(r) {
+			rs = append(rs, r)
+		}
+	}
+	return rs, nil
+}
@@ -0,0 +1,60 @@
+package spanner
+
+import (
+	"cloud.google.com/go/spanner"
+	"context"
+	"encoding/json"
+	"github.com/ku/chatbot-slack-llm/messagestore"
+	"google.golang.org/grpc/codes"
+	"time"
+)
+
+var _ messagestore.ResponseCacheStore = (*conversations)(nil)
+
+var responseCacheColumns = []string{"CacheKey", "Text", "Model", "PromptTokens", "CompletionTokens", "Sources", "CreatedAt", "ExpiresAt"}
+
+func (c *conversations) GetCachedResponse(ctx context.Context, key string) (*messagestore.CachedResponse, error) {
+	row, err := c.client.Single().ReadRow(ctx, "ResponseCache", spanner.Key{key}, responseCacheColumns)
+	if err != nil {
+		if spanner.ErrCode(err) == codes.NotFound {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	var k string
+	var prompt, completion int64
+	var sources spanner.NullString
+	r := &messagestore.CachedResponse{}
+	if err := row.Columns(&k, &r.Text, &r.Usage.Model, &prompt, &completion, &sources, &r.CreatedAt, &r.ExpiresAt); err != nil {
+		return nil, err
+	}
+	if !time.Now().Before(r.ExpiresAt) {
+		return nil, nil
+	}
+	r.Usage.PromptTokens = int(prompt)
+	r.Usage.CompletionTokens = int(completion)
+	if sources.Valid {
+		if err := json.Unmarshal([]byte(sources.StringVal), &r.Sources); err != nil {
+			return nil, err
+		}
+	}
+	return r, nil
+}
+
+func (c *conversations) PutCachedResponse(ctx context.Context, key string, r *messagestore.CachedResponse) error {
+	var sources spanner.NullString
+	if len(r.Sources) > 0 {
+		b, err := json.Marshal(r.Sources)
+		if err != nil {
+			return err
+		}
+		sources = spanner.NullString{StringVal: string(b), Valid: true}
+	}
+	_, err := c.client.Apply(ctx, []*spanner.Mutation{
+		spanner.InsertOrUpdate("ResponseCache", responseCacheColumns, []interface{}{
+			key, r.Text, r.Usage.Model, int64(r.Usage.PromptTokens), int64(r.Usage.CompletionTokens), sources, r.CreatedAt, r.ExpiresAt,
+		}),
+	})
+	return err
+}
@@ -3,10 +3,13 @@ package spanner
 import (
 	"cloud.google.com/go/spanner"
 	"context"
+	"errors"
+	"fmt"
 	"github.com/ku/chatbot-slack-llm/internal/domains"
 	"github.com/ku/chatbot-slack-llm/messagestore"
 	"google.golang.org/grpc/codes"
-	"math/rand"
+	"hash/fnv"
+	"math"
 	"strings"
 )
 
@@ -17,6 +20,14 @@ type conversations struct {
 
 var _ messagestore.MessageStore = (*conversations)(nil)
 
+var threadsColumns = []string{"ThreadID", "Channel", "Initiator", "CreatedAt"}
+
+// errNoThread aborts the transaction of a message outside the conversations.
+var errNoThread = errors.New("no thread")
+
+// errAdded aborts the transaction of a message retried by Slack.
+var errAdded = errors.New("already added")
+
 func NewConversations(botID string, client *spanner.Client) *conversations {
 	return &conversations{
 		botID:  botID,
@@ -28,68 +39,92 @@ func (c *conversations) Name() string {
 	return "spanner"
 }
 
+// conversationID is the key of the message, derived from the channel and ts so that every replica
+// and retry computes the same one. The messages are also identified by the unique index on them,
+// which rejects a retry even if the key of the message was taken before the migration.
+func conversationID(channel, ts string) int64 {
+	h := fnv.New64a()
+	h.Write([]byte(channel + "/" + ts))
+	return int64(h.Sum64() & math.MaxInt64)
+}
+
 func (c *conversations) OnMessage(ctx context.Context, m messagestore.Message) (bool, error) {
-	if m.GetThreadID() == "" {
-		if !m.IsMentionAt(c.botID) {
-			// received a random message. ignore it.
-			return false, nil
+	thid := m.GetThreadID()
+	_, err := c.client.ReadWriteTransaction(ctx, func(ctx context.Context, txn *spanner.ReadWriteTransaction) error {
+		if _, _, ok, err := findMessage(ctx, txn, m); err != nil {
+			return err
+		} else if ok {
+			return errAdded
+		}
+
+		var ms []*spanner.Mutation
+		_, err := txn.ReadRow(ctx, "Threads", spanner.Key{thid}, []string{"ThreadID"})
+		if spanner.ErrCode(err) == codes.NotFound {
+			if !m.IsMentionAt(c.botID) {
+				// received a random message. ignore it.
+				return errNoThread
+			}
+			ms = append(ms, spanner.Insert("Threads", threadsColumns, []interface{}{
+				thid, m.GetChannel(), m.GetFrom(), m.GetCreatedAt(),
+			}))
+		} else if err != nil {
+			return err
 		}
-	}
 
-	var added bool
-	_, err := c.client.ReadWriteTransaction(ctx, func(ctx context.Context, txn *spanner.ReadWriteTransaction) error {
 		newrec := &domains.Conversation{
-			ConversationID:   rand.Int63(),
+			ConversationID:   conversationID(m.GetChannel(), m.GetTimestamp()),
 			ParentUserID:     m.GetFrom(),
 			Text:             m.GetRawText(),
 			MessageTimestamp: m.GetTimestamp(),
 			ThreadTimestamp:  m.GetThreadTimestamp(),
-			ThreadID:         m.GetThreadID(),
+			ThreadID:         thid,
 			Channel:          m.GetChannel(),
 			CreatedAt:        m.GetCreatedAt(),
 		}
-
-		m := newrec.Insert(ctx)
-		err := txn.BufferWrite([]*spanner.Mutation{m})
-		if err != nil {
-			return nil
-		}
-
-		return nil
+		return txn.BufferWrite(append(ms, newrec.Insert(ctx)))
 	})
-	if err != nil {
-		if spanner.ErrCode(err) != codes.AlreadyExists {
-			return false, err
-		}
-	} else {
-		added = true
+	switch {
+	case errors.Is(err, errNoThread), errors.Is(err, errAdded):
+		return false, nil
+	case spanner.ErrCode(err) == codes.AlreadyExists:
+		// added by a retry at the same time, rejected by the key or the unique index.
+		return false, nil
+	case err != nil:
+		return false, err
 	}
-	return added, nil
+	return true, nil
 }
 
-func (c *conversations) GetConversation(ctx context.Context, conversationID string) (messagestore.Conversation, error) {
+func (c *conversations) GetConversation(ctx context.Context, thid string) (messagestore.Conversation, error) {
 	ro := c.client.ReadOnlyTransaction()
 	defer ro.Close()
 
-	msgs, err := domains.FindConversationsByThreadTimestamp(ctx, ro, conversationID)
+	row, err := ro.ReadRow(ctx, "Threads", spanner.Key{thid}, []string{"Initiator"})
 	if err != nil {
+		if spanner.ErrCode(err) == codes.NotFound {
+			return nil, fmt.Errorf("no conversation found for %s", thid)
+		}
+		return nil, err
+	}
+	cv := &conversation{}
+	if err := row.Columns(&cv.initiator); err != nil {
 		return nil, err
 	}
 
-	return &conversation{
-		msgs: msgs,
-	}, nil
+	cv.msgs, err = domains.FindConversationsByThreadTimestamp(ctx, ro, thid)
+	if err != nil {
+		return nil, err
+	}
+	return cv, nil
 }
 
 func (c *conversation) IsFromInitiater(m messagestore.Message) bool {
-	if len(c.msgs) == 0 {
-		return false
-	}
-	return c.msgs[0].ParentUserID == m.GetFrom()
+	return c.initiator == m.GetFrom()
 }
 
 type conversation struct {
-	msgs []*domains.Conversation
+	initiator string
+	msgs      []*domains.Conversation
 }
 
 func (c *conversation) GetMessages() []messagestore.Message {
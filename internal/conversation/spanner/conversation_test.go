@@ -0,0 +1,44 @@
+package spanner
+
+import (
+	"cloud.google.com/go/spanner"
+	"context"
+	"github.com/ku/chatbot-slack-llm/messagestore/storetest"
+	"os"
+	"testing"
+)
+
+// TestConversations_Conformance runs against the Cloud Spanner emulator, e.g.
+// SPANNER_EMULATOR_HOST=localhost:9010 CHATBOT_SPANNER_DSN=projects/p/instances/i/databases/d
+func TestConversations_Conformance(t *testing.T) {
+	dsn := os.Getenv("CHATBOT_SPANNER_DSN")
+	if os.Getenv("SPANNER_EMULATOR_HOST") == "" || dsn == "" {
+		t.Skip("SPANNER_EMULATOR_HOST and CHATBOT_SPANNER_DSN are not set")
+	}
+	ctx := context.Background()
+	if err := CreateEmulatorDatabase(ctx, dsn); err != nil {
+		t.Fatal(err)
+	}
+	if err := Migrate(ctx, dsn, "B1", 0); err != nil {
+		t.Fatal(err)
+	}
+	client, err := spanner.NewClient(ctx, dsn)
+	if err != nil {
+		t.Fatalf("failed to create spanner client: %s", err.Error())
+	}
+	defer client.Close()
+	storetest.Run(t, "B1", NewConversations("B1", client))
+}
+
+func TestConversationID(t *testing.T) {
+	id := conversationID("C1", "1690000000.123456")
+	if id < 0 {
+		t.Errorf("got a negative key %d", id)
+	}
+	if id != conversationID("C1", "1690000000.123456") {
+		t.Error("the key of a retried message should be the same")
+	}
+	if id == conversationID("C2", "1690000000.123456") {
+		t.Error("the same ts in another channel should have another key")
+	}
+}
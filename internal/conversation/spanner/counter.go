@@ -0,0 +1,45 @@
+package spanner
+
+import (
+	"cloud.google.com/go/spanner"
+	"context"
+	"github.com/ku/chatbot-slack-llm/messagestore"
+	"google.golang.org/grpc/codes"
+	"time"
+)
+
+var _ messagestore.CounterStore = (*conversations)(nil)
+
+// IncrementCounter updates the row of 'Counters' in a read-write transaction.
+// An expired row is overwritten as if it didn't exist.
+func (c *conversations) IncrementCounter(ctx context.Context, key string, delta int64, expiresAt time.Time) (int64, error) {
+	var value int64
+	_, err := c.client.ReadWriteTransaction(ctx, func(ctx context.Context, txn *spanner.ReadWriteTransaction) error {
+		value = delta
+		exp := expiresAt
+
+		row, err := txn.ReadRow(ctx, "Counters", spanner.Key{key}, []string{"Value", "ExpiresAt"})
+		if err != nil && spanner.ErrCode(err) != codes.NotFound {
+			return err
+		}
+		if err == nil {
+			var cur int64
+			var curExp time.Time
+			if err := row.Columns(&cur, &curExp); err != nil {
+				return err
+			}
+			if time.Now().Before(curExp) {
+				value += cur
+				exp = curExp
+			}
+		}
+
+		return txn.BufferWrite([]*spanner.Mutation{
+			spanner.InsertOrUpdate("Counters", []string{"Key", "Value", "ExpiresAt"}, []interface{}{key, value, exp}),
+		})
+	})
+	if err != nil {
+		return 0, err
+	}
+	return value, nil
+}
@@ -0,0 +1,26 @@
+package spanner
+
+import (
+	"cloud.google.com/go/spanner"
+	"context"
+	"github.com/ku/chatbot-slack-llm/internal/domains"
+	"github.com/ku/chatbot-slack-llm/messagestore"
+)
+
+var _ messagestore.ConversationDeleter = (*conversations)(nil)
+
+func (c *conversations) DeleteConversation(ctx context.Context, thid string) error {
+	_, err := c.client.ReadWriteTransaction(ctx, func(ctx context.Context, tx *spanner.ReadWriteTransaction) error {
+		msgs, err := domains.FindConversationsByThreadTimestamp(ctx, tx, thid)
+		if err != nil {
+			return err
+		}
+		ms := make([]*spanner.Mutation, 0, len(msgs)+2)
+		for _, m := range msgs {
+			ms = append(ms, m.Delete(ctx))
+		}
+		ms = append(ms, spanner.Delete("Threads", spanner.Key{thid}), spanner.Delete("ThreadSettings", spanner.Key{thid}))
+		return tx.BufferWrite(ms)
+	})
+	return err
+}
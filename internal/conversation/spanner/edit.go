@@ -0,0 +1,97 @@
+package spanner
+
+import (
+	"cloud.google.com/go/spanner"
+	"context"
+	"github.com/ku/chatbot-slack-llm/internal/domains"
+	"github.com/ku/chatbot-slack-llm/messagestore"
+	"google.golang.org/api/iterator"
+	"time"
+)
+
+var _ messagestore.MessageEditor = (*conversations)(nil)
+
+// findMessage returns the key and the text of the message by the unique index on the channel and ts,
+// since the key isn't always derived from them.
+func findMessage(ctx context.Context, txn domains.YORODB, m messagestore.Message) (int64, string, bool, error) {
+	stmt := spanner.NewStatement("SELECT ConversationID, Text FROM Conversations@{FORCE_INDEX=ConversationsByChannelMessageTimestamp} " +
+		"WHERE Channel = @channel AND MessageTimestamp = @ts")
+	stmt.Params["channel"] = m.GetChannel()
+	stmt.Params["ts"] = m.GetTimestamp()
+
+	iter := txn.Query(ctx, stmt)
+	defer iter.Stop()
+	row, err := iter.Next()
+	if err == iterator.Done {
+		return 0, "", false, nil
+	}
+	if err != nil {
+		return 0, "", false, err
+	}
+	var id int64
+	var text string
+	if err := row.Columns(&id, &text); err != nil {
+		return 0, "", false, err
+	}
+	return id, text, true, nil
+}
+
+func (c *conversations) EditMessage(ctx context.Context, m messagestore.Message, editedAt time.Time) (bool, error) {
+	var edited bool
+	_, err := c.client.ReadWriteTransaction(ctx, func(ctx context.Context, txn *spanner.ReadWriteTransaction) error {
+		edited = false
+		id, text, ok, err := findMessage(ctx, txn, m)
+		if err != nil || !ok || text == m.GetRawText() {
+			return err
+		}
+		edited = true
+		return txn.BufferWrite([]*spanner.Mutation{
+			spanner.Insert("MessageEdits", []string{"ConversationID", "EditedAt", "Text"}, []interface{}{id, editedAt, text}),
+			spanner.Update("Conversations", []string{"ConversationID", "Text"}, []interface{}{id, m.GetRawText()}),
+		})
+	})
+	if err != nil {
+		return false, err
+	}
+	return edited, nil
+}
+
+func (c *conversations) DeleteMessage(ctx context.Context, m messagestore.Message) (bool, error) {
+	var deleted bool
+	_, err := c.client.ReadWriteTransaction(ctx, func(ctx context.Context, txn *spanner.ReadWriteTransaction) error {
+		deleted = false
+		id, _, ok, err := findMessage(ctx, txn, m)
+		if err != nil || !ok {
+			return err
+		}
+		deleted = true
+		// the edits are deleted by the cascade.
+		return txn.BufferWrite([]*spanner.Mutation{spanner.Delete("Conversations", spanner.Key{id})})
+	})
+	if err != nil {
+		return false, err
+	}
+	return deleted, nil
+}
+
+func (c *conversations) GetEdits(ctx context.Context, m messagestore.Message) ([]*messagestore.Edit, error) {
+	ro := c.client.ReadOnlyTransaction()
+	defer ro.Close()
+
+	id, _, ok, err := findMessage(ctx, ro, m)
+	if err != nil || !ok {
+		return nil, err
+	}
+
+	var edits []*messagestore.Edit
+	iter := ro.Read(ctx, "MessageEdits", spanner.Key{id}.AsPrefix(), []string{"Text", "EditedAt"})
+	err = iter.Do(func(row *spanner.Row) error {
+		e := &messagestore.Edit{}
+		if err := row.Columns(&e.Text, &e.EditedAt); err != nil {
+			return err
+		}
+		edits = append(edits, e)
+		return nil
+	})
+	return edits, err
+}
@@ -0,0 +1,21 @@
+package spanner
+
+import (
+	"cloud.google.com/go/spanner"
+	"context"
+	"github.com/ku/chatbot-slack-llm/messagestore"
+)
+
+var _ messagestore.ConversationLister = (*conversations)(nil)
+
+// ListConversations lists the threads in the order of the thread IDs.
+func (c *conversations) ListConversations(ctx context.Context, f func(thid string) error) error {
+	iter := c.client.Single().Read(ctx, "Threads", spanner.AllKeys(), []string{"ThreadID"})
+	return iter.Do(func(row *spanner.Row) error {
+		var thid string
+		if err := row.Columns(&thid); err != nil {
+			return err
+		}
+		return f(thid)
+	})
+}
@@ -0,0 +1,320 @@
+package spanner
+
+import (
+	"cloud.google.com/go/spanner"
+	database "cloud.google.com/go/spanner/admin/database/apiv1"
+	"cloud.google.com/go/spanner/admin/database/apiv1/databasepb"
+	instance "cloud.google.com/go/spanner/admin/instance/apiv1"
+	"cloud.google.com/go/spanner/admin/instance/apiv1/instancepb"
+	"context"
+	"embed"
+	"fmt"
+	"github.com/ku/chatbot-slack-llm/messagestore"
+	"google.golang.org/grpc/codes"
+	"io/fs"
+	"log"
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+//go:embed migrations/*.sql
+var migrations embed.FS
+
+// dsnRegex is the database name, e.g. projects/my-project/instances/my-instance/databases/chatbot.
+var dsnRegex = regexp.MustCompile(`^projects/([^/]+)/instances/([^/]+)/databases/([^/]+)$`)
+
+const schemaMigrationsDDL = `CREATE TABLE SchemaMigrations (
+    Version   INT64 NOT NULL,
+    AppliedAt TIMESTAMP NOT NULL OPTIONS (allow_commit_timestamp = true),
+) PRIMARY KEY (Version)`
+
+// backfills move the existing data which a DML statement can't, after the statements of the version.
+var backfills = map[int64]func(ctx context.Context, client *spanner.Client, botID string) error{
+	2: backfillThreads,
+}
+
+// Migration is a versioned set of DDL statements in migrations/<version>_<description>.sql.
+type Migration struct {
+	Version    int64
+	Name       string
+	Statements []string
+}
+
+// Migrations returns the migrations in the order of the versions.
+func Migrations() ([]*Migration, error) {
+	names, err := fs.Glob(migrations, "migrations/*.sql")
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(names)
+
+	var ms []*Migration
+	for _, name := range names {
+		base := strings.TrimPrefix(name, "migrations/")
+		version, err := strconv.ParseInt(strings.SplitN(base, "_", 2)[0], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid migration name %s: %w", base, err)
+		}
+		b, err := migrations.ReadFile(name)
+		if err != nil {
+			return nil, err
+		}
+		m := &Migration{Version: version, Name: base}
+		// the DDL API takes the statements without the semicolons and the comments.
+		var lines []string
+		for _, line := range strings.Split(string(b), "\n") {
+			if !strings.HasPrefix(strings.TrimSpace(line), "--") {
+				lines = append(lines, line)
+			}
+		}
+		for _, stmt := range strings.Split(strings.Join(lines, "\n"), ";") {
+			if stmt = strings.TrimSpace(stmt); stmt != "" {
+				m.Statements = append(m.Statements, stmt)
+			}
+		}
+		ms = append(ms, m)
+	}
+	return ms, nil
+}
+
+// Migrate applies the migrations newer than the versions recorded in SchemaMigrations.
+// The migrations up to baseline are recorded without being applied, for the databases created by hand.
+// botID tells the threads started by a mention in the existing messages.
+func Migrate(ctx context.Context, dsn, botID string, baseline int64) error {
+	admin, err := database.NewDatabaseAdminClient(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to create database admin client: %w", err)
+	}
+	defer admin.Close()
+	client, err := spanner.NewClient(ctx, dsn)
+	if err != nil {
+		return fmt.Errorf("failed to create spanner client: %w", err)
+	}
+	defer client.Close()
+
+	ddl, err := admin.GetDatabaseDdl(ctx, &databasepb.GetDatabaseDdlRequest{Database: dsn})
+	if err != nil {
+		return fmt.Errorf("failed to get ddl of %s: %w", dsn, err)
+	}
+	if !hasTable(ddl.Statements, "SchemaMigrations") {
+		if err := updateDDL(ctx, admin, dsn, []string{schemaMigrationsDDL}); err != nil {
+			return fmt.Errorf("failed to create SchemaMigrations: %w", err)
+		}
+	}
+
+	applied, err := appliedVersions(ctx, client)
+	if err != nil {
+		return err
+	}
+	ms, err := Migrations()
+	if err != nil {
+		return err
+	}
+	for _, m := range ms {
+		if applied[m.Version] {
+			continue
+		}
+		if m.Version <= baseline {
+			log.Printf("spanner: recorded %s as applied", m.Name)
+		} else {
+			if err := apply(ctx, admin, client, dsn, m.Statements); err != nil {
+				return fmt.Errorf("failed to apply %s: %w", m.Name, err)
+			}
+			if backfill, ok := backfills[m.Version]; ok {
+				if err := backfill(ctx, client, botID); err != nil {
+					return fmt.Errorf("failed to backfill %s: %w", m.Name, err)
+				}
+			}
+			log.Printf("spanner: applied %s", m.Name)
+		}
+		if _, err := client.Apply(ctx, []*spanner.Mutation{
+			spanner.Insert("SchemaMigrations", []string{"Version", "AppliedAt"}, []interface{}{m.Version, spanner.CommitTimestamp}),
+		}); err != nil {
+			return fmt.Errorf("failed to record %s: %w", m.Name, err)
+		}
+	}
+	return nil
+}
+
+// apply runs the consecutive DDL statements in a batch and each DML statement as Partitioned DML,
+// so that a migration can fix the existing data between the schema changes without a transaction
+// over the whole table. The DML statements must be idempotent and can't insert rows.
+func apply(ctx context.Context, admin *database.DatabaseAdminClient, client *spanner.Client, dsn string, statements []string) error {
+	var ddl []string
+	for _, stmt := range statements {
+		if !isDML(stmt) {
+			ddl = append(ddl, stmt)
+			continue
+		}
+		if len(ddl) > 0 {
+			if err := updateDDL(ctx, admin, dsn, ddl); err != nil {
+				return err
+			}
+			ddl = nil
+		}
+		if _, err := client.PartitionedUpdate(ctx, spanner.NewStatement(stmt)); err != nil {
+			return err
+		}
+	}
+	if len(ddl) > 0 {
+		return updateDDL(ctx, admin, dsn, ddl)
+	}
+	return nil
+}
+
+// backfillThreads records the threads started by the earliest mention of the bot in them, in batches.
+// The mention may be in the middle of the thread.
+func backfillThreads(ctx context.Context, client *spanner.Client, botID string) error {
+	if botID == "" {
+		return fmt.Errorf("the bot id is required to find the threads")
+	}
+	var ms []*spanner.Mutation
+	flush := func() error {
+		if len(ms) == 0 {
+			return nil
+		}
+		_, err := client.Apply(ctx, ms)
+		ms = nil
+		return err
+	}
+
+	stmt := spanner.Statement{
+		SQL: `SELECT ThreadID, Channel, ParentUserID, Text, CreatedAt FROM Conversations
+WHERE STRPOS(Text, @mention) > 0 ORDER BY ThreadID, CreatedAt, MessageTimestamp`,
+		Params: map[string]interface{}{"mention": "<@" + botID},
+	}
+	isStart := threadStarts(botID)
+	err := client.Single().Query(ctx, stmt).Do(func(row *spanner.Row) error {
+		var thid, channel, initiator, text string
+		var createdAt time.Time
+		if err := row.Columns(&thid, &channel, &initiator, &text, &createdAt); err != nil {
+			return err
+		}
+		if !isStart(thid, text) {
+			return nil
+		}
+		ms = append(ms, spanner.InsertOrUpdate("Threads", threadsColumns, []interface{}{thid, channel, initiator, createdAt}))
+		if len(ms) < 1000 {
+			return nil
+		}
+		return flush()
+	})
+	if err != nil {
+		return err
+	}
+	return flush()
+}
+
+// threadStarts tells if the message is the first mention of the bot in its thread,
+// given the messages in the order of the threads and the time.
+func threadStarts(botID string) func(thid, text string) bool {
+	var last string
+	started := false
+	return func(thid, text string) bool {
+		if started && thid == last {
+			return false
+		}
+		if messagestore.MentionAt(text) != botID {
+			return false
+		}
+		last, started = thid, true
+		return true
+	}
+}
+
+func isDML(stmt string) bool {
+	verb := strings.ToUpper(strings.Fields(stmt)[0])
+	return verb == "INSERT" || verb == "UPDATE" || verb == "DELETE"
+}
+
+func hasTable(statements []string, table string) bool {
+	for _, s := range statements {
+		if strings.HasPrefix(s, "CREATE TABLE "+table+" ") {
+			return true
+		}
+	}
+	return false
+}
+
+func appliedVersions(ctx context.Context, client *spanner.Client) (map[int64]bool, error) {
+	applied := map[int64]bool{}
+	iter := client.Single().Read(ctx, "SchemaMigrations", spanner.AllKeys(), []string{"Version"})
+	err := iter.Do(func(row *spanner.Row) error {
+		var v int64
+		if err := row.Columns(&v); err != nil {
+			return err
+		}
+		applied[v] = true
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to read SchemaMigrations: %w", err)
+	}
+	return applied, nil
+}
+
+func updateDDL(ctx context.Context, admin *database.DatabaseAdminClient, dsn string, statements []string) error {
+	op, err := admin.UpdateDatabaseDdl(ctx, &databasepb.UpdateDatabaseDdlRequest{
+		Database:   dsn,
+		Statements: statements,
+	})
+	if err != nil {
+		return err
+	}
+	return op.Wait(ctx)
+}
+
+// CreateEmulatorDatabase creates the instance and the database of the dsn in the Cloud Spanner emulator
+// unless they exist. It refuses to run without SPANNER_EMULATOR_HOST.
+func CreateEmulatorDatabase(ctx context.Context, dsn string) error {
+	if os.Getenv("SPANNER_EMULATOR_HOST") == "" {
+		return fmt.Errorf("SPANNER_EMULATOR_HOST is not set")
+	}
+	m := dsnRegex.FindStringSubmatch(dsn)
+	if m == nil {
+		return fmt.Errorf("invalid database name %q", dsn)
+	}
+	project, inst, db := m[1], m[2], m[3]
+
+	ic, err := instance.NewInstanceAdminClient(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to create instance admin client: %w", err)
+	}
+	defer ic.Close()
+	iop, err := ic.CreateInstance(ctx, &instancepb.CreateInstanceRequest{
+		Parent:     "projects/" + project,
+		InstanceId: inst,
+		Instance: &instancepb.Instance{
+			Config:      "projects/" + project + "/instanceConfigs/emulator-config",
+			DisplayName: inst,
+			NodeCount:   1,
+		},
+	})
+	if err == nil {
+		_, err = iop.Wait(ctx)
+	}
+	if err != nil && spanner.ErrCode(err) != codes.AlreadyExists {
+		return fmt.Errorf("failed to create instance %s: %w", inst, err)
+	}
+
+	dc, err := database.NewDatabaseAdminClient(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to create database admin client: %w", err)
+	}
+	defer dc.Close()
+	dop, err := dc.CreateDatabase(ctx, &databasepb.CreateDatabaseRequest{
+		Parent:          "projects/" + project + "/instances/" + inst,
+		CreateStatement: "CREATE DATABASE `" + db + "`",
+	})
+	if err == nil {
+		_, err = dop.Wait(ctx)
+	}
+	if err != nil && spanner.ErrCode(err) != codes.AlreadyExists {
+		return fmt.Errorf("failed to create database %s: %w", db, err)
+	}
+	return nil
+}
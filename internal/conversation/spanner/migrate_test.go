@@ -0,0 +1,66 @@
+package spanner
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestMigrations(t *testing.T) {
+	ms, err := Migrations()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ms) == 0 || ms[0].Version != 1 {
+		t.Fatalf("the first migration should be version 1: %+v", ms)
+	}
+	for i, m := range ms {
+		if i > 0 && m.Version <= ms[i-1].Version {
+			t.Errorf("%s isn't newer than %s", m.Name, ms[i-1].Name)
+		}
+		for _, stmt := range m.Statements {
+			if strings.HasSuffix(stmt, ";") || strings.HasPrefix(stmt, "--") || stmt == "" {
+				t.Errorf("%s has an invalid statement %q", m.Name, stmt)
+			}
+			// Partitioned DML can't insert rows.
+			if strings.HasPrefix(strings.ToUpper(stmt), "INSERT") {
+				t.Errorf("%s inserts rows, which should be backfilled instead: %q", m.Name, stmt)
+			}
+		}
+	}
+	if !hasTable(ms[0].Statements, "Conversations") {
+		t.Error("Conversations should be created in the first migration")
+	}
+}
+
+func TestIsDML(t *testing.T) {
+	tests := map[string]bool{
+		"CREATE TABLE Threads (ThreadID STRING(MAX)) PRIMARY KEY (ThreadID)": false,
+		"INSERT INTO Threads (ThreadID) SELECT ThreadID FROM Conversations":  true,
+		"delete from Conversations where true":                               true,
+	}
+	for stmt, want := range tests {
+		if got := isDML(stmt); got != want {
+			t.Errorf("isDML(%q) = %v, want %v", stmt, got, want)
+		}
+	}
+}
+
+func TestThreadStarts(t *testing.T) {
+	isStart := threadStarts("B1")
+	rows := []struct {
+		thid, text string
+		want       bool
+	}{
+		// the root doesn't mention the bot, which is mentioned later.
+		{"1.0", "the build is broken", false},
+		{"1.0", "<@B1> why?", true},
+		{"1.0", "<@B1> and how?", false},
+		{"2.0", "<@B1> what is go?", true},
+		{"3.0", "<@U2> lunch?", false},
+	}
+	for _, r := range rows {
+		if got := isStart(r.thid, r.text); got != r.want {
+			t.Errorf("%s %q: got %v, want %v", r.thid, r.text, got, r.want)
+		}
+	}
+}
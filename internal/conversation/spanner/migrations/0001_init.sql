@@ -0,0 +1,49 @@
+CREATE TABLE Conversations (
+    ConversationID   INT64 NOT NULL,
+    ParentUserID     STRING(MAX) NOT NULL,
+    Text             STRING(MAX) NOT NULL,
+    MessageTimestamp STRING(MAX) NOT NULL,
+    ThreadTimestamp  STRING(MAX) NOT NULL,
+    ThreadID         STRING(MAX) NOT NULL,
+    Channel          STRING(MAX) NOT NULL,
+    CreatedAt        TIMESTAMP NOT NULL,
+) PRIMARY KEY (ConversationID);
+
+CREATE INDEX ConversationsByThreadID ON Conversations (ThreadID, CreatedAt);
+
+CREATE TABLE ThreadSettings (
+    ThreadID  STRING(MAX) NOT NULL,
+    Model     STRING(MAX) NOT NULL,
+    Persona   STRING(MAX) NOT NULL,
+    Debug     BOOL NOT NULL,
+    UpdatedAt TIMESTAMP NOT NULL OPTIONS (allow_commit_timestamp = true),
+) PRIMARY KEY (ThreadID);
+
+CREATE TABLE Counters (
+    Key       STRING(MAX) NOT NULL,
+    Value     INT64 NOT NULL,
+    ExpiresAt TIMESTAMP NOT NULL,
+) PRIMARY KEY (Key);
+
+CREATE TABLE Usages (
+    UsageID          STRING(MAX) NOT NULL,
+    ThreadID         STRING(MAX) NOT NULL,
+    Channel          STRING(MAX) NOT NULL,
+    UserID           STRING(MAX) NOT NULL,
+    Model            STRING(MAX) NOT NULL,
+    PromptTokens     INT64 NOT NULL,
+    CompletionTokens INT64 NOT NULL,
+    CreatedAt        TIMESTAMP NOT NULL,
+) PRIMARY KEY (UsageID);
+
+CREATE INDEX UsagesByCreatedAt ON Usages (CreatedAt);
+
+CREATE TABLE ResponseCache (
+    CacheKey         STRING(MAX) NOT NULL,
+    Text             STRING(MAX) NOT NULL,
+    Model            STRING(MAX) NOT NULL,
+    PromptTokens     INT64 NOT NULL,
+    CompletionTokens INT64 NOT NULL,
+    CreatedAt        TIMESTAMP NOT NULL,
+    ExpiresAt        TIMESTAMP NOT NULL,
+) PRIMARY KEY (CacheKey);
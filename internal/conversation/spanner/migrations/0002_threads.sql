@@ -0,0 +1,17 @@
+-- Slack retries were stored as separate rows under random keys. Keep the first one of each message.
+DELETE FROM Conversations WHERE ConversationID IN (
+    SELECT c.ConversationID FROM Conversations c
+    JOIN Conversations d ON c.Channel = d.Channel AND c.MessageTimestamp = d.MessageTimestamp
+    WHERE c.ConversationID > d.ConversationID
+);
+
+CREATE UNIQUE INDEX ConversationsByChannelMessageTimestamp ON Conversations (Channel, MessageTimestamp);
+
+-- Threads are started by a mention. Initiator is the user who mentioned the bot.
+-- The threads of the existing messages are backfilled from the first mention of the bot by backfillThreads.
+CREATE TABLE Threads (
+    ThreadID  STRING(MAX) NOT NULL,
+    Channel   STRING(MAX) NOT NULL,
+    Initiator STRING(MAX) NOT NULL,
+    CreatedAt TIMESTAMP NOT NULL,
+) PRIMARY KEY (ThreadID);
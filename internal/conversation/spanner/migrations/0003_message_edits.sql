@@ -0,0 +1,7 @@
+-- The previous texts of the edited messages, deleted with the messages.
+CREATE TABLE MessageEdits (
+    ConversationID INT64 NOT NULL,
+    EditedAt       TIMESTAMP NOT NULL,
+    Text           STRING(MAX) NOT NULL,
+) PRIMARY KEY (ConversationID, EditedAt),
+  INTERLEAVE IN PARENT Conversations ON DELETE CASCADE;
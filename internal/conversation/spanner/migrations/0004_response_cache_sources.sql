@@ -0,0 +1,2 @@
+-- The sources of the cached responses as a JSON array, NULL if there are none.
+ALTER TABLE ResponseCache ADD COLUMN Sources STRING(MAX);
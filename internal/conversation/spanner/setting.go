@@ -0,0 +1,37 @@
+package spanner
+
+import (
+	"cloud.google.com/go/spanner"
+	"context"
+	"github.com/ku/chatbot-slack-llm/messagestore"
+	"google.golang.org/grpc/codes"
+)
+
+var _ messagestore.SettingStore = (*conversations)(nil)
+
+var threadSettingsColumns = []string{"ThreadID", "Model", "Persona", "Debug", "UpdatedAt"}
+
+func (c *conversations) GetThreadSettings(ctx context.Context, thid string) (*messagestore.ThreadSettings, error) {
+	row, err := c.client.Single().ReadRow(ctx, "ThreadSettings", spanner.Key{thid}, []string{"Model", "Persona", "Debug"})
+	if err != nil {
+		if spanner.ErrCode(err) == codes.NotFound {
+			return &messagestore.ThreadSettings{}, nil
+		}
+		return nil, err
+	}
+
+	s := &messagestore.ThreadSettings{}
+	if err := row.Columns(&s.Model, &s.Persona, &s.Debug); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+func (c *conversations) PutThreadSettings(ctx context.Context, thid string, s *messagestore.ThreadSettings) error {
+	_, err := c.client.Apply(ctx, []*spanner.Mutation{
+		spanner.InsertOrUpdate("ThreadSettings", threadSettingsColumns, []interface{}{
+			thid, s.Model, s.Persona, s.Debug, spanner.CommitTimestamp,
+		}),
+	})
+	return err
+}
@@ -0,0 +1,80 @@
+package spanner
+
+import (
+	"cloud.google.com/go/spanner"
+	"context"
+	"fmt"
+	"github.com/ku/chatbot-slack-llm/messagestore"
+	"google.golang.org/api/iterator"
+	"strings"
+)
+
+var _ messagestore.UsageStore = (*conversations)(nil)
+
+var usageColumns = []string{"UsageID", "ThreadID", "Channel", "UserID", "Model", "PromptTokens", "CompletionTokens", "CreatedAt"}
+
+func (c *conversations) RecordUsage(ctx context.Context, r *messagestore.UsageRecord) error {
+	id := fmt.Sprintf("%s/%s/%d", r.Channel, r.ThreadID, r.CreatedAt.UnixNano())
+	_, err := c.client.Apply(ctx, []*spanner.Mutation{
+		spanner.InsertOrUpdate("Usages", usageColumns, []interface{}{
+			id, r.ThreadID, r.Channel, r.User, r.Model, int64(r.PromptTokens), int64(r.CompletionTokens), r.CreatedAt,
+		}),
+	})
+	return err
+}
+
+func (c *conversations) ListUsage(ctx context.Context, f *messagestore.UsageFilter) ([]*messagestore.UsageRecord, error) {
+	var conds []string
+	params := map[string]interface{}{}
+	if !f.From.IsZero() {
+		conds = append(conds, "CreatedAt >= @from")
+		params["from"] = f.From
+	}
+	if !f.To.IsZero() {
+		conds = append(conds, "CreatedAt < @to")
+		params["to"] = f.To
+	}
+	if f.ThreadID != "" {
+		conds = append(conds, "ThreadID = @thread")
+		params["thread"] = f.ThreadID
+	}
+	if f.Channel != "" {
+		conds = append(conds, "Channel = @channel")
+		params["channel"] = f.Channel
+	}
+	if f.User != "" {
+		conds = append(conds, "UserID = @user")
+		params["user"] = f.User
+	}
+
+	sqlstr := "SELECT " + strings.Join(usageColumns, ", ") + " FROM Usages"
+	if len(conds) > 0 {
+		sqlstr += " WHERE " + strings.Join(conds, " AND ")
+	}
+	sqlstr += " ORDER BY CreatedAt ASC"
+
+	iter := c.client.Single().Query(ctx, spanner.Statement{SQL: sqlstr, Params: params})
+	defer iter.Stop()
+
+	var rs []*messagestore.UsageRecord
+	for {
+		row, err := iter.Next()
+		if err == iterator.Done {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		var id string
+		var prompt, completion int64
+		r := &messagestore.UsageRecord{}
+		if err := row.Columns(&id, &r.ThreadID, &r.Channel, &r.User, &r.Model, &prompt, &completion, &r.CreatedAt); err != nil {
+			return nil, err
+		}
+		r.PromptTokens = int(prompt)
+		r.CompletionTokens = int(completion)
+		rs = append(rs, r)
+	}
+	return rs, nil
+}
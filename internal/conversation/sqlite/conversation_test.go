@@ -0,0 +1,106 @@
+package sqlite
+
+import (
+	"context"
+	"github.com/ku/chatbot-slack-llm/messagestore"
+	"github.com/ku/chatbot-slack-llm/messagestore/storetest"
+	"github.com/slack-go/slack/slackevents"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestConversations(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "chatbot.db")
+	db, err := Open(ctx, path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	db.Close()
+	// the migrations are applied once.
+	if db, err = Open(ctx, path); err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	c := NewConversations("B1", db)
+
+	message := func(user, ts, thts, text string) messagestore.Message {
+		return messagestore.NewMessageFromMessage(&slackevents.MessageEvent{User: user, Channel: "C1", Text: text, TimeStamp: ts, ThreadTimeStamp: thts})
+	}
+	tests := []struct {
+		m    messagestore.Message
+		want bool
+	}{
+		{m: message("U1", "1.0", "", "hello"), want: false},
+		{m: message("U1", "1.0", "", "<@B1> hello"), want: true},
+		{m: message("U2", "1.1", "1.0", "hi"), want: true},
+		// retried by slack
+		{m: message("U2", "1.1", "1.0", "hi"), want: false},
+		{m: message("U1", "1.2", "1.0", "thanks"), want: true},
+	}
+	for _, tt := range tests {
+		added, err := c.OnMessage(ctx, tt.m)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if added != tt.want {
+			t.Errorf("%s %q: added = %v, want %v", tt.m.GetTimestamp(), tt.m.GetRawText(), added, tt.want)
+		}
+	}
+
+	cv, err := c.GetConversation(ctx, "1.0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	msgs := cv.GetMessages()
+	if len(msgs) != 3 || msgs[0].GetThreadID() != "1.0" || msgs[2].GetText() != "thanks" {
+		t.Fatalf("unexpected messages: %q", cv.String())
+	}
+	if !cv.IsFromInitiater(msgs[2]) || cv.IsFromInitiater(msgs[1]) {
+		t.Error("the initiator should be the user who mentioned the bot")
+	}
+
+	if err := c.PutThreadSettings(ctx, "1.0", &messagestore.ThreadSettings{Model: "gpt-4", Debug: true}); err != nil {
+		t.Fatal(err)
+	}
+	if s, err := c.GetThreadSettings(ctx, "1.0"); err != nil || s.Model != "gpt-4" || !s.Debug {
+		t.Errorf("got settings %+v, %v", s, err)
+	}
+
+	exp := time.Now().Add(time.Minute)
+	for _, tt := range []struct{ delta, want int64 }{{2, 2}, {3, 5}, {1, 6}} {
+		if got, err := c.IncrementCounter(ctx, "k", tt.delta, exp); err != nil || got != tt.want {
+			t.Errorf("got counter %d, %v, want %d", got, err, tt.want)
+		}
+	}
+
+	cached := &messagestore.CachedResponse{
+		Text:      "cached",
+		Sources:   []messagestore.Source{{Title: "Guide", URL: "https://example.com/guide"}},
+		CreatedAt: time.Now(),
+		ExpiresAt: exp,
+	}
+	if err := c.PutCachedResponse(ctx, "key", cached); err != nil {
+		t.Fatal(err)
+	}
+	if r, err := c.GetCachedResponse(ctx, "key"); err != nil || r == nil || r.Text != "cached" || len(r.Sources) != 1 || r.Sources[0].URL != "https://example.com/guide" {
+		t.Errorf("got cached response %+v, %v", r, err)
+	}
+
+	if err := c.DeleteConversation(ctx, "1.0"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.GetConversation(ctx, "1.0"); err == nil {
+		t.Error("the conversation should be deleted")
+	}
+}
+
+func TestConversations_Conformance(t *testing.T) {
+	db, err := Open(context.Background(), filepath.Join(t.TempDir(), "chatbot.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	storetest.Run(t, "B1", NewConversations("B1", db))
+}
@@ -0,0 +1,26 @@
+package sqlite
+
+import (
+	"context"
+	"github.com/ku/chatbot-slack-llm/messagestore"
+	"time"
+)
+
+var _ messagestore.CounterStore = (*conversations)(nil)
+
+// IncrementCounter upserts the row of counters. An expired row is overwritten as if it didn't exist.
+func (c *conversations) IncrementCounter(ctx context.Context, key string, delta int64, expiresAt time.Time) (int64, error) {
+	var value int64
+	err := c.db.QueryRowContext(ctx,
+		`INSERT INTO counters (key, value, expires_at) VALUES (?1, ?2, ?3)
+		ON CONFLICT (key) DO UPDATE SET
+			value = CASE WHEN counters.expires_at > ?4 THEN counters.value + excluded.value ELSE excluded.value END,
+			expires_at = CASE WHEN counters.expires_at > ?4 THEN counters.expires_at ELSE excluded.expires_at END
+		RETURNING value`,
+		key, delta, expiresAt.UnixNano(), time.Now().UnixNano(),
+	).Scan(&value)
+	if err != nil {
+		return 0, err
+	}
+	return value, nil
+}
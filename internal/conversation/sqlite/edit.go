@@ -0,0 +1,94 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"github.com/ku/chatbot-slack-llm/messagestore"
+	"time"
+)
+
+var _ messagestore.MessageEditor = (*conversations)(nil)
+
+func (c *conversations) EditMessage(ctx context.Context, m messagestore.Message, editedAt time.Time) (bool, error) {
+	tx, err := c.db.BeginTx(ctx, nil)
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback()
+
+	var threadID, text string
+	err = tx.QueryRowContext(ctx, "SELECT thread_id, text FROM messages WHERE channel = ? AND ts = ?", m.GetChannel(), m.GetTimestamp()).Scan(&threadID, &text)
+	if errors.Is(err, sql.ErrNoRows) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	if text == m.GetRawText() {
+		// e.g. a link is unfurled.
+		return false, nil
+	}
+
+	if _, err := tx.ExecContext(ctx,
+		"INSERT INTO message_edits (channel, ts, thread_id, text, edited_at) VALUES (?, ?, ?, ?, ?)",
+		m.GetChannel(), m.GetTimestamp(), threadID, text, editedAt.UnixNano(),
+	); err != nil {
+		return false, fmt.Errorf("failed to insert edit of %s: %w", m.GetTimestamp(), err)
+	}
+	if _, err := tx.ExecContext(ctx,
+		"UPDATE messages SET text = ? WHERE channel = ? AND ts = ?",
+		m.GetRawText(), m.GetChannel(), m.GetTimestamp(),
+	); err != nil {
+		return false, fmt.Errorf("failed to update message %s: %w", m.GetTimestamp(), err)
+	}
+	return true, tx.Commit()
+}
+
+func (c *conversations) DeleteMessage(ctx context.Context, m messagestore.Message) (bool, error) {
+	tx, err := c.db.BeginTx(ctx, nil)
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback()
+
+	res, err := tx.ExecContext(ctx, "DELETE FROM messages WHERE channel = ? AND ts = ?", m.GetChannel(), m.GetTimestamp())
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	if n == 0 {
+		return false, nil
+	}
+	if _, err := tx.ExecContext(ctx, "DELETE FROM message_edits WHERE channel = ? AND ts = ?", m.GetChannel(), m.GetTimestamp()); err != nil {
+		return false, err
+	}
+	return true, tx.Commit()
+}
+
+func (c *conversations) GetEdits(ctx context.Context, m messagestore.Message) ([]*messagestore.Edit, error) {
+	rows, err := c.db.QueryContext(ctx,
+		"SELECT text, edited_at FROM message_edits WHERE channel = ? AND ts = ? ORDER BY edited_at, id",
+		m.GetChannel(), m.GetTimestamp(),
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var edits []*messagestore.Edit
+	for rows.Next() {
+		e := &messagestore.Edit{}
+		var editedAt int64
+		if err := rows.Scan(&e.Text, &editedAt); err != nil {
+			return nil, err
+		}
+		e.EditedAt = unixTime(editedAt)
+		edits = append(edits, e)
+	}
+	return edits, rows.Err()
+}
@@ -0,0 +1,49 @@
+package sqlite
+
+import (
+	"context"
+	"github.com/ku/chatbot-slack-llm/messagestore"
+)
+
+var _ messagestore.ConversationLister = (*conversations)(nil)
+
+// listBatchSize is the number of thread IDs read at once, so that f can use the single connection.
+const listBatchSize = 1000
+
+// ListConversations lists the conversations in the order of the thread IDs.
+func (c *conversations) ListConversations(ctx context.Context, f func(thid string) error) error {
+	var last string
+	for {
+		thids, err := c.listBatch(ctx, last)
+		if err != nil {
+			return err
+		}
+		for _, thid := range thids {
+			if err := f(thid); err != nil {
+				return err
+			}
+		}
+		if len(thids) < listBatchSize {
+			return nil
+		}
+		last = thids[len(thids)-1]
+	}
+}
+
+func (c *conversations) listBatch(ctx context.Context, after string) ([]string, error) {
+	rows, err := c.db.QueryContext(ctx, "SELECT thread_id FROM conversations WHERE thread_id > ? ORDER BY thread_id LIMIT ?", after, listBatchSize)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var thids []string
+	for rows.Next() {
+		var thid string
+		if err := rows.Scan(&thid); err != nil {
+			return nil, err
+		}
+		thids = append(thids, thid)
+	}
+	return thids, rows.Err()
+}
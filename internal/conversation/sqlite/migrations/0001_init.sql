@@ -0,0 +1,55 @@
+CREATE TABLE conversations (
+    thread_id  TEXT NOT NULL PRIMARY KEY,
+    channel    TEXT NOT NULL,
+    initiator  TEXT NOT NULL,
+    created_at INTEGER NOT NULL
+);
+
+CREATE TABLE messages (
+    channel    TEXT NOT NULL,
+    ts         TEXT NOT NULL,
+    thread_id  TEXT NOT NULL,
+    user_id    TEXT NOT NULL,
+    text       TEXT NOT NULL,
+    created_at INTEGER NOT NULL,
+    PRIMARY KEY (channel, ts)
+);
+
+CREATE INDEX messages_by_thread ON messages (thread_id, ts);
+
+CREATE TABLE thread_settings (
+    thread_id  TEXT NOT NULL PRIMARY KEY,
+    model      TEXT NOT NULL,
+    persona    TEXT NOT NULL,
+    debug      INTEGER NOT NULL,
+    updated_at INTEGER NOT NULL
+);
+
+CREATE TABLE counters (
+    key        TEXT NOT NULL PRIMARY KEY,
+    value      INTEGER NOT NULL,
+    expires_at INTEGER NOT NULL
+);
+
+CREATE TABLE usages (
+    id                INTEGER PRIMARY KEY AUTOINCREMENT,
+    thread_id         TEXT NOT NULL,
+    channel           TEXT NOT NULL,
+    user_id           TEXT NOT NULL,
+    model             TEXT NOT NULL,
+    prompt_tokens     INTEGER NOT NULL,
+    completion_tokens INTEGER NOT NULL,
+    created_at        INTEGER NOT NULL
+);
+
+CREATE INDEX usages_by_created_at ON usages (created_at);
+
+CREATE TABLE response_cache (
+    cache_key         TEXT NOT NULL PRIMARY KEY,
+    text              TEXT NOT NULL,
+    model             TEXT NOT NULL,
+    prompt_tokens     INTEGER NOT NULL,
+    completion_tokens INTEGER NOT NULL,
+    created_at        INTEGER NOT NULL,
+    expires_at        INTEGER NOT NULL
+);
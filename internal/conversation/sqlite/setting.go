@@ -0,0 +1,33 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"github.com/ku/chatbot-slack-llm/messagestore"
+	"time"
+)
+
+var _ messagestore.SettingStore = (*conversations)(nil)
+
+func (c *conversations) GetThreadSettings(ctx context.Context, thid string) (*messagestore.ThreadSettings, error) {
+	s := &messagestore.ThreadSettings{}
+	err := c.db.QueryRowContext(ctx, "SELECT model, persona, debug FROM thread_settings WHERE thread_id = ?", thid).
+		Scan(&s.Model, &s.Persona, &s.Debug)
+	if errors.Is(err, sql.ErrNoRows) {
+		return &messagestore.ThreadSettings{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+func (c *conversations) PutThreadSettings(ctx context.Context, thid string, s *messagestore.ThreadSettings) error {
+	_, err := c.db.ExecContext(ctx,
+		`INSERT INTO thread_settings (thread_id, model, persona, debug, updated_at) VALUES (?, ?, ?, ?, ?)
+		ON CONFLICT (thread_id) DO UPDATE SET model = excluded.model, persona = excluded.persona, debug = excluded.debug, updated_at = excluded.updated_at`,
+		thid, s.Model, s.Persona, s.Debug, time.Now().UnixNano(),
+	)
+	return err
+}
@@ -0,0 +1,66 @@
+package sqlite
+
+import (
+	"context"
+	"github.com/ku/chatbot-slack-llm/messagestore"
+	"strings"
+)
+
+var _ messagestore.UsageStore = (*conversations)(nil)
+
+func (c *conversations) RecordUsage(ctx context.Context, r *messagestore.UsageRecord) error {
+	_, err := c.db.ExecContext(ctx,
+		"INSERT INTO usages (thread_id, channel, user_id, model, prompt_tokens, completion_tokens, created_at) VALUES (?, ?, ?, ?, ?, ?, ?)",
+		r.ThreadID, r.Channel, r.User, r.Model, r.PromptTokens, r.CompletionTokens, r.CreatedAt.UnixNano(),
+	)
+	return err
+}
+
+func (c *conversations) ListUsage(ctx context.Context, f *messagestore.UsageFilter) ([]*messagestore.UsageRecord, error) {
+	var conds []string
+	var args []interface{}
+	if !f.From.IsZero() {
+		conds = append(conds, "created_at >= ?")
+		args = append(args, f.From.UnixNano())
+	}
+	if !f.To.IsZero() {
+		conds = append(conds, "created_at < ?")
+		args = append(args, f.To.UnixNano())
+	}
+	if f.ThreadID != "" {
+		conds = append(conds, "thread_id = ?")
+		args = append(args, f.ThreadID)
+	}
+	if f.Channel != "" {
+		conds = append(conds, "channel = ?")
+		args = append(args, f.Channel)
+	}
+	if f.User != "" {
+		conds = append(conds, "user_id = ?")
+		args = append(args, f.User)
+	}
+
+	sqlstr := "SELECT thread_id, channel, user_id, model, prompt_tokens, completion_tokens, created_at FROM usages"
+	if len(conds) > 0 {
+		sqlstr += " WHERE " + strings.Join(conds, " AND ")
+	}
+	sqlstr += " ORDER BY created_at ASC"
+
+	rows, err := c.db.QueryContext(ctx, sqlstr, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var rs []*messagestore.UsageRecord
+	for rows.Next() {
+		var createdAt int64
+		r := &messagestore.UsageRecord{}
+		if err := rows.Scan(&r.ThreadID, &r.Channel, &r.User, &r.Model, &r.PromptTokens, &r.CompletionTokens, &createdAt); err != nil {
+			return nil, err
+		}
+		r.CreatedAt = unixTime(createdAt)
+		rs = append(rs, r)
+	}
+	return rs, rows.Err()
+}
@@ -0,0 +1,83 @@
+// Package sqlmigrate applies the versioned schema migrations of the database/sql messagestores.
+package sqlmigrate
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"io/fs"
+	"log"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Dialect is the difference of the databases in applying migrations.
+type Dialect struct {
+	Name string
+	// Placeholder is the bind variable of the version, e.g. ? or $1.
+	Placeholder string
+	// Lock is run first in the transaction to serialize the migrations of replicas starting at once.
+	Lock string
+}
+
+// Migrate applies the migrations in fsys newer than the version recorded in schema_migrations.
+// A migration is named <version>_<description>.sql and applied in a transaction.
+func Migrate(ctx context.Context, db *sql.DB, fsys fs.FS, d *Dialect) error {
+	if _, err := db.ExecContext(ctx, "CREATE TABLE IF NOT EXISTS schema_migrations (version INTEGER NOT NULL PRIMARY KEY)"); err != nil {
+		return fmt.Errorf("failed to create schema_migrations: %w", err)
+	}
+
+	names, err := fs.Glob(fsys, "*.sql")
+	if err != nil {
+		return err
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		version, err := strconv.Atoi(strings.SplitN(name, "_", 2)[0])
+		if err != nil {
+			return fmt.Errorf("invalid migration name %s: %w", name, err)
+		}
+		applied, err := migrate(ctx, db, fsys, name, version, d)
+		if err != nil {
+			return fmt.Errorf("failed to apply %s: %w", name, err)
+		}
+		if applied {
+			log.Printf("%s: applied %s", d.Name, name)
+		}
+	}
+	return nil
+}
+
+func migrate(ctx context.Context, db *sql.DB, fsys fs.FS, name string, version int, d *Dialect) (bool, error) {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback()
+
+	if d.Lock != "" {
+		if _, err := tx.ExecContext(ctx, d.Lock); err != nil {
+			return false, err
+		}
+	}
+	var current int
+	if err := tx.QueryRowContext(ctx, "SELECT COALESCE(MAX(version), 0) FROM schema_migrations").Scan(&current); err != nil {
+		return false, fmt.Errorf("failed to get schema version: %w", err)
+	}
+	if version <= current {
+		return false, nil
+	}
+
+	b, err := fs.ReadFile(fsys, name)
+	if err != nil {
+		return false, err
+	}
+	if _, err := tx.ExecContext(ctx, string(b)); err != nil {
+		return false, err
+	}
+	if _, err := tx.ExecContext(ctx, "INSERT INTO schema_migrations (version) VALUES ("+d.Placeholder+")", version); err != nil {
+		return false, err
+	}
+	return true, tx.Commit()
+}
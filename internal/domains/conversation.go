@@ -29,8 +29,9 @@ func (c *Conversation) GetThreadTimestamp() string {
 	return c.ThreadTimestamp
 }
 
+// GetMessageID returns unique id of the message.
 func (c *Conversation) GetMessageID() string {
-	return c.GetMessageID()
+	return c.GetTimestamp()
 }
 
 func (c *Conversation) GetTimestamp() string {
@@ -0,0 +1,91 @@
+package embedding
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+)
+
+type HTTPConfig struct {
+	// BaseURL of an OpenAI compatible API, e.g. https://api.openai.com/v1 or a local model server.
+	BaseURL string
+	APIKey  string
+	Model   string
+}
+
+// httpEmbedder calls POST {BaseURL}/embeddings.
+// https://platform.openai.com/docs/api-reference/embeddings
+type httpEmbedder struct {
+	conf   *HTTPConfig
+	client *http.Client
+}
+
+var _ Embedder = (*httpEmbedder)(nil)
+
+func NewHTTPEmbedder(conf *HTTPConfig) *httpEmbedder {
+	return &httpEmbedder{
+		conf:   conf,
+		client: http.DefaultClient,
+	}
+}
+
+type embeddingRequest struct {
+	Model string   `json:"model"`
+	Input []string `json:"input"`
+}
+
+type embeddingResponse struct {
+	Data []struct {
+		Index     int       `json:"index"`
+		Embedding []float32 `json:"embedding"`
+	} `json:"data"`
+}
+
+func (e *httpEmbedder) Embed(ctx context.Context, texts []string) ([][]float32, error) {
+	body, err := json.Marshal(&embeddingRequest{Model: e.conf.Model, Input: texts})
+	if err != nil {
+		return nil, err
+	}
+
+	url := strings.TrimSuffix(e.conf.BaseURL, "/") + "/embeddings"
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if e.conf.APIKey != "" {
+		req.Header.Set("Authorization", "Bearer "+e.conf.APIKey)
+	}
+
+	resp, err := e.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to request embeddings: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		b, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return nil, fmt.Errorf("embeddings: status %d: %s", resp.StatusCode, string(b))
+	}
+
+	var er embeddingResponse
+	if err := json.NewDecoder(resp.Body).Decode(&er); err != nil {
+		return nil, fmt.Errorf("failed to decode embeddings: %w", err)
+	}
+	if len(er.Data) != len(texts) {
+		return nil, fmt.Errorf("embeddings: expected %d vectors, got %d", len(texts), len(er.Data))
+	}
+
+	vectors := make([][]float32, len(texts))
+	for _, d := range er.Data {
+		if d.Index < 0 || d.Index >= len(texts) {
+			return nil, fmt.Errorf("embeddings: index %d out of range", d.Index)
+		}
+		vectors[d.Index] = d.Embedding
+	}
+	return vectors, nil
+}
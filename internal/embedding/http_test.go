@@ -0,0 +1,46 @@
+package embedding
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+)
+
+func TestHTTPEmbedder_Embed(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/embeddings" || r.Header.Get("Authorization") != "Bearer key" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		var req embeddingRequest
+		_ = json.NewDecoder(r.Body).Decode(&req)
+		// the vectors may come in any order.
+		_, _ = w.Write([]byte(`{"data":[{"index":1,"embedding":[0,1]},{"index":0,"embedding":[1,0]}]}`))
+	}))
+	defer srv.Close()
+
+	e := NewHTTPEmbedder(&HTTPConfig{BaseURL: srv.URL + "/v1/", APIKey: "key", Model: "local"})
+	got, err := e.Embed(context.Background(), []string{"a", "b"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := [][]float32{{1, 0}, {0, 1}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Embed() = %v, want %v", got, want)
+	}
+}
+
+func TestCosine(t *testing.T) {
+	if got := Cosine([]float32{1, 0}, []float32{2, 0}); got < 0.999 {
+		t.Errorf("parallel vectors should be 1, got %v", got)
+	}
+	if got := Cosine([]float32{1, 0}, []float32{0, 1}); got != 0 {
+		t.Errorf("orthogonal vectors should be 0, got %v", got)
+	}
+	if got := Cosine([]float32{1}, []float32{1, 0}); got != 0 {
+		t.Errorf("vectors of different length should be 0, got %v", got)
+	}
+}
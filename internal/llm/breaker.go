@@ -0,0 +1,169 @@
+package llm
+
+import (
+	"context"
+	"errors"
+	"expvar"
+	"fmt"
+	"github.com/ku/chatbot-slack-llm/chatbot"
+	"github.com/ku/chatbot-slack-llm/messagestore"
+	"sync"
+	"time"
+)
+
+// metrics are published under "llm" in expvar.
+var metrics = expvar.NewMap("llm")
+
+type BreakerConfig struct {
+	// FailureThreshold is the number of consecutive failures to open the circuit.
+	FailureThreshold int
+	// Cooldown is the duration until an open circuit lets a request through again.
+	Cooldown time.Duration
+}
+
+func DefaultBreakerConfig() *BreakerConfig {
+	return &BreakerConfig{
+		FailureThreshold: 5,
+		Cooldown:         time.Minute,
+	}
+}
+
+type breakerState int
+
+const (
+	breakerClosed breakerState = iota
+	breakerOpen
+	breakerHalfOpen
+)
+
+func (s breakerState) String() string {
+	switch s {
+	case breakerOpen:
+		return "open"
+	case breakerHalfOpen:
+		return "half-open"
+	default:
+		return "closed"
+	}
+}
+
+// breaker short-circuits the client with chatbot.ErrLLMUnavailable after consecutive failures.
+// After the cooldown, a single probe request is let through (half-open)
+// and its result decides whether the circuit closes or opens again.
+type breaker struct {
+	conf   *BreakerConfig
+	client chatbot.LLMClient
+	now    func() time.Time
+
+	mu       sync.Mutex
+	state    breakerState
+	failures int
+	openedAt time.Time
+}
+
+var _ chatbot.LLMClient = (*breaker)(nil)
+var _ chatbot.VarsReporter = (*breaker)(nil)
+
+func NewBreaker(conf *BreakerConfig, client chatbot.LLMClient) *breaker {
+	b := &breaker{
+		conf:   conf,
+		client: client,
+		now:    time.Now,
+	}
+	metrics.Set("breaker."+client.Name()+".state", expvar.Func(func() any {
+		return b.State()
+	}))
+	return b
+}
+
+func (b *breaker) Name() string {
+	return b.client.Name()
+}
+
+func (b *breaker) Unwrap() chatbot.LLMClient {
+	return b.client
+}
+
+func (b *breaker) State() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.state.String()
+}
+
+func (b *breaker) DebugVars() []string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return []string{fmt.Sprintf("breaker %s: %s (%d consecutive failures)", b.client.Name(), b.state, b.failures)}
+}
+
+func (b *breaker) Completion(ctx context.Context, cv messagestore.Conversation) (messagestore.CompletionMessage, error) {
+	if !b.allow() {
+		metrics.Add("breaker."+b.client.Name()+".rejected", 1)
+		return nil, fmt.Errorf("%s: %w", b.client.Name(), chatbot.ErrLLMUnavailable)
+	}
+
+	resp, err := b.client.Completion(ctx, cv)
+	// the request canceled by the caller says nothing about the backend.
+	if errors.Is(err, context.Canceled) {
+		b.release()
+		return nil, err
+	}
+	// a client error like 400 tells the backend is up.
+	b.done(err == nil || !isFailure(err))
+	return resp, err
+}
+
+// isFailure tells if the error counts toward opening the circuit:
+// 429, 5xx and timeouts.
+func isFailure(err error) bool {
+	return isTransient(err) || errors.Is(err, context.DeadlineExceeded)
+}
+
+func (b *breaker) allow() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	switch b.state {
+	case breakerOpen:
+		if b.now().Sub(b.openedAt) < b.conf.Cooldown {
+			return false
+		}
+		b.state = breakerHalfOpen
+		return true
+	case breakerHalfOpen:
+		// a probe is in flight.
+		return false
+	default:
+		return true
+	}
+}
+
+// release lets another probe through when the probe didn't finish.
+func (b *breaker) release() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.state == breakerHalfOpen {
+		b.state = breakerOpen
+		b.openedAt = b.now().Add(-b.conf.Cooldown)
+	}
+}
+
+func (b *breaker) done(ok bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if ok {
+		b.state = breakerClosed
+		b.failures = 0
+		return
+	}
+
+	b.failures++
+	if b.state == breakerHalfOpen || b.failures >= b.conf.FailureThreshold {
+		if b.state != breakerOpen {
+			metrics.Add("breaker."+b.client.Name()+".opened", 1)
+		}
+		b.state = breakerOpen
+		b.openedAt = b.now()
+	}
+}
@@ -0,0 +1,78 @@
+package llm
+
+import (
+	"context"
+	"errors"
+	"github.com/ku/chatbot-slack-llm/chatbot"
+	"testing"
+	"time"
+)
+
+func TestBreaker_Completion(t *testing.T) {
+	ctx := context.Background()
+	now := time.Now()
+	backendErr := &temporaryError{}
+
+	client := &failingClient{name: "breaker-test", errs: []error{backendErr, backendErr, backendErr}}
+	b := NewBreaker(&BreakerConfig{FailureThreshold: 2, Cooldown: time.Minute}, client)
+	b.now = func() time.Time { return now }
+
+	for i := 0; i < 2; i++ {
+		if _, err := b.Completion(ctx, nil); !errors.Is(err, backendErr) {
+			t.Fatalf("expected the backend error, got %v", err)
+		}
+	}
+	if b.State() != "open" {
+		t.Fatalf("expected open, got %s", b.State())
+	}
+
+	if _, err := b.Completion(ctx, nil); !errors.Is(err, chatbot.ErrLLMUnavailable) {
+		t.Fatalf("expected ErrLLMUnavailable, got %v", err)
+	}
+	if client.calls != 2 {
+		t.Fatalf("open circuit should not call the backend, called %d times", client.calls)
+	}
+
+	// the probe after the cooldown fails and opens the circuit again.
+	now = now.Add(time.Minute)
+	if _, err := b.Completion(ctx, nil); !errors.Is(err, backendErr) {
+		t.Fatalf("expected the backend error, got %v", err)
+	}
+	if b.State() != "open" {
+		t.Fatalf("expected open, got %s", b.State())
+	}
+
+	now = now.Add(time.Minute)
+	if _, err := b.Completion(ctx, nil); err != nil {
+		t.Fatalf("probe should succeed: %s", err)
+	}
+	if b.State() != "closed" {
+		t.Fatalf("expected closed, got %s", b.State())
+	}
+}
+
+func TestBreaker_ClientErrors(t *testing.T) {
+	ctx := context.Background()
+	badRequest := errors.New("status 400: bad request")
+
+	client := &failingClient{name: "breaker-client-errors", errs: []error{badRequest, badRequest, badRequest, context.DeadlineExceeded, context.DeadlineExceeded}}
+	b := NewBreaker(&BreakerConfig{FailureThreshold: 2, Cooldown: time.Minute}, client)
+
+	for i := 0; i < 3; i++ {
+		if _, err := b.Completion(ctx, nil); !errors.Is(err, badRequest) {
+			t.Fatalf("expected the client error, got %v", err)
+		}
+	}
+	if b.State() != "closed" {
+		t.Fatalf("client errors should not open the circuit, got %s", b.State())
+	}
+
+	for i := 0; i < 2; i++ {
+		if _, err := b.Completion(ctx, nil); !errors.Is(err, context.DeadlineExceeded) {
+			t.Fatalf("expected the timeout, got %v", err)
+		}
+	}
+	if b.State() != "open" {
+		t.Fatalf("timeouts should open the circuit, got %s", b.State())
+	}
+}
@@ -0,0 +1,224 @@
+package llm
+
+import (
+	"container/list"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"github.com/ku/chatbot-slack-llm/chatbot"
+	"github.com/ku/chatbot-slack-llm/internal/completion"
+	"github.com/ku/chatbot-slack-llm/messagestore"
+	"log"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// CacheKeyer is implemented by LLMClients which know what makes a request identical,
+// e.g. model and system prompt in addition to the conversation.
+type CacheKeyer interface {
+	CacheKey(ctx context.Context, cv messagestore.Conversation) (string, error)
+}
+
+type CacheConfig struct {
+	TTL time.Duration
+}
+
+// cache returns the response of an identical request from the stores.
+// The stores are looked up in order and all of them are filled on a miss.
+type cache struct {
+	conf   *CacheConfig
+	client chatbot.LLMClient
+	stores []messagestore.ResponseCacheStore
+	now    func() time.Time
+
+	hits   int64
+	misses int64
+}
+
+var _ chatbot.LLMClient = (*cache)(nil)
+var _ chatbot.VarsReporter = (*cache)(nil)
+
+type cachedMessage struct {
+	r *messagestore.CachedResponse
+}
+
+func (m *cachedMessage) GetText() string {
+	return m.r.Text
+}
+
+// GetUsage returns no tokens since the model isn't called.
+func (m *cachedMessage) GetUsage() messagestore.Usage {
+	return messagestore.Usage{Model: m.r.Usage.Model}
+}
+
+func (m *cachedMessage) GetSources() []messagestore.Source {
+	return m.r.Sources
+}
+
+func (m *cachedMessage) IsCached() bool {
+	return true
+}
+
+func NewCache(conf *CacheConfig, client chatbot.LLMClient, stores ...messagestore.ResponseCacheStore) *cache {
+	return &cache{
+		conf:   conf,
+		client: client,
+		stores: stores,
+		now:    time.Now,
+	}
+}
+
+func (c *cache) Name() string {
+	return c.client.Name()
+}
+
+func (c *cache) DebugVars() []string {
+	vars := []string{fmt.Sprintf("cache %s: %d hits, %d misses", c.client.Name(), atomic.LoadInt64(&c.hits), atomic.LoadInt64(&c.misses))}
+	if vr, ok := c.client.(chatbot.VarsReporter); ok {
+		vars = append(vars, vr.DebugVars()...)
+	}
+	return vars
+}
+
+func (c *cache) Completion(ctx context.Context, cv messagestore.Conversation) (messagestore.CompletionMessage, error) {
+	key, err := c.key(ctx, cv)
+	if err != nil {
+		return nil, err
+	}
+
+	if !completion.OptionsFrom(ctx).NoCache {
+		for _, s := range c.stores {
+			r, err := s.GetCachedResponse(ctx, key)
+			if err != nil {
+				log.Printf("failed to get cached response: %s", err.Error())
+				continue
+			}
+			if r != nil && c.now().Before(r.ExpiresAt) {
+				atomic.AddInt64(&c.hits, 1)
+				metrics.Add("cache.hits", 1)
+				if trace := completion.OptionsFrom(ctx).Trace; trace != nil {
+					trace.Record(fmt.Sprintf("(no request, answered from the cache %s created at %s)", key, r.CreatedAt.Format(time.RFC3339)), r.Text)
+				}
+				return &cachedMessage{r: r}, nil
+			}
+		}
+	}
+	atomic.AddInt64(&c.misses, 1)
+	metrics.Add("cache.misses", 1)
+
+	resp, err := c.client.Completion(ctx, cv)
+	if err != nil {
+		return nil, err
+	}
+
+	now := c.now()
+	r := &messagestore.CachedResponse{
+		Text:      resp.GetText(),
+		Usage:     resp.GetUsage(),
+		CreatedAt: now,
+		ExpiresAt: now.Add(c.conf.TTL),
+	}
+	if sm, ok := resp.(interface{ GetSources() []messagestore.Source }); ok {
+		r.Sources = sm.GetSources()
+	}
+	for _, s := range c.stores {
+		if err := s.PutCachedResponse(ctx, key, r); err != nil {
+			log.Printf("failed to cache response: %s", err.Error())
+		}
+	}
+	return resp, nil
+}
+
+func (c *cache) key(ctx context.Context, cv messagestore.Conversation) (string, error) {
+	// look through the decorators, e.g. breaker, for the backend.
+	for inner := c.client; ; {
+		if k, ok := inner.(CacheKeyer); ok {
+			return k.CacheKey(ctx, cv)
+		}
+		u, ok := inner.(interface{ Unwrap() chatbot.LLMClient })
+		if !ok {
+			break
+		}
+		inner = u.Unwrap()
+	}
+
+	h := sha256.New()
+	h.Write([]byte(c.client.Name()))
+	for _, m := range cv.GetMessages() {
+		role := "assistant"
+		if cv.IsFromInitiater(m) {
+			role = "user"
+		}
+		fmt.Fprintf(h, "\x00%s\x00%s", role, NormalizeText(m.GetText()))
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// NormalizeText collapses white spaces so that trivial differences don't miss the cache.
+func NormalizeText(s string) string {
+	return strings.Join(strings.Fields(s), " ")
+}
+
+// lru is an in-memory ResponseCacheStore which evicts the least recently used entries.
+type lru struct {
+	size int
+
+	mu      sync.Mutex
+	entries map[string]*list.Element
+	order   *list.List
+}
+
+type lruEntry struct {
+	key string
+	r   *messagestore.CachedResponse
+}
+
+var _ messagestore.ResponseCacheStore = (*lru)(nil)
+
+func NewLRUCache(size int) *lru {
+	return &lru{
+		size:    size,
+		entries: make(map[string]*list.Element),
+		order:   list.New(),
+	}
+}
+
+func (l *lru) GetCachedResponse(_ context.Context, key string) (*messagestore.CachedResponse, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	e, ok := l.entries[key]
+	if !ok {
+		return nil, nil
+	}
+	ent := e.Value.(*lruEntry)
+	if !time.Now().Before(ent.r.ExpiresAt) {
+		l.order.Remove(e)
+		delete(l.entries, key)
+		return nil, nil
+	}
+	l.order.MoveToFront(e)
+	return ent.r, nil
+}
+
+func (l *lru) PutCachedResponse(_ context.Context, key string, r *messagestore.CachedResponse) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if e, ok := l.entries[key]; ok {
+		e.Value.(*lruEntry).r = r
+		l.order.MoveToFront(e)
+		return nil
+	}
+
+	l.entries[key] = l.order.PushFront(&lruEntry{key: key, r: r})
+	for l.order.Len() > l.size {
+		e := l.order.Back()
+		l.order.Remove(e)
+		delete(l.entries, e.Value.(*lruEntry).key)
+	}
+	return nil
+}
@@ -0,0 +1,78 @@
+package llm
+
+import (
+	"context"
+	"github.com/ku/chatbot-slack-llm/internal/completion"
+	"github.com/ku/chatbot-slack-llm/internal/conversation/memory"
+	"github.com/ku/chatbot-slack-llm/messagestore"
+	"github.com/slack-go/slack/slackevents"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCache_Completion(t *testing.T) {
+	ctx := context.Background()
+
+	newConversation := func(text string) messagestore.Conversation {
+		return memory.NewConversation(ctx, messagestore.NewMessageFromMessage(&slackevents.MessageEvent{
+			User: "human",
+			Text: text,
+		}))
+	}
+
+	client := &failingClient{name: "backend"}
+	c := NewCache(&CacheConfig{TTL: time.Hour}, client, NewLRUCache(10))
+
+	if _, err := c.Completion(ctx, newConversation("how do I  list files?")); err != nil {
+		t.Fatal(err)
+	}
+
+	trace := &completion.Trace{}
+	resp, err := c.Completion(completion.WithOptions(ctx, &completion.Options{Trace: trace}), newConversation("how do I list files? "))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cm, ok := resp.(interface{ IsCached() bool }); !ok || !cm.IsCached() {
+		t.Fatal("normalized identical prompt should hit the cache")
+	}
+	if client.calls != 1 {
+		t.Fatalf("backend should be called once, called %d times", client.calls)
+	}
+	// debug shows the cached response instead of the previous request.
+	if request, response := trace.Get(); !strings.Contains(request, "answered from the cache") || response != resp.GetText() {
+		t.Errorf("the trace isn't updated on a hit: %q, %q", request, response)
+	}
+
+	ctx = completion.WithOptions(ctx, &completion.Options{NoCache: true})
+	if _, err := c.Completion(ctx, newConversation("how do I list files?")); err != nil {
+		t.Fatal(err)
+	}
+	if client.calls != 2 {
+		t.Fatal("NoCache should bypass the cache")
+	}
+}
+
+func TestLRUCache(t *testing.T) {
+	ctx := context.Background()
+	l := NewLRUCache(2)
+	r := &messagestore.CachedResponse{Text: "a", ExpiresAt: time.Now().Add(time.Hour)}
+
+	_ = l.PutCachedResponse(ctx, "a", r)
+	_ = l.PutCachedResponse(ctx, "b", r)
+	// a is used recently, so b is evicted.
+	_, _ = l.GetCachedResponse(ctx, "a")
+	_ = l.PutCachedResponse(ctx, "c", r)
+
+	if got, _ := l.GetCachedResponse(ctx, "b"); got != nil {
+		t.Fatal("b should be evicted")
+	}
+	if got, _ := l.GetCachedResponse(ctx, "a"); got == nil {
+		t.Fatal("a should be kept")
+	}
+
+	_ = l.PutCachedResponse(ctx, "expired", &messagestore.CachedResponse{ExpiresAt: time.Now().Add(-time.Second)})
+	if got, _ := l.GetCachedResponse(ctx, "expired"); got != nil {
+		t.Fatal("expired entry should not be returned")
+	}
+}
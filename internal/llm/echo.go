@@ -2,6 +2,7 @@ package llm
 
 import (
 	"context"
+	"github.com/ku/chatbot-slack-llm/internal/completion"
 	"github.com/ku/chatbot-slack-llm/messagestore"
 )
 
@@ -15,6 +16,10 @@ func (e *echoMessage) GetText() string {
 	return e.msg
 }
 
+func (e *echoMessage) GetUsage() messagestore.Usage {
+	return messagestore.Usage{Model: "echo"}
+}
+
 func NewEcho() *echo {
 	return &echo{}
 }
@@ -29,5 +34,8 @@ func (e *echo) Completion(ctx context.Context, cv messagestore.Conversation) (me
 		return &echoMessage{"howdy"}, nil
 	}
 	text := msgs[len(msgs)-1].GetText()
+	if trace := completion.OptionsFrom(ctx).Trace; trace != nil {
+		trace.Record(cv.String(), text)
+	}
 	return &echoMessage{text}, nil
 }
@@ -0,0 +1,167 @@
+package llm
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/ku/chatbot-slack-llm/chatbot"
+	"github.com/ku/chatbot-slack-llm/internal/completion"
+	"github.com/ku/chatbot-slack-llm/messagestore"
+	"log"
+	"math/rand"
+	"net"
+	"strings"
+	"time"
+)
+
+type RetryConfig struct {
+	// MaxRetries is the number of retries per backend after the first attempt.
+	MaxRetries int
+	BaseDelay  time.Duration
+	MaxDelay   time.Duration
+}
+
+func DefaultRetryConfig() *RetryConfig {
+	return &RetryConfig{
+		MaxRetries: 2,
+		BaseDelay:  time.Second,
+		MaxDelay:   20 * time.Second,
+	}
+}
+
+// fallback retries transient errors with backoff, then tries the next client.
+type fallback struct {
+	conf    *RetryConfig
+	clients []chatbot.LLMClient
+	sleep   func(ctx context.Context, d time.Duration) error
+}
+
+var _ chatbot.LLMClient = (*fallback)(nil)
+var _ chatbot.VarsReporter = (*fallback)(nil)
+
+// NewFallback returns an LLMClient which tries the clients in order.
+func NewFallback(conf *RetryConfig, clients ...chatbot.LLMClient) *fallback {
+	return &fallback{
+		conf:    conf,
+		clients: clients,
+		sleep:   sleep,
+	}
+}
+
+func (f *fallback) Name() string {
+	names := make([]string, len(f.clients))
+	for i, c := range f.clients {
+		names[i] = c.Name()
+	}
+	return strings.Join(names, " > ")
+}
+
+func (f *fallback) DebugVars() []string {
+	var vars []string
+	for _, c := range f.clients {
+		if vr, ok := c.(chatbot.VarsReporter); ok {
+			vars = append(vars, vr.DebugVars()...)
+		}
+	}
+	return vars
+}
+
+func (f *fallback) Completion(ctx context.Context, cv messagestore.Conversation) (messagestore.CompletionMessage, error) {
+	var lastErr error
+	for i, c := range f.clients {
+		if i == 1 {
+			ctx = withoutModel(ctx)
+		}
+		resp, err := f.completionWithRetry(ctx, c, cv)
+		if err == nil {
+			return resp, nil
+		}
+		if ctx.Err() != nil {
+			return nil, err
+		}
+		log.Printf("llm %s failed, falling back: %s", c.Name(), err.Error())
+		lastErr = err
+	}
+	return nil, fmt.Errorf("all llm backends failed: %w", lastErr)
+}
+
+// withoutModel drops the model override so that the fallbacks answer with their own models.
+func withoutModel(ctx context.Context) context.Context {
+	o := *completion.OptionsFrom(ctx)
+	if o.Model == "" {
+		return ctx
+	}
+	o.Model = ""
+	return completion.WithOptions(ctx, &o)
+}
+
+func (f *fallback) completionWithRetry(ctx context.Context, c chatbot.LLMClient, cv messagestore.Conversation) (messagestore.CompletionMessage, error) {
+	for attempt := 0; ; attempt++ {
+		resp, err := c.Completion(ctx, cv)
+		if err == nil {
+			return resp, nil
+		}
+		if attempt >= f.conf.MaxRetries || !isTransient(err) {
+			return nil, err
+		}
+
+		delay := f.backoff(attempt)
+		if ra := retryAfter(err); ra > 0 {
+			// the next backend answers sooner than waiting over MaxDelay or the deadline.
+			if ra > f.conf.MaxDelay {
+				return nil, err
+			}
+			if deadline, ok := ctx.Deadline(); ok && ra >= time.Until(deadline) {
+				return nil, err
+			}
+			delay = ra
+		}
+		if err := f.sleep(ctx, delay); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// backoff returns a full-jittered exponential delay.
+// https://aws.amazon.com/blogs/architecture/exponential-backoff-and-jitter/
+func (f *fallback) backoff(attempt int) time.Duration {
+	d := f.conf.BaseDelay << attempt
+	if d <= 0 || d > f.conf.MaxDelay {
+		d = f.conf.MaxDelay
+	}
+	if d <= 0 {
+		return 0
+	}
+	return time.Duration(rand.Int63n(int64(d)))
+}
+
+func isTransient(err error) bool {
+	var t interface{ Temporary() bool }
+	if errors.As(err, &t) {
+		return t.Temporary()
+	}
+	var ne net.Error
+	if errors.As(err, &ne) {
+		return ne.Timeout()
+	}
+	return false
+}
+
+func retryAfter(err error) time.Duration {
+	var ra interface{ RetryAfter() time.Duration }
+	if errors.As(err, &ra) {
+		return ra.RetryAfter()
+	}
+	return 0
+}
+
+func sleep(ctx context.Context, d time.Duration) error {
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-t.C:
+		return nil
+	}
+}
@@ -0,0 +1,112 @@
+package llm
+
+import (
+	"context"
+	"errors"
+	"github.com/ku/chatbot-slack-llm/messagestore"
+	"testing"
+	"time"
+)
+
+type temporaryError struct {
+	retryAfter time.Duration
+}
+
+func (e *temporaryError) Error() string             { return "temporary" }
+func (e *temporaryError) Temporary() bool           { return true }
+func (e *temporaryError) RetryAfter() time.Duration { return e.retryAfter }
+
+type failingClient struct {
+	name  string
+	errs  []error
+	calls int
+}
+
+func (f *failingClient) Name() string { return f.name }
+func (f *failingClient) Completion(ctx context.Context, cv messagestore.Conversation) (messagestore.CompletionMessage, error) {
+	f.calls++
+	if len(f.errs) > 0 {
+		err := f.errs[0]
+		f.errs = f.errs[1:]
+		return nil, err
+	}
+	return &echoMessage{f.name}, nil
+}
+
+func TestFallback_Completion(t *testing.T) {
+	ctx := context.Background()
+	conf := &RetryConfig{MaxRetries: 2, BaseDelay: time.Second, MaxDelay: 10 * time.Second}
+
+	t.Run("retries transient errors honoring Retry-After", func(t *testing.T) {
+		primary := &failingClient{name: "primary", errs: []error{&temporaryError{}, &temporaryError{retryAfter: 7 * time.Second}}}
+		f := NewFallback(conf, primary)
+		var delays []time.Duration
+		f.sleep = func(ctx context.Context, d time.Duration) error {
+			delays = append(delays, d)
+			return nil
+		}
+
+		resp, err := f.Completion(ctx, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if resp.GetText() != "primary" || primary.calls != 3 {
+			t.Fatalf("unexpected response %q after %d calls", resp.GetText(), primary.calls)
+		}
+		if len(delays) != 2 || delays[0] >= time.Second || delays[1] != 7*time.Second {
+			t.Fatalf("unexpected delays: %v", delays)
+		}
+	})
+
+	t.Run("falls back without waiting for a long Retry-After", func(t *testing.T) {
+		for name, ra := range map[string]time.Duration{"over MaxDelay": time.Minute, "over the deadline": 5 * time.Second} {
+			t.Run(name, func(t *testing.T) {
+				ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+				defer cancel()
+				primary := &failingClient{name: "primary", errs: []error{&temporaryError{retryAfter: ra}}}
+				secondary := &failingClient{name: "secondary"}
+				f := NewFallback(conf, primary, secondary)
+				f.sleep = func(ctx context.Context, d time.Duration) error {
+					t.Errorf("slept %s", d)
+					return nil
+				}
+
+				resp, err := f.Completion(ctx, nil)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if resp.GetText() != "secondary" || primary.calls != 1 {
+					t.Fatalf("unexpected response %q after %d calls", resp.GetText(), primary.calls)
+				}
+			})
+		}
+	})
+
+	t.Run("falls back on permanent errors", func(t *testing.T) {
+		primary := &failingClient{name: "primary", errs: []error{errors.New("bad request")}}
+		secondary := &failingClient{name: "secondary"}
+		f := NewFallback(conf, primary, secondary)
+		f.sleep = func(ctx context.Context, d time.Duration) error { return nil }
+
+		resp, err := f.Completion(ctx, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if resp.GetText() != "secondary" || primary.calls != 1 {
+			t.Fatalf("unexpected response %q after %d calls", resp.GetText(), primary.calls)
+		}
+	})
+
+	t.Run("fails when all clients fail", func(t *testing.T) {
+		permanent := errors.New("bad request")
+		f := NewFallback(conf,
+			&failingClient{name: "primary", errs: []error{permanent}},
+			&failingClient{name: "secondary", errs: []error{&temporaryError{}, &temporaryError{}, permanent}},
+		)
+		f.sleep = func(ctx context.Context, d time.Duration) error { return nil }
+
+		if _, err := f.Completion(ctx, nil); !errors.Is(err, permanent) {
+			t.Fatalf("expected the last error, got %v", err)
+		}
+	})
+}
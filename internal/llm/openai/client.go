@@ -2,18 +2,65 @@ package openai
 
 import (
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
 	"fmt"
+	"github.com/ku/chatbot-slack-llm/internal/completion"
+	"github.com/ku/chatbot-slack-llm/internal/prompt"
+	"github.com/ku/chatbot-slack-llm/internal/rag"
 	"github.com/ku/chatbot-slack-llm/messagestore"
 	openai "github.com/sashabaranov/go-openai"
+	"net/http"
+	"strings"
+	"time"
 )
 
 type Client struct {
-	client *openai.Client
-	prompt func() (string, error)
+	client      *openai.Client
+	prompt      Prompt
+	model       string
+	temperature float32
+	retriever   Retriever
+	now         func() time.Time
+}
+
+// Prompt renders the system prompt for the request.
+type Prompt interface {
+	Render(data *prompt.Data) (string, error)
+}
+
+// Retriever finds the documents to ground the answer on.
+type Retriever interface {
+	Retrieve(ctx context.Context, query string) ([]*rag.Chunk, error)
+}
+
+type Option func(c *Client)
+
+// WithModel replaces the default model, gpt-3.5-turbo.
+func WithModel(model string) Option {
+	return func(c *Client) {
+		c.model = model
+	}
+}
+
+// WithTemperature replaces the default temperature, 0.
+func WithTemperature(t float32) Option {
+	return func(c *Client) {
+		c.temperature = t
+	}
+}
+
+// WithRetriever injects the documents relevant to the latest question into the prompt.
+func WithRetriever(r Retriever) Option {
+	return func(c *Client) {
+		c.retriever = r
+	}
 }
 
 type openaiCompletionResponse struct {
-	resp *openai.ChatCompletionResponse
+	resp    *openai.ChatCompletionResponse
+	sources []messagestore.Source
 }
 
 func (o *openaiCompletionResponse) GetText() string {
@@ -24,48 +71,185 @@ func (o *openaiCompletionResponse) GetText() string {
 	return o.resp.Choices[0].Message.Content
 }
 
-func NewClient(apiKey string, prompt func() (string, error)) *Client {
-	return &Client{
-		client: openai.NewClient(apiKey),
-		prompt: prompt,
+func (o *openaiCompletionResponse) GetSources() []messagestore.Source {
+	return o.sources
+}
+
+func (o *openaiCompletionResponse) GetUsage() messagestore.Usage {
+	return messagestore.Usage{
+		Model:            o.resp.Model,
+		PromptTokens:     o.resp.Usage.PromptTokens,
+		CompletionTokens: o.resp.Usage.CompletionTokens,
 	}
 }
 
+func NewClient(apiKey string, p Prompt, opts ...Option) *Client {
+	conf := openai.DefaultConfig(apiKey)
+	conf.HTTPClient = &http.Client{
+		Transport: &transport{base: http.DefaultTransport},
+	}
+
+	c := &Client{
+		client: openai.NewClientWithConfig(conf),
+		prompt: p,
+		model:  openai.GPT3Dot5Turbo,
+		now:    time.Now,
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	return c
+}
+
 func (c *Client) Name() string {
-	return "openai"
+	return "openai/" + c.model
+}
+
+// CacheKey hashes the model, the temperature, the messages including the system prompt and the retrieved documents.
+// The prompt is rendered without the time and the user so that the same question hits the cache
+// whenever and by whomever it's asked, while a change of the index misses it.
+func (c *Client) CacheKey(ctx context.Context, cv messagestore.Conversation) (string, error) {
+	docs, err := c.retrieve(ctx, cv)
+	if err != nil {
+		return "", err
+	}
+	o := *completion.OptionsFrom(ctx)
+	o.UserName = ""
+	system, err := c.render(completion.WithOptions(ctx, &o), cv, nil, time.Time{})
+	if err != nil {
+		return "", err
+	}
+
+	h := sha256.New()
+	fmt.Fprintf(h, "%s\x00%g", c.modelFor(ctx), c.temperature)
+	for _, m := range conversationToMessages(cv, system, nil) {
+		fmt.Fprintf(h, "\x00%s\x00%s", m.Role, strings.Join(strings.Fields(m.Content), " "))
+	}
+	for _, d := range docs {
+		fmt.Fprintf(h, "\x00doc\x00%s\x00%x", d.ID, sha256.Sum256([]byte(d.Text)))
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
 }
 
 func (c *Client) Completion(ctx context.Context, cv messagestore.Conversation) (messagestore.CompletionMessage, error) {
 	var resp openai.ChatCompletionResponse
 	var err error
 
-	prompt, err := c.prompt()
+	docs, err := c.retrieve(ctx, cv)
+	if err != nil {
+		return nil, err
+	}
+	system, err := c.render(ctx, cv, docs, c.now())
+	if err != nil {
+		return nil, err
+	}
+	msgs := conversationToMessages(cv, system, docs)
+
+	req := openai.ChatCompletionRequest{
+		Model:       c.modelFor(ctx),
+		Messages:    msgs,
+		Temperature: c.temperature,
+	}
+	trace := completion.OptionsFrom(ctx).Trace
+	ctx, meta := withResponseMeta(ctx)
+	meta.keepBody = trace != nil
+	resp, err = c.client.CreateChatCompletion(ctx, req)
+	if trace != nil {
+		b, _ := json.MarshalIndent(req, "", "  ")
+		trace.Record(string(b), string(meta.body))
+	}
 	if err != nil {
-		return nil, fmt.Errorf("failed to get prompt: %w", err)
+		return nil, fmt.Errorf("failed to create chat completion: %w", wrapError(err, meta))
 	}
-	msgs := conversationToMessages(cv, prompt)
+	return &openaiCompletionResponse{resp: &resp, sources: sources(docs)}, nil
+}
 
-	resp, err = c.client.CreateChatCompletion(
-		ctx, openai.ChatCompletionRequest{
-			Model:       openai.GPT3Dot5Turbo,
-			Messages:    msgs,
-			Temperature: 0,
-		},
-	)
+// modelFor returns the model overridden for the request, or the model of the client.
+func (c *Client) modelFor(ctx context.Context) string {
+	if m := completion.OptionsFrom(ctx).Model; m != "" {
+		return m
+	}
+	return c.model
+}
+
+// render renders the system prompt with the conversation and the names of the user and the channel in the context.
+func (c *Client) render(ctx context.Context, cv messagestore.Conversation, docs []*rag.Chunk, now time.Time) (string, error) {
+	opts := completion.OptionsFrom(ctx)
+	data := &prompt.Data{
+		User:    opts.UserName,
+		Channel: opts.ChannelName,
+		Now:     now,
+	}
+	for _, m := range cv.GetMessages() {
+		role := openai.ChatMessageRoleAssistant
+		if cv.IsFromInitiater(m) {
+			role = openai.ChatMessageRoleUser
+			data.Question = m.GetText()
+		}
+		data.Messages = append(data.Messages, prompt.Message{Role: role, Text: m.GetText()})
+	}
+	for _, d := range docs {
+		data.Docs = append(data.Docs, prompt.Doc{Title: d.Title, URL: d.URL, Text: d.Text})
+	}
+
+	s, err := c.prompt.Render(data)
 	if err != nil {
-		return nil, fmt.Errorf("failed to create chat completion: %w", err)
+		return "", fmt.Errorf("failed to get prompt: %w", err)
+	}
+	return s, nil
+}
+
+// retrieve finds the documents for the latest message from the user.
+func (c *Client) retrieve(ctx context.Context, cv messagestore.Conversation) ([]*rag.Chunk, error) {
+	if c.retriever == nil {
+		return nil, nil
+	}
+	msgs := cv.GetMessages()
+	for i := len(msgs) - 1; i >= 0; i-- {
+		if cv.IsFromInitiater(msgs[i]) {
+			docs, err := c.retriever.Retrieve(ctx, msgs[i].GetText())
+			if err != nil {
+				return nil, fmt.Errorf("failed to retrieve documents: %w", err)
+			}
+			return docs, nil
+		}
+	}
+	return nil, nil
+}
+
+func sources(docs []*rag.Chunk) []messagestore.Source {
+	var srcs []messagestore.Source
+	seen := map[string]bool{}
+	for _, d := range docs {
+		if seen[d.Source] {
+			continue
+		}
+		seen[d.Source] = true
+		srcs = append(srcs, messagestore.Source{Title: d.Title, URL: d.URL})
 	}
-	return &openaiCompletionResponse{resp: &resp}, nil
+	return srcs
 }
 
-func conversationToMessages(cv messagestore.Conversation, prompt string) []openai.ChatCompletionMessage {
+func conversationToMessages(cv messagestore.Conversation, system string, docs []*rag.Chunk) []openai.ChatCompletionMessage {
 	msgs := []openai.ChatCompletionMessage{
 		{
 			Role:    openai.ChatMessageRoleSystem,
-			Content: prompt,
+			Content: system,
 		},
 	}
 
+	if len(docs) > 0 {
+		var b strings.Builder
+		b.WriteString("Answer using the following documents if they are relevant.\n")
+		for i, d := range docs {
+			fmt.Fprintf(&b, "\n[%d] %s\n%s\n", i+1, d.Title, d.Text)
+		}
+		msgs = append(msgs, openai.ChatCompletionMessage{
+			Role:    openai.ChatMessageRoleSystem,
+			Content: b.String(),
+		})
+	}
+
 	for _, m := range cv.GetMessages() {
 		var role string
 		if cv.IsFromInitiater(m) {
@@ -0,0 +1,83 @@
+package openai
+
+import (
+	"context"
+	"github.com/ku/chatbot-slack-llm/internal/completion"
+	"github.com/ku/chatbot-slack-llm/internal/conversation/memory"
+	"github.com/ku/chatbot-slack-llm/internal/prompt"
+	"github.com/ku/chatbot-slack-llm/internal/rag"
+	"github.com/ku/chatbot-slack-llm/messagestore"
+	"github.com/slack-go/slack/slackevents"
+	"strings"
+	"testing"
+	"text/template"
+	"time"
+)
+
+type templatePrompt struct {
+	t *template.Template
+}
+
+func (p *templatePrompt) Render(data *prompt.Data) (string, error) {
+	var b strings.Builder
+	err := p.t.Execute(&b, data)
+	return b.String(), err
+}
+
+type staticRetriever struct {
+	docs []*rag.Chunk
+}
+
+func (r *staticRetriever) Retrieve(context.Context, string) ([]*rag.Chunk, error) {
+	return r.docs, nil
+}
+
+func newConversation(t *testing.T, text string) messagestore.Conversation {
+	t.Helper()
+	ctx := context.Background()
+	store := memory.NewConversations("B1")
+	if _, err := store.OnMessage(ctx, messagestore.NewMessageFromMessage(&slackevents.MessageEvent{
+		User: "U1", Channel: "C1", Text: "<@B1> " + text, TimeStamp: "1.0",
+	})); err != nil {
+		t.Fatal(err)
+	}
+	cv, err := store.GetConversation(ctx, "1.0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cv
+}
+
+func TestClient_CacheKey(t *testing.T) {
+	tmpl, err := prompt.Parse("test", "Now is {{.Now}}. You're talking with {{.User}} in {{.Channel}}.")
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Date(2023, 6, 1, 0, 0, 0, 0, time.UTC)
+	retriever := &staticRetriever{docs: []*rag.Chunk{{ID: "guide#0", Text: "use go"}}}
+	c := NewClient("key", &templatePrompt{t: tmpl}, WithRetriever(retriever))
+	c.now = func() time.Time { return now }
+
+	key := func(user, question string) string {
+		t.Helper()
+		ctx := completion.WithOptions(context.Background(), &completion.Options{UserName: user, ChannelName: "general"})
+		k, err := c.CacheKey(ctx, newConversation(t, question))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return k
+	}
+
+	k := key("alice", "what is go?")
+	now = now.Add(time.Hour)
+	if key("bob", "what is go?") != k {
+		t.Error("the same question should have the same key at another time from another user")
+	}
+	if key("alice", "what is rust?") == k {
+		t.Error("another question should have another key")
+	}
+	retriever.docs[0].Text = "use go 1.21"
+	if key("alice", "what is go?") == k {
+		t.Error("a change of the documents should change the key")
+	}
+}
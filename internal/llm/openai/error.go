@@ -0,0 +1,111 @@
+package openai
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	openai "github.com/sashabaranov/go-openai"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// Error is returned by Completion when the API request fails.
+type Error struct {
+	StatusCode int
+	retryAfter time.Duration
+	err        error
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("openai: status %d: %s", e.StatusCode, e.err.Error())
+}
+
+func (e *Error) Unwrap() error {
+	return e.err
+}
+
+// Temporary reports whether the request can be retried.
+func (e *Error) Temporary() bool {
+	return e.StatusCode == http.StatusTooManyRequests || e.StatusCode >= 500
+}
+
+// RetryAfter returns the duration told by the Retry-After header, or zero.
+func (e *Error) RetryAfter() time.Duration {
+	return e.retryAfter
+}
+
+func wrapError(err error, meta *responseMeta) error {
+	var status int
+	var apiErr *openai.APIError
+	var reqErr *openai.RequestError
+	switch {
+	case errors.As(err, &apiErr):
+		status = apiErr.HTTPStatusCode
+	case errors.As(err, &reqErr):
+		status = reqErr.HTTPStatusCode
+	default:
+		return err
+	}
+	return &Error{
+		StatusCode: status,
+		retryAfter: meta.retryAfter,
+		err:        err,
+	}
+}
+
+// responseMeta is filled by transport with the headers go-openai doesn't expose.
+type responseMeta struct {
+	retryAfter time.Duration
+	// body is the raw response, kept only when keepBody is set.
+	keepBody bool
+	body     []byte
+}
+
+type responseMetaKey struct{}
+
+type transport struct {
+	base http.RoundTripper
+}
+
+func (t *transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	resp, err := t.base.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+	if meta, ok := req.Context().Value(responseMetaKey{}).(*responseMeta); ok {
+		meta.retryAfter = parseRetryAfter(resp.Header.Get("Retry-After"), time.Now())
+		if meta.keepBody {
+			b, err := io.ReadAll(resp.Body)
+			resp.Body.Close()
+			if err != nil {
+				return nil, err
+			}
+			meta.body = b
+			resp.Body = io.NopCloser(bytes.NewReader(b))
+		}
+	}
+	return resp, nil
+}
+
+func withResponseMeta(ctx context.Context) (context.Context, *responseMeta) {
+	meta := &responseMeta{}
+	return context.WithValue(ctx, responseMetaKey{}, meta), meta
+}
+
+// parseRetryAfter accepts both delay-seconds and HTTP-date.
+// https://httpwg.org/specs/rfc9110.html#field.retry-after
+func parseRetryAfter(s string, now time.Time) time.Duration {
+	if s == "" {
+		return 0
+	}
+	if sec, err := strconv.Atoi(s); err == nil {
+		return time.Duration(sec) * time.Second
+	}
+	if t, err := http.ParseTime(s); err == nil && t.After(now) {
+		return t.Sub(now)
+	}
+	return 0
+}
@@ -0,0 +1,27 @@
+package openai
+
+import (
+	"testing"
+	"time"
+)
+
+func Test_parseRetryAfter(t *testing.T) {
+	now := time.Date(2023, 6, 3, 10, 0, 0, 0, time.UTC)
+	tests := map[string]struct {
+		header string
+		want   time.Duration
+	}{
+		"empty":     {header: "", want: 0},
+		"seconds":   {header: "12", want: 12 * time.Second},
+		"http-date": {header: "Sat, 03 Jun 2023 10:00:30 GMT", want: 30 * time.Second},
+		"past date": {header: "Sat, 03 Jun 2023 09:00:00 GMT", want: 0},
+		"invalid":   {header: "soon", want: 0},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			if got := parseRetryAfter(tt.header, now); got != tt.want {
+				t.Errorf("parseRetryAfter() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
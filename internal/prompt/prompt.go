@@ -0,0 +1,127 @@
+// Package prompt renders the system prompt from a text/template file.
+package prompt
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strings"
+	"sync"
+	"text/template"
+	"time"
+)
+
+// Data is passed to the prompt template.
+type Data struct {
+	// User is the display name of the user who asked.
+	User string
+	// Channel is the name of the channel without "#".
+	Channel string
+	Now     time.Time
+	// Question is the latest message from the user.
+	Question string
+	// Messages are the messages in the thread so far, including Question.
+	Messages []Message
+	// Docs are the documents retrieved for Question.
+	Docs []Doc
+}
+
+type Message struct {
+	// Role is "user" or "assistant".
+	Role string
+	Text string
+}
+
+type Doc struct {
+	Title string
+	URL   string
+	Text  string
+}
+
+var funcs = template.FuncMap{
+	"join":  strings.Join,
+	"upper": strings.ToUpper,
+	"lower": strings.ToLower,
+	"trim":  strings.TrimSpace,
+}
+
+// sample fills every field of Data so that Parse can catch the templates which fail only when executed,
+// like a misspelled field.
+var sample = &Data{
+	User:     "alice",
+	Channel:  "general",
+	Now:      time.Date(2023, 6, 1, 9, 0, 0, 0, time.UTC),
+	Question: "how do I restart nginx?",
+	Messages: []Message{{Role: "user", Text: "how do I restart nginx?"}},
+	Docs:     []Doc{{Title: "nginx", URL: "https://example.com/nginx", Text: "systemctl restart nginx"}},
+}
+
+// Parse parses the template and executes it against sample data.
+func Parse(name, text string) (*template.Template, error) {
+	t, err := template.New(name).Funcs(funcs).Parse(text)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse prompt template: %w", err)
+	}
+	if err := t.Execute(io.Discard, sample); err != nil {
+		return nil, fmt.Errorf("failed to execute prompt template: %w", err)
+	}
+	return t, nil
+}
+
+// File is a prompt template parsed from a file.
+// The file is parsed again when it's modified. A broken edit is logged and the previous template is kept.
+type File struct {
+	path string
+
+	mu      sync.Mutex
+	tmpl    *template.Template
+	modTime time.Time
+}
+
+// Load parses the template file so that errors are reported at startup.
+func Load(path string) (*File, error) {
+	f := &File{path: path}
+	if err := f.reload(); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+func (f *File) reload() error {
+	fi, err := os.Stat(f.path)
+	if err != nil {
+		return fmt.Errorf("failed to stat prompt: %w", err)
+	}
+	if f.tmpl != nil && fi.ModTime().Equal(f.modTime) {
+		return nil
+	}
+	// a broken file is not read again until it's modified.
+	f.modTime = fi.ModTime()
+
+	b, err := os.ReadFile(f.path)
+	if err != nil {
+		return fmt.Errorf("failed to read prompt: %w", err)
+	}
+	t, err := Parse(f.path, string(b))
+	if err != nil {
+		return err
+	}
+	f.tmpl = t
+	return nil
+}
+
+func (f *File) Render(data *Data) (string, error) {
+	f.mu.Lock()
+	if err := f.reload(); err != nil {
+		log.Printf("keep the previous prompt: %s", err.Error())
+	}
+	t := f.tmpl
+	f.mu.Unlock()
+
+	var b strings.Builder
+	if err := t.Execute(&b, data); err != nil {
+		return "", fmt.Errorf("failed to render prompt: %w", err)
+	}
+	return b.String(), nil
+}
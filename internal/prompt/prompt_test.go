@@ -0,0 +1,91 @@
+package prompt
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestFile_Render(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "prompt.txt")
+	write := func(s string, mtime time.Time) {
+		if err := os.WriteFile(path, []byte(s), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Chtimes(path, mtime, mtime); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	now := time.Date(2023, 6, 1, 9, 0, 0, 0, time.UTC)
+	data := &Data{
+		User:     "alice",
+		Channel:  "ops",
+		Now:      now,
+		Question: "how to restart nginx?",
+		Docs:     []Doc{{Title: "nginx", Text: "systemctl restart nginx"}},
+	}
+
+	write(`{{.User}} in #{{.Channel}} at {{.Now.Format "2006-01-02"}}: {{.Question}}{{range .Docs}} [{{.Title}}]{{end}}`, now)
+	f, err := Load(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := f.Render(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "alice in #ops at 2023-06-01: how to restart nginx? [nginx]"; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+
+	// a broken edit keeps the previous template.
+	write(`{{.Question`, now.Add(time.Second))
+	got, err = f.Render(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "alice in #ops at 2023-06-01: how to restart nginx? [nginx]"; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+
+	// so does a template which fails only when executed.
+	write(`{{.Question.Text}}`, now.Add(2*time.Second))
+	got, err = f.Render(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "alice in #ops at 2023-06-01: how to restart nginx? [nginx]"; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+	// the broken file isn't parsed again until it's modified.
+	if err := f.reload(); err != nil {
+		t.Errorf("the broken file should not be parsed again: %v", err)
+	}
+
+	write(`Q: {{.Question | upper}}`, now.Add(3*time.Second))
+	got, err = f.Render(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "Q: HOW TO RESTART NGINX?"; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+func TestLoad_ParseError(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "prompt.txt")
+	if err := os.WriteFile(path, []byte("QUESTION: {{.Question"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Load(path); err == nil {
+		t.Error("expected a parse error")
+	}
+	if err := os.WriteFile(path, []byte("QUESTION: {{.Questoin}}"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Load(path); err == nil {
+		t.Error("expected an execute error")
+	}
+}
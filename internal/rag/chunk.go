@@ -0,0 +1,92 @@
+package rag
+
+import (
+	"strings"
+)
+
+// Section is a piece of a Markdown or text document under a heading.
+type Section struct {
+	Heading string
+	Text    string
+}
+
+// SplitText splits the document into sections no longer than size bytes.
+// Paragraphs are kept together unless a single paragraph is longer than size.
+func SplitText(text string, size int) []*Section {
+	var sections []*Section
+	var heading string
+	var buf []string
+	var bufLen int
+
+	flush := func() {
+		if len(buf) > 0 {
+			sections = append(sections, &Section{Heading: heading, Text: strings.Join(buf, "\n\n")})
+		}
+		buf = nil
+		bufLen = 0
+	}
+
+	for _, para := range splitParagraphs(text) {
+		if strings.HasPrefix(para, "#") {
+			flush()
+			heading = strings.TrimSpace(strings.TrimLeft(strings.SplitN(para, "\n", 2)[0], "#"))
+		}
+
+		for _, piece := range splitLong(para, size) {
+			if bufLen > 0 && bufLen+len(piece) > size {
+				flush()
+			}
+			buf = append(buf, piece)
+			bufLen += len(piece) + 2
+		}
+	}
+	flush()
+	return sections
+}
+
+// splitParagraphs splits by blank lines but keeps fenced code blocks in one paragraph.
+func splitParagraphs(text string) []string {
+	var paras []string
+	var cur []string
+	inCode := false
+	for _, line := range strings.Split(strings.ReplaceAll(text, "\r\n", "\n"), "\n") {
+		if strings.HasPrefix(strings.TrimSpace(line), "```") {
+			inCode = !inCode
+		}
+		if !inCode && strings.TrimSpace(line) == "" {
+			if len(cur) > 0 {
+				paras = append(paras, strings.Join(cur, "\n"))
+				cur = nil
+			}
+			continue
+		}
+		cur = append(cur, line)
+	}
+	if len(cur) > 0 {
+		paras = append(paras, strings.Join(cur, "\n"))
+	}
+	return paras
+}
+
+func splitLong(s string, size int) []string {
+	var pieces []string
+	for len(s) > size {
+		cut := strings.LastIndexAny(s[:size], "\n ")
+		if cut <= 0 {
+			cut = size
+			// don't split a utf-8 sequence.
+			for cut > 0 && s[cut]&0xC0 == 0x80 {
+				cut--
+			}
+			if cut == 0 {
+				cut = size
+			}
+		}
+		pieces = append(pieces, s[:cut])
+		s = strings.TrimLeft(s[cut:], "\n ")
+	}
+	if s != "" {
+		pieces = append(pieces, s)
+	}
+	return pieces
+}
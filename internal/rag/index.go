@@ -0,0 +1,165 @@
+package rag
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/ku/chatbot-slack-llm/internal/embedding"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Chunk is a piece of a document with its embedding.
+type Chunk struct {
+	ID     string    `json:"id"`
+	Source string    `json:"source"`
+	Title  string    `json:"title"`
+	URL    string    `json:"url,omitempty"`
+	Text   string    `json:"text"`
+	Vector []float32 `json:"vector"`
+}
+
+// Index keeps the chunks in memory and is saved as a JSON file.
+type Index struct {
+	mu     sync.RWMutex
+	Chunks []*Chunk `json:"chunks"`
+	// Meta keeps the state of the ingestion, e.g. hashes of the indexed files.
+	Meta map[string]string `json:"meta"`
+}
+
+func NewIndex() *Index {
+	return &Index{
+		Meta: map[string]string{},
+	}
+}
+
+// LoadIndex reads the index file. A missing file is an empty index.
+func LoadIndex(path string) (*Index, error) {
+	b, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return NewIndex(), nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	idx := NewIndex()
+	if err := json.Unmarshal(b, idx); err != nil {
+		return nil, fmt.Errorf("failed to parse index %s: %w", path, err)
+	}
+	if idx.Meta == nil {
+		idx.Meta = map[string]string{}
+	}
+	return idx, nil
+}
+
+// Save writes the index to a temporary file and renames it so that readers never see a partial file.
+func (idx *Index) Save(path string) error {
+	idx.mu.RLock()
+	b, err := json.Marshal(idx)
+	idx.mu.RUnlock()
+	if err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(b); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// Replace removes the chunks of the source and adds the new ones.
+func (idx *Index) Replace(source string, chunks []*Chunk) {
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+
+	n := 0
+	for _, c := range idx.Chunks {
+		if c.Source != source {
+			idx.Chunks[n] = c
+			n++
+		}
+	}
+	idx.Chunks = append(idx.Chunks[:n], chunks...)
+}
+
+// Remove removes the chunks and the meta of the source.
+func (idx *Index) Remove(source string) {
+	idx.Replace(source, nil)
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+	delete(idx.Meta, source)
+}
+
+// MetaKeys returns the keys of the meta starting with the prefix.
+func (idx *Index) MetaKeys(prefix string) []string {
+	idx.mu.RLock()
+	defer idx.mu.RUnlock()
+	var keys []string
+	for k := range idx.Meta {
+		if strings.HasPrefix(k, prefix) {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func (idx *Index) GetMeta(key string) string {
+	idx.mu.RLock()
+	defer idx.mu.RUnlock()
+	return idx.Meta[key]
+}
+
+func (idx *Index) SetMeta(key, value string) {
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+	idx.Meta[key] = value
+}
+
+func (idx *Index) Len() int {
+	idx.mu.RLock()
+	defer idx.mu.RUnlock()
+	return len(idx.Chunks)
+}
+
+// Search returns the k chunks most similar to the vector, leaving out the ones less similar than minScore.
+func (idx *Index) Search(v []float32, k int, minScore float32) []*Chunk {
+	idx.mu.RLock()
+	defer idx.mu.RUnlock()
+
+	type scored struct {
+		c     *Chunk
+		score float32
+	}
+	all := make([]scored, 0, len(idx.Chunks))
+	for _, c := range idx.Chunks {
+		if score := embedding.Cosine(v, c.Vector); score >= minScore {
+			all = append(all, scored{c: c, score: score})
+		}
+	}
+	sort.SliceStable(all, func(i, j int) bool {
+		return all[i].score > all[j].score
+	})
+
+	if k > len(all) {
+		k = len(all)
+	}
+	chunks := make([]*Chunk, k)
+	for i := range chunks {
+		chunks[i] = all[i].c
+	}
+	return chunks
+}
@@ -0,0 +1,176 @@
+package rag
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"github.com/ku/chatbot-slack-llm/internal/embedding"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Document is a unit of ingestion, e.g. a file or a Slack thread.
+type Document struct {
+	// Source identifies the document. Adding a document replaces the chunks of the same source.
+	Source string
+	Title  string
+	URL    string
+	Text   string
+}
+
+// filePrefix is the prefix of the sources of the files indexed by AddDir.
+const filePrefix = "file:"
+
+type Indexer struct {
+	index     *Index
+	embedder  embedding.Embedder
+	chunkSize int
+	batchSize int
+}
+
+func NewIndexer(index *Index, embedder embedding.Embedder, chunkSize int) *Indexer {
+	return &Indexer{
+		index:     index,
+		embedder:  embedder,
+		chunkSize: chunkSize,
+		batchSize: 64,
+	}
+}
+
+// Add splits the document into chunks, embeds them and replaces the chunks of the source.
+func (ix *Indexer) Add(ctx context.Context, doc *Document) (int, error) {
+	var chunks []*Chunk
+	for i, s := range SplitText(doc.Text, ix.chunkSize) {
+		title := doc.Title
+		if s.Heading != "" && s.Heading != doc.Title {
+			title += " > " + s.Heading
+		}
+		chunks = append(chunks, &Chunk{
+			ID:     fmt.Sprintf("%s#%d", doc.Source, i),
+			Source: doc.Source,
+			Title:  title,
+			URL:    doc.URL,
+			Text:   s.Text,
+		})
+	}
+
+	for start := 0; start < len(chunks); start += ix.batchSize {
+		end := start + ix.batchSize
+		if end > len(chunks) {
+			end = len(chunks)
+		}
+		texts := make([]string, end-start)
+		for i, c := range chunks[start:end] {
+			// the title helps to find the chunk by what it's about.
+			texts[i] = c.Title + "\n\n" + c.Text
+		}
+		vectors, err := ix.embedder.Embed(ctx, texts)
+		if err != nil {
+			return 0, fmt.Errorf("failed to embed %s: %w", doc.Source, err)
+		}
+		for i, v := range vectors {
+			chunks[start+i].Vector = v
+		}
+	}
+
+	ix.index.Replace(doc.Source, chunks)
+	return len(chunks), nil
+}
+
+// AddDir indexes Markdown and text files under dir which changed since they were indexed,
+// and removes the files deleted or renamed since then. It returns the numbers of the indexed and the removed files.
+// Links point to baseURL joined with the relative path if baseURL is given.
+func (ix *Indexer) AddDir(ctx context.Context, dir, baseURL string) (int, int, error) {
+	var n int
+	seen := map[string]bool{}
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			return nil
+		}
+		switch strings.ToLower(filepath.Ext(path)) {
+		case ".md", ".markdown", ".txt":
+		default:
+			return nil
+		}
+
+		b, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+		rel = filepath.ToSlash(rel)
+
+		source := filePrefix + rel
+		seen[source] = true
+		sum := sha256.Sum256(b)
+		hash := hex.EncodeToString(sum[:])
+		if ix.index.GetMeta(source) == hash {
+			return nil
+		}
+
+		doc := &Document{
+			Source: source,
+			Title:  rel,
+			Text:   string(b),
+		}
+		if baseURL != "" {
+			doc.URL = strings.TrimSuffix(baseURL, "/") + "/" + rel
+		}
+		if _, err := ix.Add(ctx, doc); err != nil {
+			return err
+		}
+		ix.index.SetMeta(source, hash)
+		n++
+		return nil
+	})
+	if err != nil {
+		return n, 0, err
+	}
+
+	var removed int
+	for _, source := range ix.index.MetaKeys(filePrefix) {
+		if !seen[source] {
+			ix.index.Remove(source)
+			removed++
+		}
+	}
+	return n, removed, nil
+}
+
+// Retriever finds the chunks relevant to a query.
+type Retriever struct {
+	index    *Index
+	embedder embedding.Embedder
+	k        int
+	// minScore keeps the chunks unrelated to the query out of the prompt and the citations.
+	minScore float32
+}
+
+func NewRetriever(index *Index, embedder embedding.Embedder, k int, minScore float32) *Retriever {
+	return &Retriever{
+		index:    index,
+		embedder: embedder,
+		k:        k,
+		minScore: minScore,
+	}
+}
+
+func (r *Retriever) Retrieve(ctx context.Context, query string) ([]*Chunk, error) {
+	if r.index.Len() == 0 {
+		return nil, nil
+	}
+	vectors, err := r.embedder.Embed(ctx, []string{query})
+	if err != nil {
+		return nil, fmt.Errorf("failed to embed query: %w", err)
+	}
+	return r.index.Search(vectors[0], r.k, r.minScore), nil
+}
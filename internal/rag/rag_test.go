@@ -0,0 +1,127 @@
+package rag
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestSplitText(t *testing.T) {
+	text := "# Runbook\n\nintro\n\n## Restart\n\nrun this:\n\n```\nsystemctl restart app\n\nsystemctl status app\n```\n\n" + strings.Repeat("word ", 30)
+	got := SplitText(text, 60)
+
+	if len(got) < 3 {
+		t.Fatalf("expected at least 3 sections, got %d", len(got))
+	}
+	if got[0].Heading != "Runbook" {
+		t.Errorf("first heading = %q", got[0].Heading)
+	}
+	for _, s := range got {
+		if strings.Contains(s.Text, "systemctl restart") && !strings.Contains(s.Text, "systemctl status") {
+			t.Errorf("code block should not be split: %q", s.Text)
+		}
+		if s.Heading == "Restart" && len(s.Text) > 60 && !strings.Contains(s.Text, "```") {
+			t.Errorf("section is longer than the size: %q", s.Text)
+		}
+	}
+}
+
+// keywordEmbedder embeds a text into the counts of the keywords.
+type keywordEmbedder struct {
+	keywords []string
+	calls    int
+}
+
+func (k *keywordEmbedder) Embed(_ context.Context, texts []string) ([][]float32, error) {
+	k.calls++
+	vs := make([][]float32, len(texts))
+	for i, t := range texts {
+		v := make([]float32, len(k.keywords))
+		for j, kw := range k.keywords {
+			v[j] = float32(strings.Count(strings.ToLower(t), kw))
+		}
+		vs[i] = v
+	}
+	return vs, nil
+}
+
+func TestIndexer_AddDir(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	files := map[string]string{
+		"deploy.md":   "# Deploy\n\nrun make deploy to deploy the app.",
+		"db/psql.txt": "connect to the database with psql.",
+		"image.png":   "not indexed",
+	}
+	for name, body := range files {
+		path := filepath.Join(dir, name)
+		_ = os.MkdirAll(filepath.Dir(path), 0o755)
+		if err := os.WriteFile(path, []byte(body), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	embedder := &keywordEmbedder{keywords: []string{"deploy", "database"}}
+	idx := NewIndex()
+	ix := NewIndexer(idx, embedder, 1000)
+
+	n, _, err := ix.AddDir(ctx, dir, "https://example.com/runbooks/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 2 {
+		t.Fatalf("expected 2 files indexed, got %d", n)
+	}
+
+	// unchanged files are skipped.
+	calls := embedder.calls
+	if n, _, _ := ix.AddDir(ctx, dir, ""); n != 0 || embedder.calls != calls {
+		t.Fatalf("unchanged files should be skipped, indexed %d", n)
+	}
+
+	// a deleted file is removed, while the other sources are kept.
+	idx.Replace("slack:C1/1.0", []*Chunk{{ID: "slack:C1/1.0#0", Source: "slack:C1/1.0", Vector: []float32{1, 0}}})
+	if err := os.WriteFile(filepath.Join(dir, "rollback.md"), []byte("# Rollback"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if n, removed, err := ix.AddDir(ctx, dir, "https://example.com/runbooks/"); err != nil || n != 1 || removed != 0 {
+		t.Fatalf("indexed %d, removed %d: %v", n, removed, err)
+	}
+	if err := os.Remove(filepath.Join(dir, "rollback.md")); err != nil {
+		t.Fatal(err)
+	}
+	if n, removed, err := ix.AddDir(ctx, dir, ""); err != nil || n != 0 || removed != 1 {
+		t.Fatalf("indexed %d, removed %d: %v", n, removed, err)
+	}
+	for _, c := range idx.Chunks {
+		if c.Source == "file:rollback.md" {
+			t.Errorf("the chunk of the deleted file is left: %+v", c)
+		}
+	}
+	if idx.GetMeta("file:rollback.md") != "" || idx.Len() != 3 {
+		t.Errorf("unexpected index: %d chunks, meta %v", idx.Len(), idx.Meta)
+	}
+
+	path := filepath.Join(t.TempDir(), "index.json")
+	if err := idx.Save(path); err != nil {
+		t.Fatal(err)
+	}
+	loaded, err := LoadIndex(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the chunks unrelated to the question are left out even when k is larger.
+	docs, err := NewRetriever(loaded, embedder, 3, 0.5).Retrieve(ctx, "how do I access the database?")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(docs) != 1 || docs[0].URL != "https://example.com/runbooks/db/psql.txt" {
+		t.Fatalf("unexpected documents: %+v", docs)
+	}
+	if docs, _ := NewRetriever(loaded, embedder, 3, 0.5).Retrieve(ctx, "where is the lunch?"); len(docs) != 0 {
+		t.Fatalf("unexpected documents: %+v", docs)
+	}
+}
@@ -0,0 +1,140 @@
+package semanticcache
+
+import (
+	"context"
+	"fmt"
+	"github.com/ku/chatbot-slack-llm/chatbot"
+	"github.com/ku/chatbot-slack-llm/internal/embedding"
+	"strconv"
+	"sync"
+	"time"
+)
+
+type Config struct {
+	// Threshold is the minimum cosine similarity to offer a cached answer.
+	Threshold  float32
+	MaxEntries int
+	TTL        time.Duration
+}
+
+type entry struct {
+	scope     chatbot.SemanticScope
+	match     chatbot.SemanticMatch
+	vector    []float32
+	createdAt time.Time
+}
+
+// cache keeps the answers to the first questions of threads in memory
+// and finds the most similar question in the same scope by the cosine similarity of embeddings.
+type cache struct {
+	conf     *Config
+	embedder embedding.Embedder
+	now      func() time.Time
+
+	mu      sync.Mutex
+	entries []*entry
+	seq     int64
+}
+
+var _ chatbot.SemanticCache = (*cache)(nil)
+
+func New(conf *Config, embedder embedding.Embedder) *cache {
+	return &cache{
+		conf:     conf,
+		embedder: embedder,
+		now:      time.Now,
+	}
+}
+
+func (c *cache) embed(ctx context.Context, text string) ([]float32, error) {
+	vs, err := c.embedder.Embed(ctx, []string{text})
+	if err != nil {
+		return nil, fmt.Errorf("failed to embed question: %w", err)
+	}
+	return vs[0], nil
+}
+
+func (c *cache) Lookup(ctx context.Context, scope chatbot.SemanticScope, question string) (*chatbot.SemanticMatch, error) {
+	v, err := c.embed(ctx, question)
+	if err != nil {
+		return nil, err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.evict()
+
+	var best *entry
+	var bestScore float32
+	for _, e := range c.entries {
+		if e.scope != scope {
+			continue
+		}
+		if s := embedding.Cosine(v, e.vector); s >= c.conf.Threshold && s > bestScore {
+			best, bestScore = e, s
+		}
+	}
+	if best == nil {
+		return nil, nil
+	}
+
+	m := best.match
+	m.Similarity = bestScore
+	return &m, nil
+}
+
+func (c *cache) Get(_ context.Context, scope chatbot.SemanticScope, id string) (*chatbot.SemanticMatch, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.evict()
+
+	for _, e := range c.entries {
+		if e.match.ID == id && e.scope == scope {
+			m := e.match
+			return &m, nil
+		}
+	}
+	return nil, fmt.Errorf("cached answer %s not found", id)
+}
+
+func (c *cache) Store(ctx context.Context, scope chatbot.SemanticScope, question, answer string) error {
+	v, err := c.embed(ctx, question)
+	if err != nil {
+		return err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.seq++
+	c.entries = append(c.entries, &entry{
+		scope: scope,
+		match: chatbot.SemanticMatch{
+			ID:       strconv.FormatInt(c.seq, 10),
+			Question: question,
+			Answer:   answer,
+		},
+		vector:    v,
+		createdAt: c.now(),
+	})
+	c.evict()
+	return nil
+}
+
+// evict drops expired entries and the oldest ones over MaxEntries.
+func (c *cache) evict() {
+	if c.conf.TTL > 0 {
+		deadline := c.now().Add(-c.conf.TTL)
+		n := 0
+		for _, e := range c.entries {
+			if e.createdAt.After(deadline) {
+				c.entries[n] = e
+				n++
+			}
+		}
+		c.entries = c.entries[:n]
+	}
+	if c.conf.MaxEntries > 0 && len(c.entries) > c.conf.MaxEntries {
+		c.entries = c.entries[len(c.entries)-c.conf.MaxEntries:]
+	}
+}
@@ -0,0 +1,61 @@
+package semanticcache
+
+import (
+	"context"
+	"github.com/ku/chatbot-slack-llm/chatbot"
+	"testing"
+)
+
+type fakeEmbedder map[string][]float32
+
+func (f fakeEmbedder) Embed(_ context.Context, texts []string) ([][]float32, error) {
+	vs := make([][]float32, len(texts))
+	for i, t := range texts {
+		vs[i] = f[t]
+	}
+	return vs, nil
+}
+
+func TestCache_Lookup(t *testing.T) {
+	ctx := context.Background()
+	embedder := fakeEmbedder{
+		"how do I list files?":          {1, 0, 0},
+		"how can I list the files?":     {0.95, 0.05, 0},
+		"how do I restart the service?": {0, 1, 0},
+	}
+	c := New(&Config{Threshold: 0.9, MaxEntries: 10}, embedder)
+	scope := chatbot.SemanticScope{Channel: "C1", Persona: "default"}
+
+	if err := c.Store(ctx, scope, "how do I list files?", "ls"); err != nil {
+		t.Fatal(err)
+	}
+
+	m, err := c.Lookup(ctx, scope, "how can I list the files?")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m == nil || m.Answer != "ls" || m.Similarity < 0.9 {
+		t.Fatalf("paraphrase should match: %+v", m)
+	}
+
+	got, err := c.Get(ctx, scope, m.ID)
+	if err != nil || got.Answer != "ls" {
+		t.Fatalf("Get(%s) = %+v, %v", m.ID, got, err)
+	}
+
+	if m, _ := c.Lookup(ctx, scope, "how do I restart the service?"); m != nil {
+		t.Fatalf("unrelated question should not match: %+v", m)
+	}
+
+	for _, other := range []chatbot.SemanticScope{
+		{Channel: "C2", Persona: "default"},
+		{Channel: "C1", Persona: "support"},
+	} {
+		if m, _ := c.Lookup(ctx, other, "how can I list the files?"); m != nil {
+			t.Errorf("answer in %+v should not match in %+v: %+v", scope, other, m)
+		}
+		if _, err := c.Get(ctx, other, got.ID); err == nil {
+			t.Errorf("answer in %+v should not be got in %+v", scope, other)
+		}
+	}
+}
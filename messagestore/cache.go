@@ -0,0 +1,22 @@
+package messagestore
+
+import (
+	"context"
+	"time"
+)
+
+// CachedResponse is an llm response kept for identical prompts.
+type CachedResponse struct {
+	Text      string
+	Usage     Usage
+	Sources   []Source
+	CreatedAt time.Time
+	ExpiresAt time.Time
+}
+
+// ResponseCacheStore is implemented by MessageStores which can cache llm responses.
+type ResponseCacheStore interface {
+	// GetCachedResponse returns nil if the key is missing or expired.
+	GetCachedResponse(ctx context.Context, key string) (*CachedResponse, error)
+	PutCachedResponse(ctx context.Context, key string, r *CachedResponse) error
+}
@@ -0,0 +1,13 @@
+package messagestore
+
+import (
+	"context"
+	"time"
+)
+
+// CounterStore is implemented by MessageStores which can persist counters, e.g. for rate limits.
+type CounterStore interface {
+	// IncrementCounter adds delta to the counter and returns the new value.
+	// The counter starts from zero again after expiresAt.
+	IncrementCounter(ctx context.Context, key string, delta int64, expiresAt time.Time) (int64, error)
+}
@@ -0,0 +1,9 @@
+package messagestore
+
+import "context"
+
+// ConversationDeleter is implemented by MessageStores which can forget conversations.
+type ConversationDeleter interface {
+	// DeleteConversation deletes the messages and the settings of the thread.
+	DeleteConversation(ctx context.Context, thid string) error
+}
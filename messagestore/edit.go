@@ -0,0 +1,25 @@
+package messagestore
+
+import (
+	"context"
+	"time"
+)
+
+// MessageEditor is implemented by MessageStores which follow the edits and the deletions of the messages in Slack.
+// A message is identified by its channel and timestamp.
+type MessageEditor interface {
+	// EditMessage replaces the text of the stored message with the one of m, and keeps the previous text
+	// in the history. It returns false when the message isn't stored.
+	EditMessage(ctx context.Context, m Message, editedAt time.Time) (bool, error)
+	// DeleteMessage removes the message and its history from the conversation.
+	// It returns false when the message isn't stored.
+	DeleteMessage(ctx context.Context, m Message) (bool, error)
+	// GetEdits returns the previous texts of the message, oldest first.
+	GetEdits(ctx context.Context, m Message) ([]*Edit, error)
+}
+
+// Edit is a text of a message before it was edited at EditedAt.
+type Edit struct {
+	Text     string
+	EditedAt time.Time
+}
@@ -0,0 +1,10 @@
+package messagestore
+
+import "context"
+
+// ConversationLister is implemented by MessageStores which can enumerate their conversations, e.g. for the export.
+type ConversationLister interface {
+	// ListConversations calls f with the thread ID of each conversation until f returns an error.
+	// The order is up to the store.
+	ListConversations(ctx context.Context, f func(thid string) error) error
+}
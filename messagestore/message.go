@@ -36,6 +36,24 @@ type Message interface {
 
 type CompletionMessage interface {
 	GetText() string
+	GetUsage() Usage
+}
+
+// Usage is the number of tokens the llm used for a completion.
+type Usage struct {
+	Model            string
+	PromptTokens     int
+	CompletionTokens int
+}
+
+func (u Usage) TotalTokens() int {
+	return u.PromptTokens + u.CompletionTokens
+}
+
+// Source is a document which the completion was grounded on.
+type Source struct {
+	Title string
+	URL   string
 }
 
 func NewMessageFromMention(ev *slackevents.AppMentionEvent) *SlackMessage {
@@ -63,11 +81,18 @@ func NewMessageFromMessage(ev *slackevents.MessageEvent) *SlackMessage {
 }
 
 func NewMessageFromCompletionMessage(channel string, thid string, m CompletionMessage) *SlackMessage {
+	cm, _ := m.(interface{ IsCached() bool })
+	var sources []Source
+	if sm, ok := m.(interface{ GetSources() []Source }); ok {
+		sources = sm.GetSources()
+	}
 	return &SlackMessage{
 		From:     "",
 		Text:     m.GetText(),
 		ThreadTS: thid,
 		Channel:  channel,
+		Cached:   cm != nil && cm.IsCached(),
+		Sources:  sources,
 	}
 }
 
@@ -0,0 +1,20 @@
+package messagestore
+
+import "context"
+
+// ThreadSettings are the overrides set by commands in a thread.
+type ThreadSettings struct {
+	// Model replaces the model of the persona.
+	Model string
+	// Persona replaces the persona of the channel.
+	Persona string
+	// Debug is turned on by "debug on" in the thread.
+	Debug bool
+}
+
+// SettingStore is implemented by MessageStores which can persist the settings of threads.
+type SettingStore interface {
+	// GetThreadSettings returns the zero settings if none are set.
+	GetThreadSettings(ctx context.Context, thid string) (*ThreadSettings, error)
+	PutThreadSettings(ctx context.Context, thid string, s *ThreadSettings) error
+}
@@ -15,6 +15,25 @@ type SlackMessage struct {
 	ThreadTS   string
 	Channel    string
 	EventTS    string
+
+	// Cached is true for a reply which came from the response cache.
+	Cached bool
+	// Actions are shown as buttons below the message.
+	Actions []Action
+	// Sources are cited below the message.
+	Sources []Source
+	// Responders are offered as Run buttons on the code blocks.
+	Responders []string
+}
+
+// ActionIDRunPrefix is followed by the responder name in the action_id of a Run button.
+const ActionIDRunPrefix = "run:"
+
+// Action is a button. ID is the action_id and Value is passed back when it's pressed.
+type Action struct {
+	ID    string
+	Text  string
+	Value string
 }
 
 var _ Message = (*SlackMessage)(nil)
@@ -78,6 +97,18 @@ func (m *SlackMessage) GetCreatedAt() time.Time {
 	return time.Unix(0, 0).Add(time.Duration(f * float64(time.Second)))
 }
 
+func (m *SlackMessage) IsCached() bool {
+	return m.Cached
+}
+
+func (m *SlackMessage) GetSources() []Source {
+	return m.Sources
+}
+
+func (m *SlackMessage) GetActions() []Action {
+	return m.Actions
+}
+
 func (m *SlackMessage) IsMentionAt(id string) bool {
 	return MentionAt(m.Text) == id
 }
@@ -89,3 +120,7 @@ func MentionAt(s string) string {
 	}
 	return ""
 }
+
+func (m *SlackMessage) GetResponders() []string {
+	return m.Responders
+}
@@ -0,0 +1,295 @@
+// Package storetest is the conformance suite of messagestore.MessageStore implementations.
+//
+//	func TestConversations(t *testing.T) {
+//		storetest.Run(t, "B1", NewConversations("B1", ...))
+//	}
+package storetest
+
+import (
+	"context"
+	"fmt"
+	"github.com/ku/chatbot-slack-llm/messagestore"
+	"github.com/slack-go/slack/slackevents"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// seq makes the timestamps unique across the runs so that persistent stores don't have to be emptied.
+var seq = time.Now().UnixMicro()
+
+// newTS returns a new message timestamp, later than the ones returned before.
+func newTS() string {
+	v := atomic.AddInt64(&seq, 1)
+	return fmt.Sprintf("%d.%06d", v/1e6, v%1e6)
+}
+
+type message struct {
+	user string
+	ts   string
+	thts string
+	text string
+}
+
+func (m *message) build() messagestore.Message {
+	return messagestore.NewMessageFromMessage(&slackevents.MessageEvent{
+		User:            m.user,
+		Channel:         "C1",
+		Text:            m.text,
+		TimeStamp:       m.ts,
+		ThreadTimeStamp: m.thts,
+	})
+}
+
+// Run runs the conformance tests against the store of the bot.
+func Run(t *testing.T, botID string, store messagestore.MessageStore) {
+	ctx := context.Background()
+	mention := "<@" + botID + "> "
+
+	onMessage := func(t *testing.T, m *message) bool {
+		t.Helper()
+		added, err := store.OnMessage(ctx, m.build())
+		if err != nil {
+			t.Fatalf("OnMessage(%s) failed: %s", m.ts, err.Error())
+		}
+		return added
+	}
+	// start adds the mention and returns the thread ID.
+	start := func(t *testing.T, user string) string {
+		t.Helper()
+		ts := newTS()
+		if !onMessage(t, &message{user: user, ts: ts, text: mention + "hello"}) {
+			t.Fatal("a mention should start a conversation")
+		}
+		return ts
+	}
+	getConversation := func(t *testing.T, thid string) messagestore.Conversation {
+		t.Helper()
+		cv, err := store.GetConversation(ctx, thid)
+		if err != nil {
+			t.Fatalf("GetConversation(%s) failed: %s", thid, err.Error())
+		}
+		return cv
+	}
+
+	t.Run("mention starts a conversation", func(t *testing.T) {
+		thid := start(t, "U1")
+		msgs := getConversation(t, thid).GetMessages()
+		if len(msgs) != 1 {
+			t.Fatalf("got %d messages, want 1", len(msgs))
+		}
+		if msgs[0].GetTimestamp() != thid || msgs[0].GetThreadID() != thid || msgs[0].GetText() != "hello" {
+			t.Errorf("unexpected message %s in %s: %q", msgs[0].GetTimestamp(), msgs[0].GetThreadID(), msgs[0].GetText())
+		}
+	})
+
+	t.Run("following messages are kept in the same conversation", func(t *testing.T) {
+		thid := start(t, "U1")
+		if !onMessage(t, &message{user: "U1", ts: newTS(), thts: thid, text: "are you listening?"}) {
+			t.Fatal("the reply should be added")
+		}
+		if msgs := getConversation(t, thid).GetMessages(); len(msgs) != 2 {
+			t.Fatalf("got %d messages, want 2", len(msgs))
+		}
+	})
+
+	t.Run("messages without a mention don't start a conversation", func(t *testing.T) {
+		ts := newTS()
+		if onMessage(t, &message{user: "U1", ts: ts, text: "hello"}) {
+			t.Error("a random message shouldn't be added")
+		}
+		if onMessage(t, &message{user: "U1", ts: newTS(), thts: ts, text: "anyone?"}) {
+			t.Error("a reply in an unknown thread shouldn't be added")
+		}
+		if cv, err := store.GetConversation(ctx, ts); err == nil {
+			t.Errorf("got a conversation of %d messages", len(cv.GetMessages()))
+		}
+	})
+
+	t.Run("unknown thread", func(t *testing.T) {
+		cv, err := store.GetConversation(ctx, newTS())
+		if err == nil {
+			t.Error("an unknown thread should be an error")
+		}
+		if cv != nil {
+			t.Error("an unknown thread should have no conversation")
+		}
+	})
+
+	t.Run("duplicate messages are added once", func(t *testing.T) {
+		thid := start(t, "U1")
+		m := &message{user: "U2", ts: newTS(), thts: thid, text: "hi"}
+		if !onMessage(t, m) {
+			t.Fatal("the first delivery should be added")
+		}
+		if onMessage(t, m) {
+			t.Error("the retried delivery shouldn't be added")
+		}
+		if onMessage(t, &message{user: "U1", ts: thid, text: mention + "hello"}) {
+			t.Error("the retried mention shouldn't be added")
+		}
+		if msgs := getConversation(t, thid).GetMessages(); len(msgs) != 2 {
+			t.Errorf("got %d messages, want 2", len(msgs))
+		}
+	})
+
+	t.Run("messages are ordered by timestamp", func(t *testing.T) {
+		thid := start(t, "U1")
+		first, second := newTS(), newTS()
+		// the later message arrives first.
+		onMessage(t, &message{user: "U1", ts: second, thts: thid, text: "second"})
+		onMessage(t, &message{user: "U1", ts: first, thts: thid, text: "first"})
+
+		var got []string
+		for _, m := range getConversation(t, thid).GetMessages() {
+			got = append(got, m.GetTimestamp())
+		}
+		if want := []string{thid, first, second}; fmt.Sprint(got) != fmt.Sprint(want) {
+			t.Errorf("got %v, want %v", got, want)
+		}
+	})
+
+	t.Run("initiator", func(t *testing.T) {
+		thid := start(t, "U1")
+		onMessage(t, &message{user: "U2", ts: newTS(), thts: thid, text: mention + "me too"})
+		onMessage(t, &message{user: "U1", ts: newTS(), thts: thid, text: "thanks"})
+
+		cv := getConversation(t, thid)
+		msgs := cv.GetMessages()
+		if len(msgs) != 3 {
+			t.Fatalf("got %d messages, want 3", len(msgs))
+		}
+		for i, want := range []bool{true, false, true} {
+			if got := cv.IsFromInitiater(msgs[i]); got != want {
+				t.Errorf("IsFromInitiater(%s by %s) = %v, want %v", msgs[i].GetTimestamp(), msgs[i].GetFrom(), got, want)
+			}
+		}
+	})
+
+	t.Run("concurrent messages", func(t *testing.T) {
+		thid := start(t, "U1")
+		const distinct, deliveries = 10, 3
+		var tss []string
+		for i := 0; i < distinct; i++ {
+			tss = append(tss, newTS())
+		}
+
+		var wg sync.WaitGroup
+		var added int64
+		for _, ts := range tss {
+			for j := 0; j < deliveries; j++ {
+				wg.Add(2)
+				go func(ts string) {
+					defer wg.Done()
+					ok, err := store.OnMessage(ctx, (&message{user: "U1", ts: ts, thts: thid, text: "reply"}).build())
+					if err != nil {
+						t.Error(err)
+					}
+					if ok {
+						atomic.AddInt64(&added, 1)
+					}
+				}(ts)
+				go func() {
+					defer wg.Done()
+					if _, err := store.GetConversation(ctx, thid); err != nil {
+						t.Error(err)
+					}
+				}()
+			}
+		}
+		wg.Wait()
+
+		if added != distinct {
+			t.Errorf("%d deliveries are added, want %d", added, distinct)
+		}
+		if msgs := getConversation(t, thid).GetMessages(); len(msgs) != distinct+1 {
+			t.Errorf("got %d messages, want %d", len(msgs), distinct+1)
+		}
+	})
+
+	if lister, ok := store.(messagestore.ConversationLister); ok {
+		t.Run("conversations are listed", func(t *testing.T) {
+			thid := start(t, "U1")
+			var found bool
+			err := lister.ListConversations(ctx, func(id string) error {
+				if id == thid {
+					found = true
+				}
+				return nil
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !found {
+				t.Errorf("%s isn't listed", thid)
+			}
+		})
+	}
+
+	editor, ok := store.(messagestore.MessageEditor)
+	if !ok {
+		return
+	}
+
+	t.Run("edited messages keep the previous texts", func(t *testing.T) {
+		thid := start(t, "U1")
+		ts := newTS()
+		onMessage(t, &message{user: "U1", ts: ts, thts: thid, text: "helo"})
+
+		editedAt := time.Unix(1690000000, 0)
+		for i, want := range []bool{true, false} {
+			// Slack sends the same text again e.g. when a link is unfurled.
+			edited, err := editor.EditMessage(ctx, (&message{user: "U1", ts: ts, thts: thid, text: "hello"}).build(), editedAt)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if edited != want {
+				t.Errorf("edit #%d = %v, want %v", i+1, edited, want)
+			}
+		}
+		if edited, _ := editor.EditMessage(ctx, (&message{user: "U1", ts: newTS(), thts: thid, text: "hi"}).build(), editedAt); edited {
+			t.Error("an unknown message shouldn't be edited")
+		}
+
+		msgs := getConversation(t, thid).GetMessages()
+		if len(msgs) != 2 || msgs[1].GetRawText() != "hello" || msgs[1].GetFrom() != "U1" {
+			t.Fatalf("the message isn't edited: %v", msgs)
+		}
+		edits, err := editor.GetEdits(ctx, msgs[1])
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(edits) != 1 || edits[0].Text != "helo" || !edits[0].EditedAt.Equal(editedAt) {
+			t.Errorf("unexpected edits %v", edits)
+		}
+	})
+
+	t.Run("deleted messages are removed", func(t *testing.T) {
+		thid := start(t, "U1")
+		m := (&message{user: "U1", ts: newTS(), thts: thid, text: "helo"}).build()
+		added, err := store.OnMessage(ctx, m)
+		if err != nil || !added {
+			t.Fatalf("OnMessage = %v, %v", added, err)
+		}
+		if _, err := editor.EditMessage(ctx, (&message{user: "U1", ts: m.GetTimestamp(), thts: thid, text: "hello"}).build(), time.Now()); err != nil {
+			t.Fatal(err)
+		}
+
+		for i, want := range []bool{true, false} {
+			deleted, err := editor.DeleteMessage(ctx, m)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if deleted != want {
+				t.Errorf("delete #%d = %v, want %v", i+1, deleted, want)
+			}
+		}
+		if msgs := getConversation(t, thid).GetMessages(); len(msgs) != 1 || msgs[0].GetTimestamp() != thid {
+			t.Errorf("got %d messages, want the mention only", len(msgs))
+		}
+		if edits, err := editor.GetEdits(ctx, m); err != nil || len(edits) != 0 {
+			t.Errorf("the edits should be deleted with the message: %v, %v", edits, err)
+		}
+	})
+}
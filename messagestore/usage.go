@@ -0,0 +1,49 @@
+package messagestore
+
+import (
+	"context"
+	"time"
+)
+
+// UsageRecord is the token usage of a reply.
+type UsageRecord struct {
+	Usage
+	ThreadID  string
+	Channel   string
+	User      string
+	CreatedAt time.Time
+}
+
+// UsageFilter selects usage records. Empty fields match everything.
+type UsageFilter struct {
+	From     time.Time
+	To       time.Time
+	ThreadID string
+	Channel  string
+	User     string
+}
+
+func (f *UsageFilter) Match(r *UsageRecord) bool {
+	if !f.From.IsZero() && r.CreatedAt.Before(f.From) {
+		return false
+	}
+	if !f.To.IsZero() && !r.CreatedAt.Before(f.To) {
+		return false
+	}
+	if f.ThreadID != "" && f.ThreadID != r.ThreadID {
+		return false
+	}
+	if f.Channel != "" && f.Channel != r.Channel {
+		return false
+	}
+	if f.User != "" && f.User != r.User {
+		return false
+	}
+	return true
+}
+
+// UsageStore is implemented by MessageStores which can record token usage.
+type UsageStore interface {
+	RecordUsage(ctx context.Context, r *UsageRecord) error
+	ListUsage(ctx context.Context, f *UsageFilter) ([]*UsageRecord, error)
+}